@@ -2,14 +2,21 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"task-matrix-be/internals/authmodule"
 	"task-matrix-be/internals/config"
 	"task-matrix-be/internals/dbconnectors"
+	"task-matrix-be/internals/mailer"
 	"task-matrix-be/internals/migrate"
 	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
 	"task-matrix-be/internals/server"
 	"task-matrix-be/internals/services"
 )
@@ -26,7 +33,6 @@ func main() {
 		log.Fatal("Error loading config : ", err)
 	}
 
-	auth := authmodule.NewInMemoryUUIDAuth[models.User]()
 	db, err := dbconnectors.GetPostgresDb(cfg.DB_URI)
 	if err != nil {
 		log.Fatal("Error connecting to postgres db: ", err)
@@ -44,14 +50,60 @@ func main() {
 		log.Fatal("Error mograting database : ", err)
 	}
 
-	user, project, task, err := services.GetServices(db, auth.GetToken)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var auth authmodule.Auth[models.User]
+	switch cfg.AUTH_BACKEND {
+	case "database":
+		auth = authmodule.NewSQLSessionAuth(ctx, db, cfg.SESSION_TTL, cfg.SESSION_SWEEP_INTERVAL)
+	case "jwt":
+		signer, err := newJWTSigner(cfg)
+		if err != nil {
+			log.Fatal("Error configuring JWT signer : ", err)
+		}
+		store := authmodule.NewSQLRefreshStore(ctx, db, cfg.SESSION_SWEEP_INTERVAL)
+		users, _, _, _, err := repo.GetRepos(db)
+		if err != nil {
+			log.Fatal("Error initializing repositories : ", err)
+		}
+		auth = authmodule.NewJWTAuth(signer, store, userSubject, userLoader(users), cfg.JWT_ACCESS_TTL, cfg.JWT_REFRESH_TTL)
+	case "redis":
+		redis, err := dbconnectors.GetRedisClient(cfg.REDIS_URL)
+		if err != nil {
+			log.Fatal("Error connecting to redis: ", err)
+		}
+		defer redis.Close()
+		store := authmodule.NewRedisTokenStore(redis, "task-matrix:")
+		auth = authmodule.NewTokenStoreAuth(store, userSubject, cfg.SESSION_TTL)
+	case "memory":
+		store := authmodule.NewMemoryTokenStore(ctx, cfg.SESSION_SWEEP_INTERVAL)
+		auth = authmodule.NewTokenStoreAuth(store, userSubject, cfg.SESSION_TTL)
+	default:
+		log.Fatalf("Unknown AUTH_BACKEND %q, expected \"database\", \"jwt\", \"redis\" or \"memory\"", cfg.AUTH_BACKEND)
+	}
+	log.Println("[+] Auth backend:", cfg.AUTH_BACKEND)
+
+	var mail mailer.Mailer
+	switch cfg.MAILER {
+	case "smtp":
+		mail = mailer.NewSMTPMailer(cfg.SMTP_HOST, cfg.SMTP_PORT, cfg.SMTP_USERNAME, cfg.SMTP_PASSWORD, cfg.MAIL_FROM)
+	case "file":
+		mail = mailer.NewFileMailer(cfg.MAIL_FILE_PATH)
+	case "log":
+		mail = mailer.NewLogMailer()
+	default:
+		log.Fatalf("Unknown MAILER %q, expected \"smtp\", \"file\" or \"log\"", cfg.MAILER)
+	}
+
+	user, project, task, org, err := services.GetServices(db, auth, mail, cfg)
 	if err != nil {
 		log.Fatal("Error initializing services : ", err)
 	}
 	log.Println("[+] Services Initialized")
 
 	r := server.NewChiRouter()
-	server.RegisterRoutes(r, user, project, task, auth.Validate)
+	server.RegisterRoutes(r, user, project, task, org, user.ValidateToken)
 
 	log.Println("[+] Routes registered")
 
@@ -62,3 +114,50 @@ func main() {
 
 	server.RunWithGracefulShutdown(&s)
 }
+
+// userSubject identifies the owner of a session, and is the JWT "sub" claim
+func userSubject(u models.User) string {
+	return strconv.Itoa(u.ID)
+}
+
+// userLoader finds the user whose JWT session is refreshed by their "sub"
+// claim
+func userLoader(users repo.UserRepo) func(ctx context.Context, subject string) (models.User, error) {
+	return func(ctx context.Context, subject string) (models.User, error) {
+		userID, err := strconv.Atoi(subject)
+		if err != nil {
+			return models.User{}, authmodule.ErrInvalidToken
+		}
+		user, err := users.GetUserByID(ctx, userID)
+		if err != nil {
+			return models.User{}, err
+		}
+		return *user, nil
+	}
+}
+
+// newJWTSigner builds the signer selected by JWT_ALGORITHM
+func newJWTSigner(cfg *config.Config) (authmodule.JWTSigner, error) {
+	switch cfg.JWT_ALGORITHM {
+	case "HS256":
+		if cfg.JWT_SECRET == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		return authmodule.NewHS256Signer([]byte(cfg.JWT_SECRET))
+	case "EdDSA":
+		raw, err := base64.StdEncoding.DecodeString(cfg.JWT_ED25519_PRIVATE_KEY)
+		if err != nil {
+			return nil, fmt.Errorf("decode JWT_ED25519_PRIVATE_KEY: %w", err)
+		}
+		switch len(raw) {
+		case ed25519.SeedSize:
+			return authmodule.NewEdDSASigner(ed25519.NewKeyFromSeed(raw))
+		case ed25519.PrivateKeySize:
+			return authmodule.NewEdDSASigner(ed25519.PrivateKey(raw))
+		default:
+			return nil, errors.New("JWT_ED25519_PRIVATE_KEY must be a 32 byte seed or 64 byte private key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", cfg.JWT_ALGORITHM)
+	}
+}
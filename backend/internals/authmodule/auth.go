@@ -1,6 +1,61 @@
 package authmodule
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenExpired       = errors.New("token expired")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrRefreshTokenReuse  = errors.New("refresh token reuse detected")
+	ErrRefreshUnsupported = errors.New("token refresh is not supported by this auth backend")
+)
+
 type Auth[T any] interface {
-	GetToken(payload T) (string, error)
+	GetToken(payload T, meta SessionMeta) (string, error)
 	Validate(tokenStr string) (T, error)
+
+	// Revoke ends the session the token belongs to
+	Revoke(tokenStr string) error
+	// RevokeSession ends one of payload's sessions by its ID
+	RevokeSession(payload T, sessionID string) error
+	// RevokeAllForUser ends every session of payload
+	RevokeAllForUser(payload T) error
+	// ListSessions returns the active sessions of payload
+	ListSessions(payload T) ([]Session, error)
+}
+
+// SessionMeta describes the client a session was created for
+type SessionMeta struct {
+	IP        string
+	UserAgent string
+}
+
+// Session is a logged-in client as shown to its owner
+type Session struct {
+	ID         string     `json:"id"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+}
+
+// TokenPair is a short-lived access token together with the long-lived
+// refresh token that can be exchanged for the next pair
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// RefreshableAuth is implemented by backends that issue access/refresh token
+// pairs. Every Refresh rotates the refresh token; presenting an already
+// rotated refresh token revokes the whole session.
+type RefreshableAuth[T any] interface {
+	Auth[T]
+	GetTokenPair(payload T, meta SessionMeta) (TokenPair, error)
+	Refresh(refreshToken string) (TokenPair, error)
 }
@@ -0,0 +1,124 @@
+package authmodule
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JWTSigner signs and verifies the compact JWS form used for JWTs
+type JWTSigner interface {
+	// Algorithm returns the JOSE "alg" header value
+	Algorithm() string
+	Sign(signingInput []byte) ([]byte, error)
+	Verify(signingInput, signature []byte) bool
+}
+
+type hs256Signer struct {
+	secret []byte
+}
+
+// NewHS256Signer returns an HMAC-SHA256 signer. The secret should be at least 32 bytes.
+func NewHS256Signer(secret []byte) (JWTSigner, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("HS256 secret must be at least 32 bytes")
+	}
+	return &hs256Signer{secret: secret}, nil
+}
+
+func (s *hs256Signer) Algorithm() string { return "HS256" }
+
+func (s *hs256Signer) Sign(signingInput []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil), nil
+}
+
+func (s *hs256Signer) Verify(signingInput, signature []byte) bool {
+	expected, _ := s.Sign(signingInput)
+	return hmac.Equal(expected, signature)
+}
+
+type ed25519Signer struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// NewEdDSASigner returns an Ed25519 signer
+func NewEdDSASigner(private ed25519.PrivateKey) (JWTSigner, error) {
+	if len(private) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid Ed25519 private key size")
+	}
+	return &ed25519Signer{private: private, public: private.Public().(ed25519.PublicKey)}, nil
+}
+
+func (s *ed25519Signer) Algorithm() string { return "EdDSA" }
+
+func (s *ed25519Signer) Sign(signingInput []byte) ([]byte, error) {
+	return ed25519.Sign(s.private, signingInput), nil
+}
+
+func (s *ed25519Signer) Verify(signingInput, signature []byte) bool {
+	return ed25519.Verify(s.public, signingInput, signature)
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// encodeJWT serializes claims and signs them with signer
+func encodeJWT(signer JWTSigner, claims any) (string, error) {
+	header, err := json.Marshal(jwtHeader{Algorithm: signer.Algorithm(), Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("marshal claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body)
+	sig, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("sign token: %w", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// decodeJWT verifies the signature of tokenStr and unmarshals its claims.
+// The token's "alg" header must match the signer exactly.
+func decodeJWT(signer JWTSigner, tokenStr string, claims any) error {
+	parts := strings.Split(tokenStr, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(rawHeader, &header); err != nil || header.Algorithm != signer.Algorithm() {
+		return ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !signer.Verify([]byte(parts[0]+"."+parts[1]), sig) {
+		return ErrInvalidToken
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(body, claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package authmodule
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	jwtIssuer        = "task-matrix"
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+)
+
+type jwtClaims[T any] struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	SessionID string `json:"sid,omitempty"`
+	ID        string `json:"jti"`
+	Type      string `json:"typ"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Data      T      `json:"data"`
+}
+
+type jwtAuth[T any] struct {
+	signer     JWTSigner
+	store      RefreshStore
+	subject    func(payload T) string
+	load       func(ctx context.Context, subject string) (T, error)
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewJWTAuth returns a stateless Auth issuing signed JWT access tokens that
+// carry the payload, plus rotating refresh tokens tracked in store. subject
+// maps a payload to the stable identifier used as the "sub" claim, and load
+// maps it back to the current payload when a session is refreshed, so that
+// changes to it reach the next access token.
+//
+// Sessions are refresh token families: revoking one stops it from being
+// refreshed, but access tokens already issued for it stay valid until they
+// expire, so accessTTL should be kept short.
+func NewJWTAuth[T any](signer JWTSigner, store RefreshStore, subject func(payload T) string, load func(ctx context.Context, subject string) (T, error), accessTTL, refreshTTL time.Duration) RefreshableAuth[T] {
+	return &jwtAuth[T]{
+		signer:     signer,
+		store:      store,
+		subject:    subject,
+		load:       load,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// GetToken issues a single access token that is not tied to a refreshable session
+func (a *jwtAuth[T]) GetToken(payload T, meta SessionMeta) (string, error) {
+	return a.sign(payload, "", tokenTypeAccess, a.accessTTL)
+}
+
+func (a *jwtAuth[T]) Validate(tokenStr string) (T, error) {
+	claims, err := a.parse(tokenStr, tokenTypeAccess)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return claims.Data, nil
+}
+
+func (a *jwtAuth[T]) GetTokenPair(payload T, meta SessionMeta) (TokenPair, error) {
+	sessionID := uuid.New().String()
+	refreshToken, jti, err := a.signRefresh(payload, sessionID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.store.Create(ctx, sessionID, a.subject(payload), jti, meta, time.Now().UTC().Add(a.refreshTTL)); err != nil {
+		return TokenPair{}, err
+	}
+	return a.pair(payload, sessionID, refreshToken)
+}
+
+func (a *jwtAuth[T]) Refresh(refreshToken string) (TokenPair, error) {
+	claims, err := a.parse(refreshToken, tokenTypeRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if claims.SessionID == "" {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	payload, err := a.load(ctx, claims.Subject)
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("load payload: %w", err)
+	}
+
+	next, jti, err := a.signRefresh(payload, claims.SessionID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if err := a.store.Rotate(ctx, claims.SessionID, claims.ID, jti, time.Now().UTC().Add(a.refreshTTL)); err != nil {
+		return TokenPair{}, err
+	}
+	return a.pair(payload, claims.SessionID, next)
+}
+
+// Revoke ends the session of an access or refresh token. Expired tokens are
+// accepted so that clients can always log out.
+func (a *jwtAuth[T]) Revoke(tokenStr string) error {
+	var claims jwtClaims[T]
+	if err := decodeJWT(a.signer, tokenStr, &claims); err != nil {
+		return err
+	}
+	if claims.Issuer != jwtIssuer || claims.SessionID == "" {
+		return ErrSessionNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return a.store.Delete(ctx, claims.SessionID, claims.Subject)
+}
+
+func (a *jwtAuth[T]) RevokeSession(payload T, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return a.store.Delete(ctx, sessionID, a.subject(payload))
+}
+
+func (a *jwtAuth[T]) RevokeAllForUser(payload T) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return a.store.DeleteAll(ctx, a.subject(payload))
+}
+
+func (a *jwtAuth[T]) ListSessions(payload T) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return a.store.List(ctx, a.subject(payload))
+}
+
+func (a *jwtAuth[T]) pair(payload T, sessionID, refreshToken string) (TokenPair, error) {
+	access, err := a.sign(payload, sessionID, tokenTypeAccess, a.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(a.accessTTL.Seconds()),
+	}, nil
+}
+
+func (a *jwtAuth[T]) signRefresh(payload T, sessionID string) (token, jti string, err error) {
+	claims := a.claims(payload, sessionID, tokenTypeRefresh, a.refreshTTL)
+	token, err = encodeJWT(a.signer, claims)
+	return token, claims.ID, err
+}
+
+func (a *jwtAuth[T]) sign(payload T, sessionID, tokenType string, ttl time.Duration) (string, error) {
+	return encodeJWT(a.signer, a.claims(payload, sessionID, tokenType, ttl))
+}
+
+func (a *jwtAuth[T]) claims(payload T, sessionID, tokenType string, ttl time.Duration) jwtClaims[T] {
+	now := time.Now().UTC()
+	return jwtClaims[T]{
+		Issuer:    jwtIssuer,
+		Subject:   a.subject(payload),
+		SessionID: sessionID,
+		ID:        uuid.New().String(),
+		Type:      tokenType,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+		Data:      payload,
+	}
+}
+
+// parse verifies tokenStr and checks its issuer, type and expiry
+func (a *jwtAuth[T]) parse(tokenStr, tokenType string) (jwtClaims[T], error) {
+	var claims jwtClaims[T]
+	if err := decodeJWT(a.signer, tokenStr, &claims); err != nil {
+		return claims, err
+	}
+	if claims.Issuer != jwtIssuer || claims.Type != tokenType {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().UTC().Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
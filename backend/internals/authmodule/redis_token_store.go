@@ -0,0 +1,129 @@
+package authmodule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// RESPClient sends a single command to a server speaking the Redis protocol,
+// e.g. *dbconnectors.RedisClient
+type RESPClient interface {
+	Do(ctx context.Context, args ...string) (any, error)
+}
+
+type redisTokenStore struct {
+	client RESPClient
+	prefix string
+}
+
+// NewRedisTokenStore returns a TokenStore kept in a Redis compatible server
+// so that every API replica sees the same sessions. Records are stored as
+// JSON under <prefix>token:<key> and indexed per subject in the set
+// <prefix>subject:<subject>; expiry is delegated to the server.
+func NewRedisTokenStore(client RESPClient, prefix string) TokenStore {
+	return &redisTokenStore{client: client, prefix: prefix}
+}
+
+func (s *redisTokenStore) tokenKey(key string) string { return s.prefix + "token:" + key }
+
+func (s *redisTokenStore) subjectKey(subject string) string { return s.prefix + "subject:" + subject }
+
+func (s *redisTokenStore) Save(ctx context.Context, key string, record TokenRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal token record: %w", err)
+	}
+
+	args := []string{"SET", s.tokenKey(key), string(data)}
+	var ttl time.Duration
+	if !record.ExpiresAt.IsZero() {
+		ttl = time.Until(record.ExpiresAt)
+		if ttl <= 0 {
+			return nil
+		}
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := s.client.Do(ctx, args...); err != nil {
+		return fmt.Errorf("save token record: %w", err)
+	}
+
+	if _, err := s.client.Do(ctx, "SADD", s.subjectKey(record.Subject), key); err != nil {
+		return fmt.Errorf("index token record: %w", err)
+	}
+	// Every session shares the same ttl, so the index lives as long as the
+	// most recently saved session
+	if ttl > 0 {
+		if _, err := s.client.Do(ctx, "PEXPIRE", s.subjectKey(record.Subject), strconv.FormatInt(ttl.Milliseconds(), 10)); err != nil {
+			return fmt.Errorf("expire token index: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *redisTokenStore) Load(ctx context.Context, key string) (TokenRecord, error) {
+	reply, err := s.client.Do(ctx, "GET", s.tokenKey(key))
+	if err != nil {
+		return TokenRecord{}, fmt.Errorf("load token record: %w", err)
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		return TokenRecord{}, ErrInvalidToken
+	}
+
+	var record TokenRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return TokenRecord{}, fmt.Errorf("unmarshal token record: %w", err)
+	}
+	if record.expired(time.Now().UTC()) {
+		return TokenRecord{}, ErrInvalidToken
+	}
+	return record, nil
+}
+
+func (s *redisTokenStore) Delete(ctx context.Context, key string) error {
+	record, err := s.Load(ctx, key)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	if _, err := s.client.Do(ctx, "DEL", s.tokenKey(key)); err != nil {
+		return fmt.Errorf("delete token record: %w", err)
+	}
+	if _, err := s.client.Do(ctx, "SREM", s.subjectKey(record.Subject), key); err != nil {
+		return fmt.Errorf("unindex token record: %w", err)
+	}
+	return nil
+}
+
+func (s *redisTokenStore) BySubject(ctx context.Context, subject string) (map[string]TokenRecord, error) {
+	reply, err := s.client.Do(ctx, "SMEMBERS", s.subjectKey(subject))
+	if err != nil {
+		return nil, fmt.Errorf("list token records: %w", err)
+	}
+	members, _ := reply.([]any)
+
+	records := make(map[string]TokenRecord, len(members))
+	for _, member := range members {
+		raw, ok := member.([]byte)
+		if !ok {
+			continue
+		}
+		key := string(raw)
+
+		record, err := s.Load(ctx, key)
+		if errors.Is(err, ErrInvalidToken) {
+			// Expired by the server, drop it from the index
+			s.client.Do(ctx, "SREM", s.subjectKey(subject), key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records[key] = record
+	}
+	return records, nil
+}
@@ -0,0 +1,157 @@
+package authmodule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"task-matrix-be/internals/dbconnectors"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisTokenStore(t *testing.T) (*miniredis.Miniredis, TokenStore) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client, err := dbconnectors.GetRedisClient("redis://" + srv.Addr())
+	if err != nil {
+		t.Fatalf("GetRedisClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return srv, NewRedisTokenStore(client, "test:")
+}
+
+func testTokenRecord(subject string, ttl time.Duration) TokenRecord {
+	now := time.Now().UTC()
+	return TokenRecord{
+		SessionID:  "session-" + subject,
+		Subject:    subject,
+		Payload:    []byte(`{"id":1}`),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+}
+
+func TestRedisTokenStoreSaveLoad(t *testing.T) {
+	srv, store := newTestRedisTokenStore(t)
+	ctx := context.Background()
+
+	record := testTokenRecord("1", time.Hour)
+	if err := store.Save(ctx, "k1", record); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Load(ctx, "k1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.SessionID != record.SessionID || got.Subject != record.Subject || string(got.Payload) != string(record.Payload) {
+		t.Fatalf("Load = %+v; want %+v", got, record)
+	}
+
+	if ttl := srv.TTL("test:token:k1"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("record ttl = %v; want up to an hour", ttl)
+	}
+	if ttl := srv.TTL("test:subject:1"); ttl <= 0 {
+		t.Fatalf("index ttl = %v; want it to expire", ttl)
+	}
+
+	if _, err := store.Load(ctx, "missing"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Load missing = %v; want ErrInvalidToken", err)
+	}
+}
+
+func TestRedisTokenStoreExpiry(t *testing.T) {
+	srv, store := newTestRedisTokenStore(t)
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "short", testTokenRecord("1", time.Minute)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Save(ctx, "long", testTokenRecord("1", time.Hour)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	srv.FastForward(2 * time.Minute)
+
+	if _, err := store.Load(ctx, "short"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Load expired = %v; want ErrInvalidToken", err)
+	}
+	records, err := store.BySubject(ctx, "1")
+	if err != nil {
+		t.Fatalf("BySubject: %v", err)
+	}
+	if _, ok := records["long"]; !ok || len(records) != 1 {
+		t.Fatalf("BySubject = %v; want only the live record", records)
+	}
+	if ok, _ := srv.SIsMember("test:subject:1", "short"); ok {
+		t.Fatal("expired record is still indexed")
+	}
+
+	// A record that has already expired is not stored at all
+	if err := store.Save(ctx, "stale", testTokenRecord("1", -time.Second)); err != nil {
+		t.Fatalf("Save stale: %v", err)
+	}
+	if srv.Exists("test:token:stale") {
+		t.Fatal("stale record was stored")
+	}
+}
+
+func TestRedisTokenStoreDelete(t *testing.T) {
+	srv, store := newTestRedisTokenStore(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"k1", "k2"} {
+		if err := store.Save(ctx, key, testTokenRecord("1", time.Hour)); err != nil {
+			t.Fatalf("Save %s: %v", key, err)
+		}
+	}
+
+	if err := store.Delete(ctx, "k1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Load(ctx, "k1"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Load revoked = %v; want ErrInvalidToken", err)
+	}
+	if ok, _ := srv.SIsMember("test:subject:1", "k1"); ok {
+		t.Fatal("revoked record is still indexed")
+	}
+	records, err := store.BySubject(ctx, "1")
+	if err != nil {
+		t.Fatalf("BySubject: %v", err)
+	}
+	if _, ok := records["k2"]; !ok || len(records) != 1 {
+		t.Fatalf("BySubject = %v; want only k2", records)
+	}
+
+	if err := store.Delete(ctx, "k1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("Delete twice = %v; want ErrSessionNotFound", err)
+	}
+}
+
+func TestRedisTokenStoreServerError(t *testing.T) {
+	srv, store := newTestRedisTokenStore(t)
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "k1", testTokenRecord("1", time.Hour)); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	dialed := srv.TotalConnectionCount()
+
+	srv.SetError("LOADING server is loading")
+	_, err := store.Load(ctx, "k1")
+	var redisErr dbconnectors.RedisError
+	if !errors.As(err, &redisErr) {
+		t.Fatalf("Load while failing = %v; want the server error", err)
+	}
+	srv.SetError("")
+
+	if _, err := store.Load(ctx, "k1"); err != nil {
+		t.Fatalf("Load after the server recovered: %v", err)
+	}
+	if got := srv.TotalConnectionCount(); got != dialed {
+		t.Fatalf("dialed %d connections after an error reply; want the pooled one reused", got-dialed)
+	}
+}
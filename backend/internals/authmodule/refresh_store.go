@@ -0,0 +1,246 @@
+package authmodule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RefreshStore tracks the refresh token currently valid for each session so
+// that rotated (already used) refresh tokens can be detected
+type RefreshStore interface {
+	// Create registers a new session whose current refresh token id is jti
+	Create(ctx context.Context, sessionID, subject, jti string, meta SessionMeta, expiresAt time.Time) error
+	// Rotate replaces oldJTI with newJTI. If oldJTI is not the current token
+	// of a live session the session is revoked and ErrRefreshTokenReuse returned.
+	Rotate(ctx context.Context, sessionID, oldJTI, newJTI string, expiresAt time.Time) error
+	// Delete removes a session of subject, returning ErrSessionNotFound if there is none
+	Delete(ctx context.Context, sessionID, subject string) error
+	// DeleteAll removes every session of subject
+	DeleteAll(ctx context.Context, subject string) error
+	// List returns the live sessions of subject, most recently used first
+	List(ctx context.Context, subject string) ([]Session, error)
+}
+
+type refreshSession struct {
+	subject    string
+	meta       SessionMeta
+	jti        string
+	createdAt  time.Time
+	lastUsedAt time.Time
+	expiresAt  time.Time
+}
+
+type memoryRefreshStore struct {
+	mu       sync.Mutex
+	sessions map[string]*refreshSession
+}
+
+// NewMemoryRefreshStore returns a process-local RefreshStore. Sessions are
+// lost on restart and not shared between replicas.
+func NewMemoryRefreshStore() RefreshStore {
+	return &memoryRefreshStore{sessions: make(map[string]*refreshSession)}
+}
+
+func (m *memoryRefreshStore) Create(ctx context.Context, sessionID, subject, jti string, meta SessionMeta, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	m.sessions[sessionID] = &refreshSession{
+		subject:    subject,
+		meta:       meta,
+		jti:        jti,
+		createdAt:  now,
+		lastUsedAt: now,
+		expiresAt:  expiresAt,
+	}
+	return nil
+}
+
+func (m *memoryRefreshStore) Rotate(ctx context.Context, sessionID, oldJTI, newJTI string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok {
+		return ErrInvalidToken
+	}
+	now := time.Now().UTC()
+	if !s.expiresAt.After(now) {
+		delete(m.sessions, sessionID)
+		return ErrInvalidToken
+	}
+	if s.jti != oldJTI {
+		delete(m.sessions, sessionID)
+		return ErrRefreshTokenReuse
+	}
+
+	s.jti = newJTI
+	s.lastUsedAt = now
+	s.expiresAt = expiresAt
+	return nil
+}
+
+func (m *memoryRefreshStore) Delete(ctx context.Context, sessionID, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[sessionID]
+	if !ok || s.subject != subject {
+		return ErrSessionNotFound
+	}
+	delete(m.sessions, sessionID)
+	return nil
+}
+
+func (m *memoryRefreshStore) DeleteAll(ctx context.Context, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		if s.subject == subject {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryRefreshStore) List(ctx context.Context, subject string) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	sessions := make([]Session, 0)
+	for id, s := range m.sessions {
+		if s.subject != subject || !s.expiresAt.After(now) {
+			continue
+		}
+		expiresAt := s.expiresAt
+		sessions = append(sessions, Session{
+			ID:         id,
+			IP:         s.meta.IP,
+			UserAgent:  s.meta.UserAgent,
+			CreatedAt:  s.createdAt,
+			LastSeenAt: s.lastUsedAt,
+			ExpiresAt:  &expiresAt,
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+type sqlRefreshStore struct {
+	db *sql.DB
+}
+
+// NewSQLRefreshStore returns a RefreshStore backed by the refresh_sessions
+// table, shared by every API replica using the same database. Expired
+// sessions are purged every sweepInterval until ctx is cancelled.
+func NewSQLRefreshStore(ctx context.Context, db *sql.DB, sweepInterval time.Duration) RefreshStore {
+	s := &sqlRefreshStore{db: db}
+	if sweepInterval > 0 {
+		go runSweeper(ctx, sweepInterval, "RefreshStore", func(ctx context.Context) (int64, error) {
+			return execRowsAffected(ctx, db, `DELETE FROM refresh_sessions WHERE expires_at <= $1`, time.Now().UTC())
+		})
+	}
+	return s
+}
+
+func (s *sqlRefreshStore) Create(ctx context.Context, sessionID, subject, jti string, meta SessionMeta, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO refresh_sessions (id, subject, jti, ip, user_agent, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7)
+	`
+	_, err := s.db.ExecContext(ctx, query, sessionID, subject, jti, meta.IP, meta.UserAgent, now, expiresAt)
+	if err != nil {
+		return fmt.Errorf("create refresh session: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlRefreshStore) Rotate(ctx context.Context, sessionID, oldJTI, newJTI string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE refresh_sessions
+		SET jti = $1, last_used_at = $2, expires_at = $3
+		WHERE id = $4 AND jti = $5 AND expires_at > $2
+	`, newJTI, now, expiresAt, sessionID, oldJTI)
+	if err != nil {
+		return fmt.Errorf("rotate refresh session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("rotate refresh session: %w", err)
+	} else if n == 1 {
+		return nil
+	}
+
+	// Nothing rotated: the session is gone, expired, or oldJTI was already used
+	var currentExpiry time.Time
+	err = s.db.QueryRowContext(ctx,
+		`SELECT expires_at FROM refresh_sessions WHERE id = $1`, sessionID,
+	).Scan(&currentExpiry)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidToken
+	}
+	if err != nil {
+		return fmt.Errorf("lookup refresh session: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM refresh_sessions WHERE id = $1`, sessionID); err != nil {
+		return fmt.Errorf("revoke refresh session: %w", err)
+	}
+	if !currentExpiry.After(now) {
+		return ErrInvalidToken
+	}
+	return ErrRefreshTokenReuse
+}
+
+func (s *sqlRefreshStore) Delete(ctx context.Context, sessionID, subject string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM refresh_sessions WHERE id = $1 AND subject = $2`, sessionID, subject)
+	if err != nil {
+		return fmt.Errorf("revoke refresh session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *sqlRefreshStore) DeleteAll(ctx context.Context, subject string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM refresh_sessions WHERE subject = $1`, subject); err != nil {
+		return fmt.Errorf("revoke refresh sessions: %w", err)
+	}
+	return nil
+}
+
+func (s *sqlRefreshStore) List(ctx context.Context, subject string) ([]Session, error) {
+	query := `
+		SELECT id, ip, user_agent, created_at, last_used_at, expires_at
+		FROM refresh_sessions
+		WHERE subject = $1 AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`
+	rows, err := s.db.QueryContext(ctx, query, subject, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list refresh sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var session Session
+		var expiresAt time.Time
+		if err := rows.Scan(&session.ID, &session.IP, &session.UserAgent, &session.CreatedAt, &session.LastSeenAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("scan refresh session: %w", err)
+		}
+		session.ExpiresAt = &expiresAt
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
@@ -0,0 +1,199 @@
+package authmodule
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lastUsedGranularity limits how often a session's last_used_at/expires_at
+// columns are rewritten, so that validating a token is not a write on every request.
+const lastUsedGranularity = time.Minute
+
+type sqlSessionAuth struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewSQLSessionAuth returns a database-backed Auth that stores opaque session
+// tokens in the sessions table. Sessions expire after ttl of inactivity and are
+// renewed on use. A background sweeper purges expired sessions every
+// sweepInterval until ctx is cancelled.
+func NewSQLSessionAuth(ctx context.Context, db *sql.DB, ttl, sweepInterval time.Duration) Auth[models.User] {
+	a := &sqlSessionAuth{db: db, ttl: ttl}
+	if sweepInterval > 0 {
+		go a.sweep(ctx, sweepInterval)
+	}
+	return a
+}
+
+func (a *sqlSessionAuth) GetToken(payload models.User, meta SessionMeta) (string, error) {
+	tokenStr, err := utils.RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO sessions (id, token_hash, user_id, ip, user_agent, created_at, last_used_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $7)
+	`
+	_, err = a.db.ExecContext(ctx, query,
+		uuid.New().String(), utils.HashToken(tokenStr), payload.ID,
+		meta.IP, meta.UserAgent, now, now.Add(a.ttl),
+	)
+	if err != nil {
+		return "", fmt.Errorf("create session: %w", err)
+	}
+	return tokenStr, nil
+}
+
+func (a *sqlSessionAuth) Validate(tokenStr string) (models.User, error) {
+	var user models.User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	query := `
+		SELECT s.id, s.last_used_at,
+		       u.id, u.name, u.username, u.email, u.avatar_url
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > $2
+	`
+	var sessionID string
+	var lastUsedAt time.Time
+	err := a.db.QueryRowContext(ctx, query, utils.HashToken(tokenStr), now).Scan(
+		&sessionID, &lastUsedAt,
+		&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, ErrInvalidToken
+	}
+	if err != nil {
+		return user, fmt.Errorf("validate session: %w", err)
+	}
+
+	// Sliding renewal: every use pushes the expiry ttl into the future.
+	if now.Sub(lastUsedAt) >= lastUsedGranularity {
+		_, err = a.db.ExecContext(ctx,
+			`UPDATE sessions SET last_used_at = $1, expires_at = $2 WHERE id = $3`,
+			now, now.Add(a.ttl), sessionID)
+		if err != nil {
+			log.Printf("[WARN] [SessionAuth] Failed to renew session %s: %v", sessionID, err)
+		}
+	}
+
+	return user, nil
+}
+
+func (a *sqlSessionAuth) Revoke(tokenStr string) error {
+	return a.deleteSessions(`DELETE FROM sessions WHERE token_hash = $1`, utils.HashToken(tokenStr))
+}
+
+func (a *sqlSessionAuth) RevokeSession(payload models.User, sessionID string) error {
+	return a.deleteSessions(`DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sessionID, payload.ID)
+}
+
+func (a *sqlSessionAuth) RevokeAllForUser(payload models.User) error {
+	err := a.deleteSessions(`DELETE FROM sessions WHERE user_id = $1`, payload.ID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (a *sqlSessionAuth) ListSessions(payload models.User) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT id, ip, user_agent, created_at, last_used_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY last_used_at DESC
+	`
+	rows, err := a.db.QueryContext(ctx, query, payload.ID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		var s Session
+		var expiresAt time.Time
+		if err := rows.Scan(&s.ID, &s.IP, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		s.ExpiresAt = &expiresAt
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// deleteSessions runs a DELETE on the sessions table and reports
+// ErrSessionNotFound when it removed nothing
+func (a *sqlSessionAuth) deleteSessions(query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := a.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// sweep periodically deletes expired sessions until ctx is cancelled
+func (a *sqlSessionAuth) sweep(ctx context.Context, interval time.Duration) {
+	runSweeper(ctx, interval, "SessionAuth", func(ctx context.Context) (int64, error) {
+		return execRowsAffected(ctx, a.db, `DELETE FROM sessions WHERE expires_at <= $1`, time.Now().UTC())
+	})
+}
+
+// runSweeper calls purge every interval until ctx is cancelled, logging how
+// many sessions each run removed
+func runSweeper(ctx context.Context, interval time.Duration, name string, purge func(ctx context.Context) (int64, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := purge(ctx)
+			if err != nil {
+				log.Printf("[WARN] [%s] Failed to purge expired sessions: %v", name, err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("[INFO] [%s] Purged %d expired sessions", name, n)
+			}
+		}
+	}
+}
+
+// execRowsAffected runs a statement and returns how many rows it changed
+func execRowsAffected(ctx context.Context, db *sql.DB, query string, args ...any) (int64, error) {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
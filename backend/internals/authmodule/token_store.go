@@ -0,0 +1,138 @@
+package authmodule
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// TokenRecord is what a TokenStore keeps for one opaque session token
+type TokenRecord struct {
+	SessionID  string          `json:"id"`
+	Subject    string          `json:"sub"`
+	Payload    json.RawMessage `json:"payload"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	CreatedAt  time.Time       `json:"created_at"`
+	LastSeenAt time.Time       `json:"last_seen_at"`
+	ExpiresAt  time.Time       `json:"expires_at"`
+}
+
+func (r TokenRecord) expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(now)
+}
+
+// TokenStore persists opaque session tokens by key (the token's hash).
+// Implementations must be safe for concurrent use.
+type TokenStore interface {
+	// Save creates or replaces the record stored under key
+	Save(ctx context.Context, key string, record TokenRecord) error
+	// Load returns the record under key, or ErrInvalidToken if it is missing or expired
+	Load(ctx context.Context, key string) (TokenRecord, error)
+	// Delete removes the record under key, or returns ErrSessionNotFound
+	Delete(ctx context.Context, key string) error
+	// BySubject returns the live records of subject keyed by their store key
+	BySubject(ctx context.Context, subject string) (map[string]TokenRecord, error)
+}
+
+// memoryTokenStoreShards spreads keys over independently locked maps so
+// concurrent requests rarely contend on the same lock
+const memoryTokenStoreShards = 32
+
+type memoryTokenShard struct {
+	mu      sync.RWMutex
+	records map[string]TokenRecord
+}
+
+type memoryTokenStore struct {
+	shards [memoryTokenStoreShards]memoryTokenShard
+}
+
+// NewMemoryTokenStore returns a process-local TokenStore. Expired records
+// are purged every sweepInterval until ctx is cancelled.
+func NewMemoryTokenStore(ctx context.Context, sweepInterval time.Duration) TokenStore {
+	m := &memoryTokenStore{}
+	for i := range m.shards {
+		m.shards[i].records = make(map[string]TokenRecord)
+	}
+	if sweepInterval > 0 {
+		go runSweeper(ctx, sweepInterval, "MemoryTokenStore", func(ctx context.Context) (int64, error) {
+			return m.purgeExpired(), nil
+		})
+	}
+	return m
+}
+
+func (m *memoryTokenStore) shard(key string) *memoryTokenShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return &m.shards[h.Sum32()%memoryTokenStoreShards]
+}
+
+func (m *memoryTokenStore) Save(ctx context.Context, key string, record TokenRecord) error {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records[key] = record
+	return nil
+}
+
+func (m *memoryTokenStore) Load(ctx context.Context, key string) (TokenRecord, error) {
+	s := m.shard(key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[key]
+	if !ok || record.expired(time.Now().UTC()) {
+		return TokenRecord{}, ErrInvalidToken
+	}
+	return record, nil
+}
+
+func (m *memoryTokenStore) Delete(ctx context.Context, key string) error {
+	s := m.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[key]; !ok {
+		return ErrSessionNotFound
+	}
+	delete(s.records, key)
+	return nil
+}
+
+func (m *memoryTokenStore) BySubject(ctx context.Context, subject string) (map[string]TokenRecord, error) {
+	now := time.Now().UTC()
+	records := make(map[string]TokenRecord)
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		for key, record := range s.records {
+			if record.Subject == subject && !record.expired(now) {
+				records[key] = record
+			}
+		}
+		s.mu.RUnlock()
+	}
+	return records, nil
+}
+
+func (m *memoryTokenStore) purgeExpired() int64 {
+	now := time.Now().UTC()
+	var purged int64
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		for key, record := range s.records {
+			if record.expired(now) {
+				delete(s.records, key)
+				purged++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return purged
+}
@@ -0,0 +1,161 @@
+package authmodule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type tokenStoreAuth[T any] struct {
+	store   TokenStore
+	subject func(payload T) string
+	ttl     time.Duration
+}
+
+// NewTokenStoreAuth returns an Auth issuing opaque tokens whose sessions are
+// kept in store under the token's hash. subject maps a payload to the
+// identifier its sessions are grouped by. Sessions expire after ttl of
+// inactivity (never if ttl is 0) and are renewed on use.
+func NewTokenStoreAuth[T any](store TokenStore, subject func(payload T) string, ttl time.Duration) Auth[T] {
+	return &tokenStoreAuth[T]{store: store, subject: subject, ttl: ttl}
+}
+
+func (a *tokenStoreAuth[T]) GetToken(payload T, meta SessionMeta) (string, error) {
+	tokenStr, err := utils.RandomToken()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("marshal payload: %w", err)
+	}
+
+	now := time.Now().UTC()
+	record := TokenRecord{
+		SessionID:  uuid.New().String(),
+		Subject:    a.subject(payload),
+		Payload:    data,
+		IP:         meta.IP,
+		UserAgent:  meta.UserAgent,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  a.expiry(now),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.store.Save(ctx, utils.HashToken(tokenStr), record); err != nil {
+		return "", err
+	}
+	return tokenStr, nil
+}
+
+func (a *tokenStoreAuth[T]) Validate(tokenStr string) (T, error) {
+	var payload T
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := utils.HashToken(tokenStr)
+	record, err := a.store.Load(ctx, key)
+	if err != nil {
+		return payload, err
+	}
+	if err := json.Unmarshal(record.Payload, &payload); err != nil {
+		return payload, fmt.Errorf("unmarshal payload: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(record.LastSeenAt) >= lastUsedGranularity {
+		record.LastSeenAt = now
+		record.ExpiresAt = a.expiry(now)
+		if err := a.store.Save(ctx, key, record); err != nil {
+			log.Printf("[WARN] [TokenStoreAuth] Failed to renew session %s: %v", record.SessionID, err)
+		}
+	}
+
+	return payload, nil
+}
+
+func (a *tokenStoreAuth[T]) Revoke(tokenStr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return a.store.Delete(ctx, utils.HashToken(tokenStr))
+}
+
+func (a *tokenStoreAuth[T]) RevokeSession(payload T, sessionID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	records, err := a.store.BySubject(ctx, a.subject(payload))
+	if err != nil {
+		return err
+	}
+	for key, record := range records {
+		if record.SessionID == sessionID {
+			return a.store.Delete(ctx, key)
+		}
+	}
+	return ErrSessionNotFound
+}
+
+func (a *tokenStoreAuth[T]) RevokeAllForUser(payload T) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	records, err := a.store.BySubject(ctx, a.subject(payload))
+	if err != nil {
+		return err
+	}
+	for key := range records {
+		if err := a.store.Delete(ctx, key); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *tokenStoreAuth[T]) ListSessions(payload T) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	records, err := a.store.BySubject(ctx, a.subject(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(records))
+	for _, record := range records {
+		session := Session{
+			ID:         record.SessionID,
+			IP:         record.IP,
+			UserAgent:  record.UserAgent,
+			CreatedAt:  record.CreatedAt,
+			LastSeenAt: record.LastSeenAt,
+		}
+		if !record.ExpiresAt.IsZero() {
+			expiresAt := record.ExpiresAt
+			session.ExpiresAt = &expiresAt
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (a *tokenStoreAuth[T]) expiry(now time.Time) time.Time {
+	if a.ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(a.ttl)
+}
@@ -0,0 +1,213 @@
+// Package authz holds the project permission matrix and the roles of
+// organization members. Services use it to validate requests and repos to
+// guard the queries that read or change a project, so both layers agree on
+// what each role may do.
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Role is the role of a member in a project
+type Role string
+
+const (
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+	RoleEditor    Role = "editor"
+	RoleCommenter Role = "commenter"
+	RoleViewer    Role = "viewer"
+)
+
+// DefaultRole is given to members added without an explicit role
+const DefaultRole = RoleEditor
+
+// Action is something a member may be allowed to do in a project
+type Action string
+
+const (
+	ViewProject     Action = "project:view"
+	EditProject     Action = "project:edit"
+	DeleteProject   Action = "project:delete"
+	TransferProject Action = "project:transfer"
+	ManageMembers   Action = "members:manage"
+	ShareProject    Action = "project:share"
+	EditTasks       Action = "tasks:edit"
+	CommentTasks    Action = "tasks:comment"
+)
+
+var (
+	ErrNotMember   = errors.New("user is not a member of the project")
+	ErrForbidden   = errors.New("permission denied")
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// rank orders the roles, higher ranks include the permissions of lower ones
+var rank = map[Role]int{
+	RoleViewer:    1,
+	RoleCommenter: 2,
+	RoleEditor:    3,
+	RoleAdmin:     4,
+	RoleOwner:     5,
+}
+
+// permissions is the lowest role allowed to perform each action
+var permissions = map[Action]Role{
+	ViewProject:     RoleViewer,
+	CommentTasks:    RoleCommenter,
+	EditTasks:       RoleEditor,
+	EditProject:     RoleAdmin,
+	ManageMembers:   RoleAdmin,
+	ShareProject:    RoleAdmin,
+	DeleteProject:   RoleOwner,
+	TransferProject: RoleOwner,
+}
+
+// ParseRole validates the name of a role
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := rank[role]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRole, s)
+	}
+	return role, nil
+}
+
+// Can reports whether role may perform action
+func (r Role) Can(action Action) bool {
+	min, ok := permissions[action]
+	return ok && rank[r] >= rank[min]
+}
+
+// Outranks reports whether r is a higher role than other
+func (r Role) Outranks(other Role) bool {
+	return rank[r] > rank[other]
+}
+
+// CanManage reports whether a member with role actor may add, remove or
+// change the role of a member with role target. Only owners manage admins
+// and nobody manages the owner, whose role only changes with the ownership.
+func CanManage(actor, target Role) bool {
+	return actor.Can(ManageMembers) && target != RoleOwner && (actor == RoleOwner || actor.Outranks(target))
+}
+
+// Querier is satisfied by *sql.DB and *sql.Tx
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// MemberRole returns the role of a user in a project that is not deleted.
+// Users may hold a role directly and through any number of teams, the
+// highest of them wins.
+func MemberRole(ctx context.Context, q Querier, userID, projectID int) (Role, error) {
+	query := `
+		SELECT r.role
+		FROM (
+			SELECT pm.role
+			FROM project_members pm
+			WHERE pm.user_id = $1 AND pm.project_id = $2
+			UNION ALL
+			SELECT pt.role
+			FROM project_teams pt
+			JOIN team_members tm ON tm.team_id = pt.team_id
+			WHERE tm.user_id = $1 AND pt.project_id = $2
+		) r
+		JOIN projects p ON p.id = $2 AND p.deleted_at IS NULL
+		ORDER BY CASE r.role
+			WHEN 'owner' THEN 5 WHEN 'admin' THEN 4 WHEN 'editor' THEN 3
+			WHEN 'commenter' THEN 2 ELSE 1 END DESC
+		LIMIT 1
+	`
+	var role Role
+	err := q.QueryRowContext(ctx, query, userID, projectID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("membership check failed: %w", err)
+	}
+	return role, nil
+}
+
+// DirectRole returns the role a user was given in a project in person,
+// ignoring the teams. Members are managed through this role, the roles
+// granted to teams are managed on the teams.
+func DirectRole(ctx context.Context, q Querier, userID, projectID int) (Role, error) {
+	query := `
+		SELECT pm.role
+		FROM project_members pm
+		JOIN projects p ON p.id = pm.project_id
+		WHERE pm.user_id = $1 AND pm.project_id = $2 AND p.deleted_at IS NULL
+	`
+	var role Role
+	err := q.QueryRowContext(ctx, query, userID, projectID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("membership check failed: %w", err)
+	}
+	return role, nil
+}
+
+// Authorize returns the role of a user in a project if it allows action
+func Authorize(ctx context.Context, q Querier, userID, projectID int, action Action) (Role, error) {
+	role, err := MemberRole(ctx, q, userID, projectID)
+	if err != nil {
+		return "", err
+	}
+	if !role.Can(action) {
+		return role, fmt.Errorf("%w: %s cannot %s", ErrForbidden, role, action)
+	}
+	return role, nil
+}
+
+// OrgRole is the role of a member in an organization. Organization roles
+// only govern the organization itself, access to its projects still comes
+// from the project roles.
+type OrgRole string
+
+const (
+	OrgAdmin  OrgRole = "admin"
+	OrgMember OrgRole = "member"
+)
+
+var ErrNotOrgMember = errors.New("user is not a member of the organization")
+
+// ParseOrgRole validates the name of an organization role
+func ParseOrgRole(s string) (OrgRole, error) {
+	role := OrgRole(s)
+	if role != OrgAdmin && role != OrgMember {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRole, s)
+	}
+	return role, nil
+}
+
+// OrgMemberRole returns the role of a user in an organization
+func OrgMemberRole(ctx context.Context, q Querier, userID, orgID int) (OrgRole, error) {
+	query := `SELECT role FROM organization_members WHERE user_id = $1 AND org_id = $2`
+	var role OrgRole
+	err := q.QueryRowContext(ctx, query, userID, orgID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotOrgMember
+	}
+	if err != nil {
+		return "", fmt.Errorf("organization membership check failed: %w", err)
+	}
+	return role, nil
+}
+
+// AuthorizeOrg returns the role of a user in an organization, requiring
+// admin when admin is set
+func AuthorizeOrg(ctx context.Context, q Querier, userID, orgID int, admin bool) (OrgRole, error) {
+	role, err := OrgMemberRole(ctx, q, userID, orgID)
+	if err != nil {
+		return "", err
+	}
+	if admin && role != OrgAdmin {
+		return role, fmt.Errorf("%w: organization %s cannot manage it", ErrForbidden, role)
+	}
+	return role, nil
+}
@@ -4,14 +4,83 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"task-matrix-be/internals/authz"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DB_URI     string
+	DB_URI      string
 	SERVER_PORT string
-	Hash_Secret  string
+	Hash_Secret string
+
+	// AUTH_BACKEND selects the token store: "database" (persistent sessions),
+	// "jwt" (signed access tokens with rotating refresh tokens), "redis"
+	// (sessions shared through REDIS_URL) or "memory"
+	AUTH_BACKEND           string
+	REDIS_URL              string
+	SESSION_TTL            time.Duration
+	SESSION_SWEEP_INTERVAL time.Duration
+
+	// JWT_ALGORITHM is "HS256" (signed with JWT_SECRET) or "EdDSA" (signed
+	// with JWT_ED25519_PRIVATE_KEY, a base64 encoded 32 byte seed or 64 byte key)
+	JWT_ALGORITHM           string
+	JWT_SECRET              string
+	JWT_ED25519_PRIVATE_KEY string
+	JWT_ACCESS_TTL          time.Duration
+	JWT_REFRESH_TTL         time.Duration
+
+	// APP_BASE_URL is the frontend URL that links in emails point to
+	APP_BASE_URL string
+	// MAILER selects how emails are delivered: "log", "file" (appended to
+	// MAIL_FILE_PATH) or "smtp"
+	MAILER         string
+	MAIL_FILE_PATH string
+	MAIL_FROM      string
+	SMTP_HOST      string
+	SMTP_PORT      int
+	SMTP_USERNAME  string
+	SMTP_PASSWORD  string
+
+	PASSWORD_RESET_TTL     time.Duration
+	EMAIL_VERIFICATION_TTL time.Duration
+	// REQUIRE_VERIFIED_EMAIL blocks project and task routes until the user
+	// has verified their email address
+	REQUIRE_VERIFIED_EMAIL bool
+
+	// TOTP_ISSUER is the account issuer shown in authenticator apps
+	TOTP_ISSUER       string
+	MFA_CHALLENGE_TTL time.Duration
+
+	// Failed logins per username: after LOGIN_BACKOFF_AFTER failures each
+	// further attempt is delayed exponentially, and after
+	// LOGIN_LOCKOUT_THRESHOLD failures the username is locked for
+	// LOGIN_LOCKOUT_DURATION
+	LOGIN_BACKOFF_AFTER     int
+	LOGIN_LOCKOUT_THRESHOLD int
+	LOGIN_LOCKOUT_DURATION  time.Duration
+
+	// ADMIN_USERNAMES lists users made administrators at startup, so that
+	// a new installation has someone to open the admin console
+	ADMIN_USERNAMES []string
+
+	// OIDC single sign-on is enabled when OIDC_ISSUER_URL is set.
+	// OIDC_REDIRECT_URL must be registered with the provider and lead to
+	// /auth/oidc/callback, either directly or through the frontend.
+	OIDC_ISSUER_URL    string
+	OIDC_CLIENT_ID     string
+	OIDC_CLIENT_SECRET string
+	OIDC_REDIRECT_URL  string
+	OIDC_SCOPES        []string
+
+	// PREVIOUS_OWNER_ROLE is the role an owner keeps in a project after
+	// transferring it, unless the transfer asks for another one
+	PREVIOUS_OWNER_ROLE authz.Role
+	// INVITATION_TTL is how long project invitations stay valid unless they
+	// set their own expiry
+	INVITATION_TTL time.Duration
 }
 
 var configInstance *Config
@@ -32,6 +101,201 @@ func GetConfig() (*Config, error) {
 			instance.Hash_Secret = val
 		}
 
+		authBackend := "database" // Default value for auth backend
+		if val, err := getStr("AUTH_BACKEND", &authBackend); err == nil {
+			instance.AUTH_BACKEND = val
+		}
+
+		redisURL := "redis://localhost:6379/0" // Default value for redis session store
+		if val, err := getStr("REDIS_URL", &redisURL); err == nil {
+			instance.REDIS_URL = val
+		}
+
+		sessionTTL := 7 * 24 * time.Hour // Default value for session lifetime
+		if val, err := getDuration("SESSION_TTL", &sessionTTL); err == nil {
+			instance.SESSION_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for SESSION_TTL: %w", err)
+		}
+
+		sweepInterval := 10 * time.Minute // Default value for expired session sweeper
+		if val, err := getDuration("SESSION_SWEEP_INTERVAL", &sweepInterval); err == nil {
+			instance.SESSION_SWEEP_INTERVAL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for SESSION_SWEEP_INTERVAL: %w", err)
+		}
+
+		jwtAlgorithm := "HS256" // Default value for JWT signing algorithm
+		if val, err := getStr("JWT_ALGORITHM", &jwtAlgorithm); err == nil {
+			instance.JWT_ALGORITHM = val
+		}
+
+		empty := ""
+		if val, err := getStr("JWT_SECRET", &empty); err == nil {
+			instance.JWT_SECRET = val
+		}
+
+		if val, err := getStr("JWT_ED25519_PRIVATE_KEY", &empty); err == nil {
+			instance.JWT_ED25519_PRIVATE_KEY = val
+		}
+
+		accessTTL := 15 * time.Minute // Default value for JWT access token lifetime
+		if val, err := getDuration("JWT_ACCESS_TTL", &accessTTL); err == nil {
+			instance.JWT_ACCESS_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for JWT_ACCESS_TTL: %w", err)
+		}
+
+		refreshTTL := 30 * 24 * time.Hour // Default value for JWT refresh token lifetime
+		if val, err := getDuration("JWT_REFRESH_TTL", &refreshTTL); err == nil {
+			instance.JWT_REFRESH_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for JWT_REFRESH_TTL: %w", err)
+		}
+
+		appBaseURL := "http://localhost:5173" // Default value for frontend URL
+		if val, err := getStr("APP_BASE_URL", &appBaseURL); err == nil {
+			instance.APP_BASE_URL = val
+		}
+
+		mailerKind := "log" // Default value for mailer
+		if val, err := getStr("MAILER", &mailerKind); err == nil {
+			instance.MAILER = val
+		}
+
+		mailFilePath := "mail.log" // Default value for file mailer output
+		if val, err := getStr("MAIL_FILE_PATH", &mailFilePath); err == nil {
+			instance.MAIL_FILE_PATH = val
+		}
+
+		mailFrom := "Task Matrix <no-reply@localhost>" // Default value for sender address
+		if val, err := getStr("MAIL_FROM", &mailFrom); err == nil {
+			instance.MAIL_FROM = val
+		}
+
+		if val, err := getStr("SMTP_HOST", &empty); err == nil {
+			instance.SMTP_HOST = val
+		}
+
+		smtpPort := 587 // Default value for SMTP submission port
+		if val, err := getInt("SMTP_PORT", &smtpPort); err == nil {
+			instance.SMTP_PORT = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for SMTP_PORT: %w", err)
+		}
+
+		if val, err := getStr("SMTP_USERNAME", &empty); err == nil {
+			instance.SMTP_USERNAME = val
+		}
+
+		if val, err := getStr("SMTP_PASSWORD", &empty); err == nil {
+			instance.SMTP_PASSWORD = val
+		}
+
+		resetTTL := time.Hour // Default value for password reset link lifetime
+		if val, err := getDuration("PASSWORD_RESET_TTL", &resetTTL); err == nil {
+			instance.PASSWORD_RESET_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for PASSWORD_RESET_TTL: %w", err)
+		}
+
+		verificationTTL := 48 * time.Hour // Default value for email verification link lifetime
+		if val, err := getDuration("EMAIL_VERIFICATION_TTL", &verificationTTL); err == nil {
+			instance.EMAIL_VERIFICATION_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for EMAIL_VERIFICATION_TTL: %w", err)
+		}
+
+		requireVerified := false // Default value for email verification enforcement
+		if val, err := getBool("REQUIRE_VERIFIED_EMAIL", &requireVerified); err == nil {
+			instance.REQUIRE_VERIFIED_EMAIL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for REQUIRE_VERIFIED_EMAIL: %w", err)
+		}
+
+		totpIssuer := "Task Matrix" // Default value for TOTP issuer
+		if val, err := getStr("TOTP_ISSUER", &totpIssuer); err == nil {
+			instance.TOTP_ISSUER = val
+		}
+
+		mfaChallengeTTL := 5 * time.Minute // Default value for MFA login challenge lifetime
+		if val, err := getDuration("MFA_CHALLENGE_TTL", &mfaChallengeTTL); err == nil {
+			instance.MFA_CHALLENGE_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for MFA_CHALLENGE_TTL: %w", err)
+		}
+
+		backoffAfter := 3 // Default value for failed logins before backoff
+		if val, err := getInt("LOGIN_BACKOFF_AFTER", &backoffAfter); err == nil {
+			instance.LOGIN_BACKOFF_AFTER = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for LOGIN_BACKOFF_AFTER: %w", err)
+		}
+
+		lockoutThreshold := 10 // Default value for failed logins before lockout
+		if val, err := getInt("LOGIN_LOCKOUT_THRESHOLD", &lockoutThreshold); err == nil {
+			instance.LOGIN_LOCKOUT_THRESHOLD = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for LOGIN_LOCKOUT_THRESHOLD: %w", err)
+		}
+
+		lockoutDuration := 30 * time.Minute // Default value for account lockout
+		if val, err := getDuration("LOGIN_LOCKOUT_DURATION", &lockoutDuration); err == nil {
+			instance.LOGIN_LOCKOUT_DURATION = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for LOGIN_LOCKOUT_DURATION: %w", err)
+		}
+
+		if val, err := getStr("ADMIN_USERNAMES", &empty); err == nil && val != "" {
+			for _, username := range strings.Split(val, ",") {
+				if username = strings.TrimSpace(username); username != "" {
+					instance.ADMIN_USERNAMES = append(instance.ADMIN_USERNAMES, username)
+				}
+			}
+		}
+
+		if val, err := getStr("OIDC_ISSUER_URL", &empty); err == nil {
+			instance.OIDC_ISSUER_URL = strings.TrimSuffix(val, "/")
+		}
+
+		if val, err := getStr("OIDC_CLIENT_ID", &empty); err == nil {
+			instance.OIDC_CLIENT_ID = val
+		}
+
+		if val, err := getStr("OIDC_CLIENT_SECRET", &empty); err == nil {
+			instance.OIDC_CLIENT_SECRET = val
+		}
+
+		oidcRedirectURL := "http://localhost:8080/auth/oidc/callback" // Default value for OIDC redirect URL
+		if val, err := getStr("OIDC_REDIRECT_URL", &oidcRedirectURL); err == nil {
+			instance.OIDC_REDIRECT_URL = val
+		}
+
+		oidcScopes := "openid email profile" // Default value for OIDC scopes
+		if val, err := getStr("OIDC_SCOPES", &oidcScopes); err == nil {
+			instance.OIDC_SCOPES = strings.Fields(val)
+		}
+
+		if instance.OIDC_ISSUER_URL != "" && instance.OIDC_CLIENT_ID == "" {
+			return configInstance, fmt.Errorf("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set")
+		}
+
+		previousOwnerRole := string(authz.RoleAdmin) // Default value for the role of a previous project owner
+		if val, err := getStr("PREVIOUS_OWNER_ROLE", &previousOwnerRole); err == nil {
+			role, err := authz.ParseRole(val)
+			if err != nil || role == authz.RoleOwner {
+				return configInstance, fmt.Errorf("invalid value for PREVIOUS_OWNER_ROLE: %q", val)
+			}
+			instance.PREVIOUS_OWNER_ROLE = role
+		}
+
+		invitationTTL := 7 * 24 * time.Hour // Default value for project invitation lifetime
+		if val, err := getDuration("INVITATION_TTL", &invitationTTL); err == nil {
+			instance.INVITATION_TTL = val
+		} else {
+			return configInstance, fmt.Errorf("invalid value for INVITATION_TTL: %w", err)
+		}
+
 		if val, err := getStr("DB_URI", nil); err == nil {
 			instance.DB_URI = val
 		} else {
@@ -91,4 +355,36 @@ func getInt(key string, fallback *int) (int, error) {
 	}
 
 	return strconv.Atoi(value)
-}
\ No newline at end of file
+}
+
+// getDuration retrieves an environment variable by key and parses it as a
+// time.Duration (e.g. "15m", "168h"); returns fallback if not found.
+// retuns error if missing environment variable and fallback is nil.
+func getDuration(key string, fallback *time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		if fallback == nil {
+			return 0, fmt.Errorf("missing required environment variable: %s", key)
+		} else {
+			return *fallback, nil
+		}
+	}
+
+	return time.ParseDuration(value)
+}
+
+// getBool retrieves an environment variable by key and parses it as a bool
+// ("true", "1", "false", "0", ...); returns fallback if not found.
+// retuns error if missing environment variable and fallback is nil.
+func getBool(key string, fallback *bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		if fallback == nil {
+			return false, fmt.Errorf("missing required environment variable: %s", key)
+		} else {
+			return *fallback, nil
+		}
+	}
+
+	return strconv.ParseBool(value)
+}
@@ -0,0 +1,209 @@
+package dbconnectors
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisError is an error reply sent by the server
+type RedisError string
+
+func (e RedisError) Error() string { return string(e) }
+
+// RedisClient is a minimal client for servers speaking the Redis
+// serialization protocol (RESP2), with a small pool of connections
+type RedisClient struct {
+	addr     string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// GetRedisClient connects to the server at uri, e.g.
+// redis://:password@localhost:6379/0, and pings it
+func GetRedisClient(uri string) (*RedisClient, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis uri: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis uri scheme %q", u.Scheme)
+	}
+
+	c := &RedisClient{addr: u.Host, pool: make(chan *redisConn, 16)}
+	if password, ok := u.User.Password(); ok {
+		c.password = password
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := c.Do(ctx, "PING"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Do sends one command and returns its reply: string for simple strings,
+// int64 for integers, []byte or nil for bulk strings, []any or nil for
+// arrays, and a RedisError for error replies
+func (c *RedisClient) Do(ctx context.Context, args ...string) (any, error) {
+	rc, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		rc.conn.SetDeadline(deadline)
+	} else {
+		rc.conn.SetDeadline(time.Time{})
+	}
+
+	reply, err := rc.do(args)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection state is unknown after an I/O or protocol error
+		rc.conn.Close()
+		return nil, err
+	}
+	c.put(rc)
+	return reply, err
+}
+
+// Close closes every pooled connection
+func (c *RedisClient) Close() error {
+	for {
+		select {
+		case rc := <-c.pool:
+			rc.conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *RedisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case rc := <-c.pool:
+		return rc, nil
+	default:
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial redis: %w", err)
+	}
+	rc := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if c.password != "" {
+		if _, err := rc.do([]string{"AUTH", c.password}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do([]string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("redis select: %w", err)
+		}
+	}
+	return rc, nil
+}
+
+func (c *RedisClient) put(rc *redisConn) {
+	select {
+	case c.pool <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+func (rc *redisConn) do(args []string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(rc.conn, b.String()); err != nil {
+		return nil, fmt.Errorf("write redis command: %w", err)
+	}
+	return rc.readReply()
+}
+
+func (rc *redisConn) readReply() (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read redis reply: %w", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, fmt.Errorf("read redis bulk string: %w", err)
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis array length: %w", err)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			item, err := rc.readReply()
+			var redisErr RedisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = redisErr
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type %q", line[0])
+	}
+}
@@ -0,0 +1,126 @@
+package dbconnectors
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *RedisClient) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	c, err := GetRedisClient("redis://" + srv.Addr())
+	if err != nil {
+		t.Fatalf("GetRedisClient: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return srv, c
+}
+
+func TestRedisClientReplies(t *testing.T) {
+	_, c := newTestRedis(t)
+	ctx := context.Background()
+
+	if reply, err := c.Do(ctx, "SET", "k", "v"); err != nil || reply != "OK" {
+		t.Fatalf("SET = %v, %v; want OK", reply, err)
+	}
+	reply, err := c.Do(ctx, "GET", "k")
+	if b, ok := reply.([]byte); err != nil || !ok || string(b) != "v" {
+		t.Fatalf("GET = %v, %v; want v", reply, err)
+	}
+	if reply, err := c.Do(ctx, "GET", "missing"); err != nil || reply != nil {
+		t.Fatalf("GET missing = %v, %v; want nil", reply, err)
+	}
+	if reply, err := c.Do(ctx, "SADD", "s", "a", "b"); err != nil || reply != int64(2) {
+		t.Fatalf("SADD = %v, %v; want 2", reply, err)
+	}
+	reply, err = c.Do(ctx, "SMEMBERS", "s")
+	if items, ok := reply.([]any); err != nil || !ok || len(items) != 2 {
+		t.Fatalf("SMEMBERS = %v, %v; want two members", reply, err)
+	}
+}
+
+func TestRedisClientKeyExpiry(t *testing.T) {
+	srv, c := newTestRedis(t)
+	ctx := context.Background()
+
+	if _, err := c.Do(ctx, "SET", "k", "v", "PX", "1000"); err != nil {
+		t.Fatalf("SET PX: %v", err)
+	}
+	if reply, err := c.Do(ctx, "PTTL", "k"); err != nil || reply.(int64) <= 0 {
+		t.Fatalf("PTTL = %v, %v; want a positive TTL", reply, err)
+	}
+	srv.FastForward(1001 * time.Millisecond)
+	if reply, err := c.Do(ctx, "GET", "k"); err != nil || reply != nil {
+		t.Fatalf("GET after expiry = %v, %v; want nil", reply, err)
+	}
+}
+
+func TestRedisClientReusesConnectionAfterErrorReply(t *testing.T) {
+	srv, c := newTestRedis(t)
+	ctx := context.Background()
+	dialed := srv.TotalConnectionCount()
+
+	_, err := c.Do(ctx, "NOSUCHCOMMAND")
+	var redisErr RedisError
+	if !errors.As(err, &redisErr) {
+		t.Fatalf("unknown command error = %v; want a RedisError", err)
+	}
+
+	srv.SetError("LOADING server is loading")
+	if _, err := c.Do(ctx, "GET", "k"); !errors.As(err, &redisErr) {
+		t.Fatalf("GET while failing = %v; want a RedisError", err)
+	}
+	srv.SetError("")
+
+	if _, err := c.Do(ctx, "SET", "k", "v"); err != nil {
+		t.Fatalf("SET after error reply: %v", err)
+	}
+	if got := srv.TotalConnectionCount(); got != dialed {
+		t.Fatalf("dialed %d connections after error replies; want the pooled one reused", got-dialed)
+	}
+}
+
+func TestRedisClientRedialsAfterConnectionLoss(t *testing.T) {
+	srv, c := newTestRedis(t)
+	ctx := context.Background()
+
+	srv.Close()
+	if _, err := c.Do(ctx, "PING"); err == nil {
+		t.Fatal("PING on a stopped server succeeded")
+	}
+	if err := srv.Restart(); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+
+	// The broken connection was dropped, so the next command dials again
+	if reply, err := c.Do(ctx, "PING"); err != nil || reply != "PONG" {
+		t.Fatalf("PING after restart = %v, %v; want PONG", reply, err)
+	}
+}
+
+func TestRedisClientAuthAndSelect(t *testing.T) {
+	srv := miniredis.RunT(t)
+	srv.RequireAuth("secret")
+
+	if _, err := GetRedisClient("redis://" + srv.Addr()); err == nil {
+		t.Fatal("GetRedisClient without a password succeeded")
+	}
+
+	c, err := GetRedisClient("redis://:secret@" + srv.Addr() + "/2")
+	if err != nil {
+		t.Fatalf("GetRedisClient: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.Do(context.Background(), "SET", "k", "v"); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	srv.Select(2)
+	if got, err := srv.Get("k"); err != nil || got != "v" {
+		t.Fatalf("key in database 2 = %q, %v; want v", got, err)
+	}
+}
@@ -2,16 +2,29 @@ package middlewares
 
 import (
 	"context"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
 	"task-matrix-be/internals/models"
 )
 
 type contextKey string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey   = contextKey("user")
+	TokenContextKey  = contextKey("token")
+	APIKeyContextKey = contextKey("api_key")
+)
+
+// APIKeyValidator resolves a personal API key to its owner and the key itself
+type APIKeyValidator func(ctx context.Context, key string) (models.User, models.APIKey, error)
 
-func AuthMiddleware(validator func(token string) (models.User, error)) func(http.Handler) http.Handler {
+// AuthMiddleware authenticates "Bearer <token>" headers with validator and,
+// when apiKeyValidator is not nil, "ApiKey <key>" headers with it. Requests
+// made with an API key carry the key under APIKeyContextKey instead of a
+// token under TokenContextKey.
+func AuthMiddleware(validator func(token string) (models.User, error), apiKeyValidator APIKeyValidator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -20,26 +33,109 @@ func AuthMiddleware(validator func(token string) (models.User, error)) func(http
 				return
 			}
 
-			// Expect header in form "Bearer <token>"
+			// Expect header in form "Bearer <token>" or "ApiKey <key>"
 			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+			if len(parts) != 2 {
 				http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
 				return
 			}
+			scheme := strings.ToLower(parts[0])
 			token := strings.TrimSpace(parts[1])
 			if token == "" {
 				http.Error(w, "Empty token", http.StatusUnauthorized)
 				return
 			}
 
-			user, err := validator(token)
+			switch {
+			case scheme == "bearer":
+				user, err := validator(token)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserContextKey, user)
+				ctx = context.WithValue(ctx, TokenContextKey, token)
+				next.ServeHTTP(w, r.WithContext(ctx))
+
+			case scheme == "apikey" && apiKeyValidator != nil:
+				user, key, err := apiKeyValidator(r.Context(), token)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+
+				if !isSafeMethod(r.Method) && slices.Equal(key.Scopes, []string{models.ScopeReadOnly}) {
+					http.Error(w, "Forbidden: API key is read-only", http.StatusForbidden)
+					return
+				}
+
+				ctx := context.WithValue(r.Context(), UserContextKey, user)
+				ctx = context.WithValue(ctx, APIKeyContextKey, key)
+				next.ServeHTTP(w, r.WithContext(ctx))
+
+			default:
+				http.Error(w, "Invalid Authorization header format", http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// RequireScope rejects requests made with an API key that was granted none
+// of scopes. Requests authenticated with a token have every scope.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := r.Context().Value(APIKeyContextKey).(models.APIKey)
+			if ok && !slices.ContainsFunc(scopes, func(scope string) bool { return slices.Contains(key.Scopes, scope) }) {
+				http.Error(w, "Forbidden: API key lacks scope "+strings.Join(scopes, " or "), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RejectAPIKeys rejects requests made with an API key, for account
+// management routes that must not be reachable by scripts
+func RejectAPIKeys(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(APIKeyContextKey).(models.APIKey); ok {
+			http.Error(w, "Forbidden: not available with an API key", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin rejects users that isAdmin does not report as administrators
+// of the installation. It must be mounted after AuthMiddleware.
+func RequireAdmin(isAdmin func(ctx context.Context, userID int) (bool, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := r.Context().Value(UserContextKey).(models.User)
+			if !ok {
+				http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+				return
+			}
+
+			admin, err := isAdmin(r.Context(), user.ID)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+				log.Printf("[ERROR] [RequireAdmin] Failed to check administrator user ID %d: %v", user.ID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !admin {
+				log.Printf("[WARN] [RequireAdmin] User ID %d is not an administrator", user.ID)
+				http.Error(w, "Forbidden: administrator access required", http.StatusForbidden)
 				return
 			}
 
-			ctx := context.WithValue(r.Context(), UserContextKey, user)
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r)
 		})
 	}
 }
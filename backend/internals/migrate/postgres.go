@@ -61,6 +61,270 @@ func MigratePostgres(ctx context.Context, db *sql.DB) error {
 			status_id INTEGER NOT NULL REFERENCES statuses(id)
 		);
 
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			token_hash TEXT NOT NULL UNIQUE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+		CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+		CREATE TABLE IF NOT EXISTS refresh_sessions (
+			id TEXT PRIMARY KEY,
+			subject TEXT NOT NULL,
+			jti TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_refresh_sessions_subject ON refresh_sessions(subject);
+		CREATE INDEX IF NOT EXISTS idx_refresh_sessions_expires_at ON refresh_sessions(expires_at);
+
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+		ALTER TABLE sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+		ALTER TABLE refresh_sessions ADD COLUMN IF NOT EXISTS ip TEXT NOT NULL DEFAULT '';
+		ALTER TABLE refresh_sessions ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+		CREATE TABLE IF NOT EXISTS user_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			purpose TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ NOT NULL,
+			used_at TIMESTAMPTZ
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id);
+
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMPTZ,
+			UNIQUE (user_id, code_hash)
+		);
+
+		CREATE TABLE IF NOT EXISTS login_throttles (
+			username TEXT PRIMARY KEY,
+			failed_count INTEGER NOT NULL DEFAULT 0,
+			last_failed_at TIMESTAMPTZ NOT NULL,
+			locked_until TIMESTAMPTZ
+		);
+
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			id SERIAL PRIMARY KEY,
+			username TEXT NOT NULL,
+			user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			success BOOLEAN NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, created_at);
+
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(20) NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ,
+			last_used_at TIMESTAMPTZ
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+		CREATE TABLE IF NOT EXISTS oidc_states (
+			state_hash TEXT PRIMARY KEY,
+			nonce TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			expires_at TIMESTAMPTZ NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id SERIAL PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at TIMESTAMPTZ,
+			UNIQUE (issuer, subject)
+		);
+
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+		ALTER TABLE project_members ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'editor'
+			CHECK (role IN ('owner', 'admin', 'editor', 'commenter', 'viewer'));
+		UPDATE project_members SET role = 'owner'
+		WHERE role <> 'owner' AND EXISTS (
+			SELECT 1 FROM projects p
+			WHERE p.id = project_members.project_id AND p.owner_id = project_members.user_id
+		);
+
+		CREATE TABLE IF NOT EXISTS project_audit_log (
+			id SERIAL PRIMARY KEY,
+			project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+			actor_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			action TEXT NOT NULL,
+			target_user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			details TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_project_audit_log_project ON project_audit_log (project_id, created_at);
+
+		CREATE TABLE IF NOT EXISTS project_invitations (
+			id SERIAL PRIMARY KEY,
+			project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+			inviter_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			email TEXT,
+			role TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ NOT NULL,
+			responded_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_project_invitations_email ON project_invitations (LOWER(email)) WHERE status = 'pending';
+		-- Set when a user is invited by username, their address stays hidden
+		ALTER TABLE project_invitations ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+
+		CREATE TABLE IF NOT EXISTS organizations (
+			id SERIAL PRIMARY KEY,
+			name TEXT NOT NULL,
+			personal_owner_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+			default_role TEXT NOT NULL DEFAULT 'editor'
+				CHECK (default_role IN ('admin', 'editor', 'commenter', 'viewer')),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS organization_members (
+			org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member')),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (org_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_organization_members_user ON organization_members (user_id);
+
+		-- Users join an organization by accepting an invitation
+		CREATE TABLE IF NOT EXISTS organization_invitations (
+			id SERIAL PRIMARY KEY,
+			org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			inviter_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK (role IN ('admin', 'member')),
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ NOT NULL,
+			responded_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_organization_invitations_user ON organization_invitations (user_id) WHERE status = 'pending';
+
+		ALTER TABLE projects ADD COLUMN IF NOT EXISTS org_id INTEGER REFERENCES organizations(id);
+		CREATE INDEX IF NOT EXISTS idx_projects_org ON projects (org_id);
+
+		-- Every user gets a personal organization holding the projects they own
+		INSERT INTO organizations (name, personal_owner_id)
+		SELECT u.name || '''s workspace', u.id FROM users u
+		ON CONFLICT (personal_owner_id) DO NOTHING;
+		INSERT INTO organization_members (org_id, user_id, role)
+		SELECT o.id, o.personal_owner_id, 'admin' FROM organizations o
+		WHERE o.personal_owner_id IS NOT NULL
+		ON CONFLICT DO NOTHING;
+		UPDATE projects SET org_id = (
+			SELECT o.id FROM organizations o WHERE o.personal_owner_id = projects.owner_id
+		)
+		WHERE org_id IS NULL;
+
+		CREATE TABLE IF NOT EXISTS teams (
+			id SERIAL PRIMARY KEY,
+			org_id INTEGER NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			lead_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_teams_org ON teams (org_id);
+
+		CREATE TABLE IF NOT EXISTS team_members (
+			team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+			user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			PRIMARY KEY (team_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_team_members_user ON team_members (user_id);
+
+		CREATE TABLE IF NOT EXISTS project_teams (
+			project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+			team_id INTEGER NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+			role TEXT NOT NULL CHECK (role IN ('admin', 'editor', 'commenter', 'viewer')),
+			PRIMARY KEY (project_id, team_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_project_teams_team ON project_teams (team_id);
+
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
+
+		CREATE TABLE IF NOT EXISTS project_share_links (
+			id SERIAL PRIMARY KEY,
+			project_id INTEGER NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+			slug TEXT NOT NULL UNIQUE,
+			password_hash TEXT,
+			created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMPTZ
+		);
+		CREATE INDEX IF NOT EXISTS idx_project_share_links_project ON project_share_links (project_id);
+
+		-- Tasks completed before completed_at existed keep it empty
+		ALTER TABLE tasks ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ;
+		CREATE INDEX IF NOT EXISTS idx_tasks_assignee ON tasks (assignee_id);
+
+		ALTER TABLE tasks ADD COLUMN IF NOT EXISTS start_date DATE;
+		ALTER TABLE tasks ADD COLUMN IF NOT EXISTS due_date DATE;
+		ALTER TABLE tasks ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+		UPDATE tasks SET updated_at = created_at WHERE updated_at IS NULL;
+
+		-- Deleting a task deletes its subtasks
+		ALTER TABLE tasks ADD COLUMN IF NOT EXISTS parent_task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE;
+		CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks (parent_task_id);
+
+		CREATE TABLE IF NOT EXISTS task_checklist_items (
+			id SERIAL PRIMARY KEY,
+			task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			title TEXT NOT NULL,
+			done BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_task_checklist_items_task ON task_checklist_items (task_id);
+
+		-- blocker_task_id blocks blocked_task_id, both in the same project
+		CREATE TABLE IF NOT EXISTS task_dependencies (
+			blocker_task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			blocked_task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (blocker_task_id, blocked_task_id),
+			CHECK (blocker_task_id <> blocked_task_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocked ON task_dependencies (blocked_task_id);
+
 		-- ===============================
 		-- 🔢 STATIC DATA (STATUSES / PRIORITIES)
 		-- ===============================
@@ -3,6 +3,7 @@ package migrate
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"time"
 )
 
@@ -64,6 +65,253 @@ func MigrateSQLite(ctx context.Context, db *sql.DB) error {
 			FOREIGN KEY (project_id) REFERENCES projects(id),
 			FOREIGN KEY (status_id) REFERENCES statuses(id)
 		);
+
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			token_hash TEXT NOT NULL UNIQUE,
+			user_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+		CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+		CREATE TABLE IF NOT EXISTS refresh_sessions (
+			id TEXT PRIMARY KEY,
+			subject TEXT NOT NULL,
+			jti TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_used_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_refresh_sessions_subject ON refresh_sessions(subject);
+		CREATE INDEX IF NOT EXISTS idx_refresh_sessions_expires_at ON refresh_sessions(expires_at);
+
+		CREATE TABLE IF NOT EXISTS user_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			purpose TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id);
+
+		CREATE TABLE IF NOT EXISTS user_recovery_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at DATETIME,
+			UNIQUE (user_id, code_hash),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS login_throttles (
+			username TEXT PRIMARY KEY,
+			failed_count INTEGER NOT NULL DEFAULT 0,
+			last_failed_at DATETIME NOT NULL,
+			locked_until DATETIME
+		);
+
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			user_id INTEGER,
+			ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			success BOOLEAN NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts(username, created_at);
+
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			prefix VARCHAR(20) NOT NULL,
+			key_hash TEXT NOT NULL UNIQUE,
+			scopes TEXT NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME,
+			last_used_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+		CREATE TABLE IF NOT EXISTS oidc_states (
+			state_hash TEXT PRIMARY KEY,
+			nonce TEXT NOT NULL,
+			code_verifier TEXT NOT NULL,
+			expires_at DATETIME NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS user_identities (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_login_at DATETIME,
+			UNIQUE (issuer, subject),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS project_audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			project_id INTEGER NOT NULL,
+			actor_id INTEGER,
+			action TEXT NOT NULL,
+			target_user_id INTEGER,
+			details TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (target_user_id) REFERENCES users(id) ON DELETE SET NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_project_audit_log_project ON project_audit_log(project_id, created_at);
+
+		CREATE TABLE IF NOT EXISTS project_invitations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			project_id INTEGER NOT NULL,
+			inviter_id INTEGER,
+			email TEXT,
+			role TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			responded_at DATETIME,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (inviter_id) REFERENCES users(id) ON DELETE SET NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_project_invitations_email ON project_invitations(email);
+
+		CREATE TABLE IF NOT EXISTS organizations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			personal_owner_id INTEGER UNIQUE,
+			default_role TEXT NOT NULL DEFAULT 'editor'
+				CHECK (default_role IN ('admin', 'editor', 'commenter', 'viewer')),
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (personal_owner_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE TABLE IF NOT EXISTS organization_members (
+			org_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member')),
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (org_id, user_id),
+			FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_organization_members_user ON organization_members(user_id);
+
+		-- Users join an organization by accepting an invitation
+		CREATE TABLE IF NOT EXISTS organization_invitations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id INTEGER NOT NULL,
+			inviter_id INTEGER,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL CHECK (role IN ('admin', 'member')),
+			status TEXT NOT NULL DEFAULT 'pending',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			responded_at DATETIME,
+			FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (inviter_id) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_organization_invitations_user ON organization_invitations(user_id);
+
+		CREATE TABLE IF NOT EXISTS teams (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			org_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			lead_id INTEGER,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (org_id) REFERENCES organizations(id) ON DELETE CASCADE,
+			FOREIGN KEY (lead_id) REFERENCES users(id) ON DELETE SET NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_teams_org ON teams(org_id);
+
+		CREATE TABLE IF NOT EXISTS team_members (
+			team_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			PRIMARY KEY (team_id, user_id),
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_team_members_user ON team_members(user_id);
+
+		CREATE TABLE IF NOT EXISTS project_teams (
+			project_id INTEGER NOT NULL,
+			team_id INTEGER NOT NULL,
+			role TEXT NOT NULL CHECK (role IN ('admin', 'editor', 'commenter', 'viewer')),
+			PRIMARY KEY (project_id, team_id),
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (team_id) REFERENCES teams(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_project_teams_team ON project_teams(team_id);
+
+		CREATE TABLE IF NOT EXISTS project_share_links (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			project_id INTEGER NOT NULL,
+			slug TEXT NOT NULL UNIQUE,
+			password_hash TEXT,
+			created_by INTEGER,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME,
+			FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+			FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_project_share_links_project ON project_share_links(project_id);
+
+		CREATE INDEX IF NOT EXISTS idx_tasks_assignee ON tasks(assignee_id);
+
+		CREATE TABLE IF NOT EXISTS task_checklist_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			done BOOLEAN NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_task_checklist_items_task ON task_checklist_items(task_id);
+
+		-- blocker_task_id blocks blocked_task_id, both in the same project
+		CREATE TABLE IF NOT EXISTS task_dependencies (
+			blocker_task_id INTEGER NOT NULL,
+			blocked_task_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (blocker_task_id, blocked_task_id),
+			CHECK (blocker_task_id <> blocked_task_id),
+			FOREIGN KEY (blocker_task_id) REFERENCES tasks(id) ON DELETE CASCADE,
+			FOREIGN KEY (blocked_task_id) REFERENCES tasks(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_task_dependencies_blocked ON task_dependencies(blocked_task_id);
 			
 		-- Populate DB
 		
@@ -207,8 +455,96 @@ func MigrateSQLite(ctx context.Context, db *sql.DB) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
 	defer cancel()
 
-	_, err := db.ExecContext(ctx, query)
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return err
+	}
+
+	if err := addMissingSQLiteColumns(ctx, db); err != nil {
+		return err
+	}
 
+	_, err := db.ExecContext(ctx, sqliteBackfillQuery)
 	return err
+}
+
+// sqliteBackfillQuery fills the columns added by addMissingSQLiteColumns,
+// it has to be safe to run on every start
+const sqliteBackfillQuery = `
+	UPDATE project_members SET role = 'owner'
+	WHERE role <> 'owner' AND EXISTS (
+		SELECT 1 FROM projects p
+		WHERE p.id = project_members.project_id AND p.owner_id = project_members.user_id
+	);
+
+	-- Every user gets a personal organization holding the projects they own
+	INSERT INTO organizations (name, personal_owner_id)
+	SELECT u.name || '''s workspace', u.id FROM users u
+	WHERE true
+	ON CONFLICT (personal_owner_id) DO NOTHING;
+	INSERT INTO organization_members (org_id, user_id, role)
+	SELECT o.id, o.personal_owner_id, 'admin' FROM organizations o
+	WHERE o.personal_owner_id IS NOT NULL
+	ON CONFLICT DO NOTHING;
+	UPDATE projects SET org_id = (
+		SELECT o.id FROM organizations o WHERE o.personal_owner_id = projects.owner_id
+	)
+	WHERE org_id IS NULL;
+
+	CREATE INDEX IF NOT EXISTS idx_projects_org ON projects(org_id);
+
+	UPDATE tasks SET updated_at = created_at WHERE updated_at IS NULL;
+
+	CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks(parent_task_id);
+`
+
+// sqliteAddedColumns lists columns added to tables after they were first
+// created. SQLite has no ADD COLUMN IF NOT EXISTS, so each one is checked
+// against pragma_table_info before being added.
+var sqliteAddedColumns = []struct {
+	table, column, definition string
+}{
+	{"sessions", "ip", "TEXT NOT NULL DEFAULT ''"},
+	{"sessions", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+	{"refresh_sessions", "ip", "TEXT NOT NULL DEFAULT ''"},
+	{"refresh_sessions", "user_agent", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "email_verified_at", "DATETIME"},
+	{"users", "totp_secret", "TEXT"},
+	{"users", "totp_enabled", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"users", "totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "pending_email", "TEXT"},
+	{"users", "deleted_at", "DATETIME"},
+	{"project_members", "role", "TEXT NOT NULL DEFAULT 'editor' CHECK (role IN ('owner', 'admin', 'editor', 'commenter', 'viewer'))"},
+	{"projects", "org_id", "INTEGER REFERENCES organizations(id)"},
+	{"users", "is_admin", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"users", "disabled_at", "DATETIME"},
+	{"users", "password_reset_required", "BOOLEAN NOT NULL DEFAULT 0"},
+	{"tasks", "completed_at", "DATETIME"},
+	{"tasks", "start_date", "DATE"},
+	{"tasks", "due_date", "DATE"},
+	{"tasks", "updated_at", "DATETIME"},
+	// Deleting a task deletes its subtasks
+	{"tasks", "parent_task_id", "INTEGER REFERENCES tasks(id) ON DELETE CASCADE"},
+	// Set when a user is invited by username, their address stays hidden
+	{"project_invitations", "user_id", "INTEGER REFERENCES users(id) ON DELETE CASCADE"},
+}
 
+func addMissingSQLiteColumns(ctx context.Context, db *sql.DB) error {
+	for _, c := range sqliteAddedColumns {
+		var exists bool
+		err := db.QueryRowContext(ctx,
+			`SELECT COUNT(*) > 0 FROM pragma_table_info($1) WHERE name = $2`, c.table, c.column,
+		).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("inspect %s.%s: %w", c.table, c.column, err)
+		}
+		if exists {
+			continue
+		}
+
+		_, err = db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, c.table, c.column, c.definition))
+		if err != nil {
+			return fmt.Errorf("add column %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
 }
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type User struct {
 	ID        int    `json:"id"`
 	Name      string `json:"name"`
@@ -8,6 +10,77 @@ type User struct {
 	AvatarUrl string `json:"avatar_url"`
 }
 
+// UserProfile is the account of the logged-in user as shown on /me
+type UserProfile struct {
+	User
+	EmailVerified bool    `json:"email_verified"`
+	PendingEmail  *string `json:"pending_email"`
+	MFAEnabled    bool    `json:"mfa_enabled"`
+	IsAdmin       bool    `json:"is_admin"`
+}
+
+// AccountStatus tells whether a user may log in
+type AccountStatus struct {
+	Disabled              bool
+	PasswordResetRequired bool
+}
+
+// AdminUser is a user as listed in the admin console
+type AdminUser struct {
+	User
+	IsAdmin               bool       `json:"is_admin"`
+	EmailVerified         bool       `json:"email_verified"`
+	MFAEnabled            bool       `json:"mfa_enabled"`
+	PasswordResetRequired bool       `json:"password_reset_required"`
+	DisabledAt            *time.Time `json:"disabled_at"`
+	DeletedAt             *time.Time `json:"deleted_at"`
+}
+
+// AdminProject is a project as listed in the admin console, deleted ones
+// included
+type AdminProject struct {
+	ID          int        `json:"id"`
+	OrgID       int        `json:"org_id"`
+	Name        string     `json:"name"`
+	Status      Status     `json:"status"`
+	Owner       User       `json:"owner"`
+	MemberCount int        `json:"member_count"`
+	TotalTasks  int        `json:"total_tasks"`
+	CreatedAt   *time.Time `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at"`
+}
+
+type UserStats struct {
+	Total int `json:"total"`
+	// Active users logged in during the last 30 days
+	Active     int `json:"active"`
+	Admins     int `json:"admins"`
+	Disabled   int `json:"disabled"`
+	Deleted    int `json:"deleted"`
+	Unverified int `json:"unverified"`
+}
+
+type ProjectStats struct {
+	Total   int `json:"total"`
+	Deleted int `json:"deleted"`
+}
+
+type TaskStats struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+}
+
+// SystemStats sums up the whole installation for the admin console
+type SystemStats struct {
+	Users         UserStats    `json:"users"`
+	Projects      ProjectStats `json:"projects"`
+	Tasks         TaskStats    `json:"tasks"`
+	Organizations int          `json:"organizations"`
+	Teams         int          `json:"teams"`
+	// ActiveSessions is nil when sessions are not kept in the database
+	ActiveSessions *int `json:"active_sessions"`
+}
+
 type Status struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
@@ -18,34 +91,382 @@ type Priority struct {
 	Name string `json:"name"`
 }
 
+// ProjectMember is a user together with their role in a project, one of
+// the roles of the authz package
+type ProjectMember struct {
+	User
+	Role string `json:"role"`
+}
+
 type Project struct {
-	ID             int    `json:"id"`
-	Name           string `json:"name"`
-	Description    string `json:"description"`
-	DueDate        string `json:"due_date"`
-	Status         Status `json:"status"`
-	Owner          User   `json:"owner"`
-	Members        []User `json:"members"`
-	TasksCompleted int    `json:"tasks_completed"`
-	TotalTasks     int    `json:"total_tasks"`
+	ID             int             `json:"id"`
+	OrgID          int             `json:"org_id"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description"`
+	DueDate        string          `json:"due_date"`
+	Status         Status          `json:"status"`
+	Owner          User            `json:"owner"`
+	Members        []ProjectMember `json:"members"`
+	TasksCompleted int             `json:"tasks_completed"`
+	TotalTasks     int             `json:"total_tasks"`
 }
 
 type Task struct {
-	ID          int      `json:"id"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Priority    Priority `json:"priority"`
-	Status      Status   `json:"status"`
-	Assignee    User     `json:"assignee"`
+	ID          int        `json:"id"`
+	ProjectID   int        `json:"project_id"`
+	ProjectName string     `json:"project_name"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Priority    Priority   `json:"priority"`
+	Status      Status     `json:"status"`
+	Assignee    User       `json:"assignee"`
+	StartDate   *string    `json:"start_date"` // YYYY-MM-DD
+	DueDate     *string    `json:"due_date"`   // YYYY-MM-DD
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	// CompletedAt is set while the task is in the Completed status
+	CompletedAt *time.Time `json:"completed_at"`
+	// Overdue tasks are not completed and were due before today, in UTC
+	Overdue bool `json:"overdue"`
+	// ParentTaskID is set on subtasks
+	ParentTaskID *int `json:"parent_task_id"`
+	// Subtasks counts the direct subtasks, done being the completed ones
+	Subtasks  Progress `json:"subtasks"`
+	Checklist Progress `json:"checklist"`
+}
+
+// Progress is how many of the subtasks or checklist items of a task are done
+type Progress struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+// DependencyGraph is how the tasks of a project block each other, its nodes
+// being the tasks with at least one dependency
+type DependencyGraph struct {
+	ProjectID   int              `json:"project_id"`
+	ProjectName string           `json:"project_name"`
+	Nodes       []DependencyNode `json:"nodes"`
+	Edges       []DependencyEdge `json:"edges"`
+}
+
+type DependencyNode struct {
+	ID     int    `json:"id"`
+	Title  string `json:"title"`
+	Status Status `json:"status"`
+	// Completed tasks are in the Completed status, blocked ones are not and
+	// wait on a blocker that is not either
+	Completed bool `json:"completed"`
+	Blocked   bool `json:"blocked"`
+}
+
+// DependencyEdge goes from a task to a task it blocks
+type DependencyEdge struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type ChecklistItem struct {
+	ID        int        `json:"id"`
+	TaskID    int        `json:"task_id"`
+	Title     string     `json:"title"`
+	Done      bool       `json:"done"`
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// Orders of task listings. Priorities and statuses sort by ID, which follows
+// their severity and the workflow.
+const (
+	TaskSortCreated  = "created"
+	TaskSortPriority = "priority"
+	TaskSortStatus   = "status"
+	TaskSortTitle    = "title"
+	TaskSortProject  = "project"
+	TaskSortDue      = "due"
+)
+
+// TaskFilter narrows down and orders a task listing, zero values leave a
+// criterion out
+type TaskFilter struct {
+	StatusIDs   []int
+	PriorityIDs []int
+	AssigneeIDs []int
+	// Text matches title or description
+	Text        string
+	CreatedFrom *time.Time
+	// CreatedTo is exclusive
+	CreatedTo *time.Time
+	// DueFrom and DueTo are inclusive YYYY-MM-DD dates
+	DueFrom string
+	DueTo   string
+	Overdue bool
+	// CompletedSince keeps the tasks completed since then
+	CompletedSince *time.Time
+	// ParentID keeps the subtasks of a task, TopLevel the tasks that are
+	// not subtasks
+	ParentID int
+	TopLevel bool
+	// GroupBy orders by one of the sort keys before Sort
+	GroupBy string
+	Sort    string
+	Desc    bool
+	Limit   int
+	// After continues a listing after the last task of the previous page
+	After *TaskCursor
+}
+
+// TaskCursor is the position of a task in a listing, its values of the keys
+// the listing is ordered by and its ID
+type TaskCursor struct {
+	Values []string `json:"v,omitempty"`
+	ID     int      `json:"id"`
+}
+
+// TaskGroup is a run of tasks sharing a priority, status or project
+type TaskGroup struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Tasks []Task `json:"tasks"`
 }
 
 type ProjectDetail struct {
+	ID          int             `json:"id"`
+	OrgID       int             `json:"org_id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	DueDate     string          `json:"due_date"`
+	Status      Status          `json:"status"`
+	Owner       User            `json:"owner"`
+	Members     []ProjectMember `json:"members"`
+	Teams       []ProjectTeam   `json:"teams"`
+	Tasks       []Task          `json:"tasks"`
+}
+
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	UserID    *int      `json:"user_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Scopes that can be granted to an API key
+const (
+	ScopeReadOnly      = "read-only"
+	ScopeTasksWrite    = "tasks:write"
+	ScopeProjectsAdmin = "projects:admin"
+)
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// Actions recorded in the audit log of a project
+const (
+	AuditOwnershipTransferred = "ownership_transferred"
+	AuditMemberJoined         = "member_joined"
+	AuditTeamGranted          = "team_granted"
+	AuditTeamRevoked          = "team_revoked"
+	AuditShareLinkCreated     = "share_link_created"
+	AuditShareLinkRevoked     = "share_link_revoked"
+)
+
+// Organization groups projects and their people. Every user has a personal
+// organization, which new projects go to unless another one is selected.
+type Organization struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Personal bool   `json:"personal"`
+	// DefaultRole is the project role of members added without one
+	DefaultRole string    `json:"default_role"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Role is the role of the current user in the organization
+	Role string `json:"role"`
+}
+
+type OrganizationMember struct {
+	User
+	Role string `json:"role"`
+}
+
+type OrganizationDetail struct {
+	Organization
+	Members []OrganizationMember `json:"members"`
+}
+
+// OrgInvitation asks an existing user to join an organization, they become
+// a member once they accept it
+type OrgInvitation struct {
 	ID          int    `json:"id"`
+	OrgID       int    `json:"org_id"`
+	OrgName     string `json:"org_name"`
+	InviterID   *int   `json:"inviter_id"`
+	InviterName string `json:"inviter_name"`
+	UserID      int    `json:"user_id"`
+	Username    string `json:"username"`
 	Name        string `json:"name"`
-	Description string `json:"description"`
-	DueDate     string `json:"due_date"`
-	Status      Status `json:"status"`
-	Owner       User   `json:"owner"`
-	Members     []User `json:"members"`
-	Tasks       []Task `json:"tasks"`
+	// Email is where the invitation is sent, it is not shown to the
+	// organization before the user joins
+	Email       string     `json:"-"`
+	Role        string     `json:"role"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RespondedAt *time.Time `json:"responded_at"`
+}
+
+// Team is a group of members of an organization that can be given a role
+// on the projects of the organization as a unit
+type Team struct {
+	ID          int       `json:"id"`
+	OrgID       int       `json:"org_id"`
+	Name        string    `json:"name"`
+	Lead        *User     `json:"lead"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TeamProject is a project a team was granted a role on
+type TeamProject struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type TeamDetail struct {
+	Team
+	Members  []User        `json:"members"`
+	Projects []TeamProject `json:"projects"`
+}
+
+// ProjectTeam is a team together with its role in a project
+type ProjectTeam struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	MemberCount int    `json:"member_count"`
+	Role        string `json:"role"`
+}
+
+// Statuses of a project invitation
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+// ProjectInvitation invites an email address, or whoever has the link when
+// Email is nil, to join a project
+type ProjectInvitation struct {
+	ID          int     `json:"id"`
+	ProjectID   int     `json:"project_id"`
+	ProjectName string  `json:"project_name"`
+	InviterID   *int    `json:"inviter_id"`
+	InviterName string  `json:"inviter_name"`
+	Email       *string `json:"email"`
+	// Username is set when a user was invited by username, the project
+	// does not see their email address before they join
+	Username    *string    `json:"username"`
+	Role        string     `json:"role"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	RespondedAt *time.Time `json:"responded_at"`
+}
+
+type ProjectAuditEntry struct {
+	ID           int       `json:"id"`
+	ProjectID    int       `json:"project_id"`
+	ActorID      *int      `json:"actor_id"`
+	Action       string    `json:"action"`
+	TargetUserID *int      `json:"target_user_id"`
+	Details      string    `json:"details"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AssignedTask is a task together with the project it belongs to
+type AssignedTask struct {
+	Task
+	ProjectID   int    `json:"project_id"`
+	ProjectName string `json:"project_name"`
+}
+
+// AccountExport bundles the data held about a user for download
+type AccountExport struct {
+	ExportedAt    time.Time       `json:"exported_at"`
+	Profile       UserProfile     `json:"profile"`
+	OwnedProjects []ProjectDetail `json:"owned_projects"`
+	Memberships   []Project       `json:"memberships"`
+	AssignedTasks []AssignedTask  `json:"assigned_tasks"`
+}
+
+// What happens to the projects owned by a deleted account
+const (
+	ProjectActionTransfer = "transfer"
+	ProjectActionArchive  = "archive"
+)
+
+// AccountDeletion reports what happened to the data of a deleted account
+type AccountDeletion struct {
+	// TransferredProjects maps project IDs to their new owner
+	TransferredProjects map[int]int `json:"transferred_projects"`
+	ArchivedProjects    []int       `json:"archived_projects"`
+	ReassignedTasks     int         `json:"reassigned_tasks"`
+}
+
+// ShareLink gives read-only access to a project to anyone knowing its URL,
+// and the password when it has one
+type ShareLink struct {
+	ID          int        `json:"id"`
+	ProjectID   int        `json:"project_id"`
+	Slug        string     `json:"slug"`
+	URL         string     `json:"url"`
+	HasPassword bool       `json:"has_password"`
+	CreatedBy   *int       `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// PublicUser is a user as shown through a share link, without the email
+// address and username
+type PublicUser struct {
+	Name      string `json:"name"`
+	AvatarUrl string `json:"avatar_url"`
+}
+
+type PublicTask struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Priority    Priority   `json:"priority"`
+	Status      Status     `json:"status"`
+	Assignee    PublicUser `json:"assignee"`
+	StartDate   *string    `json:"start_date"`
+	DueDate     *string    `json:"due_date"`
+	Overdue     bool       `json:"overdue"`
+	// ParentTaskID is set on subtasks
+	ParentTaskID *int     `json:"parent_task_id"`
+	Subtasks     Progress `json:"subtasks"`
+	Checklist    Progress `json:"checklist"`
+}
+
+// PublicProject is the read-only variant of ProjectDetail served through
+// share links
+type PublicProject struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	DueDate     string       `json:"due_date"`
+	Status      Status       `json:"status"`
+	Owner       PublicUser   `json:"owner"`
+	Members     []PublicUser `json:"members"`
+	Tasks       []PublicTask `json:"tasks"`
 }
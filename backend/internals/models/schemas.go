@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type SignupPayload struct {
 	AvatarUrl       string `json:"avatar_url"`
 	Name            string `json:"name"`
@@ -7,6 +9,8 @@ type SignupPayload struct {
 	Email           string `json:"email"`
 	Password        string `json:"password"`
 	ConfirmPassword string `json:"confirm_password"`
+	// InvitationToken joins the project of an invitation right away
+	InvitationToken string `json:"invitation_token"`
 }
 
 type LoginPayload struct {
@@ -14,6 +18,84 @@ type LoginPayload struct {
 	Password string `json:"password"`
 }
 
+type UpdateProfilePayload struct {
+	Name      *string `json:"name"`
+	Username  *string `json:"username"`
+	AvatarUrl *string `json:"avatar_url"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+	ConfirmPassword string `json:"confirm_password"`
+	// ReauthToken is a token from POST /me/reauthenticate, sent instead of
+	// CurrentPassword by accounts that never had one
+	ReauthToken string `json:"reauth_token"`
+}
+
+type ChangeEmailPayload struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	// ReauthToken may be sent instead of Password
+	ReauthToken string `json:"reauth_token"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password"`
+	// ReauthToken may be sent instead of Password
+	ReauthToken string `json:"reauth_token"`
+	// ProjectAction is ProjectActionTransfer (the default) or ProjectActionArchive
+	ProjectAction string `json:"project_action"`
+	// TransferTo picks the new owner per project ID, other projects go to
+	// the member with the most assigned tasks
+	TransferTo map[int]int `json:"transfer_to"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordPayload struct {
+	Token           string `json:"token"`
+	Password        string `json:"password"`
+	ConfirmPassword string `json:"confirm_password"`
+}
+
+type VerifyEmailPayload struct {
+	Token string `json:"token"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code"`
+}
+
+type DisableTOTPPayload struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+	// ReauthToken may be sent instead of Password
+	ReauthToken string `json:"reauth_token"`
+}
+
+type MFALoginPayload struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type APIKeyPayload struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type UpdateAPIKeyPayload struct {
+	Name   *string  `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
 type ProjectPayload struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
@@ -21,10 +103,79 @@ type ProjectPayload struct {
 	StatusID    int    `json:"status_id"`
 }
 
+type MemberRolePayload struct {
+	Role string `json:"role"`
+}
+
+type TransferProjectPayload struct {
+	UserID int `json:"user_id"`
+	// PreviousOwnerRole overrides the configured role the current owner keeps
+	PreviousOwnerRole string `json:"previous_owner_role"`
+}
+
+type OrganizationPayload struct {
+	Name        string `json:"name"`
+	DefaultRole string `json:"default_role"`
+}
+
+// UpdateOrganizationPayload changes only the fields that are set
+type UpdateOrganizationPayload struct {
+	Name        *string `json:"name"`
+	DefaultRole *string `json:"default_role"`
+}
+
+type TeamPayload struct {
+	Name string `json:"name"`
+	// LeadID is optional, the lead becomes a member of the team
+	LeadID *int `json:"lead_id"`
+}
+
+// UpdateTeamPayload changes only the fields that are set, a lead_id of 0
+// leaves the team without a lead
+type UpdateTeamPayload struct {
+	Name   *string `json:"name"`
+	LeadID *int    `json:"lead_id"`
+}
+
+type AdminUpdateUserPayload struct {
+	IsAdmin *bool `json:"is_admin"`
+}
+
+type ShareLinkPayload struct {
+	// Password is left empty for links that open without one
+	Password  string     `json:"password"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type InvitationPayload struct {
+	// Email is left empty to create a link anyone can use to join
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type InvitationTokenPayload struct {
+	Token string `json:"token"`
+}
+
 type TaskPayload struct {
 	Title       string `json:"title"`
 	Description string `json:"description"`
 	PriorityID  int    `json:"priority_id"`
 	StatusID    int    `json:"status_id"`
 	AssigneeID  int    `json:"assignee_id"`
+	// StartDate and DueDate are YYYY-MM-DD dates, null clears them
+	StartDate *string `json:"start_date"`
+	DueDate   *string `json:"due_date"`
+	// ParentTaskID makes the task a subtask of another task of the project
+	ParentTaskID *int `json:"parent_task_id"`
+}
+
+type TaskDependencyPayload struct {
+	BlockerTaskID int `json:"blocker_task_id"`
+}
+
+type ChecklistItemPayload struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
 }
@@ -0,0 +1,307 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "task-matrix"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "http://localhost/auth/oidc/callback"
+	testCode         = "auth-code"
+	testVerifier     = "verifier-0123456789-0123456789-0123456789"
+	testNonce        = "nonce-1"
+)
+
+// testIssuer is an OpenID provider serving discovery, JWKS and token
+// endpoints. The token endpoint answers with the ID token built by idToken.
+type testIssuer struct {
+	*httptest.Server
+	key         *rsa.PrivateKey
+	discoveries atomic.Int32
+	idToken     func(claims map[string]any) string
+	claims      func(iss string) map[string]any
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	iss := &testIssuer{key: key}
+	iss.idToken = func(claims map[string]any) string { return signRS256(t, key, "k1", claims) }
+	iss.claims = validClaims
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		iss.discoveries.Add(1)
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 iss.URL,
+			"authorization_endpoint": iss.URL + "/authorize",
+			"token_endpoint":         iss.URL + "/token",
+			"jwks_uri":               iss.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		switch {
+		case id != testClientID || secret != testClientSecret:
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		case r.PostFormValue("grant_type") != "authorization_code",
+			r.PostFormValue("code") != testCode,
+			r.PostFormValue("redirect_uri") != testRedirectURL,
+			r.PostFormValue("code_verifier") != testVerifier:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     iss.idToken(iss.claims(iss.URL)),
+		})
+	})
+
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	return iss
+}
+
+func (iss *testIssuer) provider() *Provider {
+	return NewProvider(iss.URL+"/", testClientID, testClientSecret, testRedirectURL, []string{"email", "profile"}, iss.Client())
+}
+
+func validClaims(iss string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":            iss,
+		"sub":            "user-42",
+		"aud":            testClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          testNonce,
+		"email":          "jane@example.com",
+		"email_verified": "true",
+		"name":           "Jane Doe",
+	}
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+
+	raw, err := p.AuthCodeURL(context.Background(), "state-1", testNonce, testVerifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse %q: %v", raw, err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != iss.URL+"/authorize" {
+		t.Fatalf("authorization endpoint = %q", got)
+	}
+
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 testNonce,
+		"code_challenge":        CodeChallenge(testVerifier),
+		"code_challenge_method": "S256",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q; want %q", k, q.Get(k), v)
+		}
+	}
+
+	// The discovery document is cached
+	if _, err := p.AuthCodeURL(context.Background(), "state-2", testNonce, testVerifier); err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if n := iss.discoveries.Load(); n != 1 {
+		t.Fatalf("discovery fetched %d times; want once", n)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := NewProvider(strings.Replace(iss.URL, "127.0.0.1", "localhost", 1), testClientID, testClientSecret, testRedirectURL, nil, iss.Client())
+
+	_, err := p.AuthCodeURL(context.Background(), "state", testNonce, testVerifier)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("AuthCodeURL = %v; want an issuer mismatch", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	claims, err := iss.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Claims{
+		Issuer:        iss.URL,
+		Subject:       "user-42",
+		Email:         "jane@example.com",
+		EmailVerified: true,
+		Name:          "Jane Doe",
+	}
+	if *claims != want {
+		t.Fatalf("claims = %+v; want %+v", *claims, want)
+	}
+}
+
+func TestExchangeRejectsBadGrant(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	_, err := iss.provider().Exchange(context.Background(), testCode, "another-verifier", testNonce)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("Exchange with a wrong verifier = %v; want invalid_grant", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(claims map[string]any)
+		sign    func(t *testing.T, iss *testIssuer, claims map[string]any) string
+		wantErr error
+	}{
+		{
+			name: "bad signature",
+			sign: func(t *testing.T, iss *testIssuer, claims map[string]any) string {
+				return signRS256(t, otherKey, "k1", claims)
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "tampered payload",
+			sign: func(t *testing.T, iss *testIssuer, claims map[string]any) string {
+				token := signRS256(t, iss.key, "k1", claims)
+				parts := strings.Split(token, ".")
+				claims["sub"] = "admin"
+				payload, _ := json.Marshal(claims)
+				return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name: "unknown key",
+			sign: func(t *testing.T, iss *testIssuer, claims map[string]any) string {
+				return signRS256(t, iss.key, "k2", claims)
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "wrong audience",
+			modify:  func(claims map[string]any) { claims["aud"] = "another-client" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "several audiences without azp",
+			modify:  func(claims map[string]any) { claims["aud"] = []string{testClientID, "another-client"} },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "wrong issuer",
+			modify:  func(claims map[string]any) { claims["iss"] = "https://evil.example.com" },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "expired",
+			modify:  func(claims map[string]any) { claims["exp"] = time.Now().Add(-2 * clockSkew).Unix() },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "issued in the future",
+			modify:  func(claims map[string]any) { claims["iat"] = time.Now().Add(2 * clockSkew).Unix() },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "missing subject",
+			modify:  func(claims map[string]any) { delete(claims, "sub") },
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:    "nonce mismatch",
+			modify:  func(claims map[string]any) { claims["nonce"] = "another-nonce" },
+			wantErr: ErrNonceMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newTestIssuer(t)
+			iss.claims = func(issuer string) map[string]any {
+				claims := validClaims(issuer)
+				if tt.modify != nil {
+					tt.modify(claims)
+				}
+				return claims
+			}
+			if tt.sign != nil {
+				iss.idToken = func(claims map[string]any) string { return tt.sign(t, iss, claims) }
+			}
+
+			claims, err := iss.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Exchange = %+v, %v; want %v", claims, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+// ErrInvalidTransferTarget is returned when a deleted account's project is
+// to be transferred to someone who is not a member of it
+var ErrInvalidTransferTarget = errors.New("new project owner must be a member of the project")
+
+// ExportAccount collects the profile, projects and assigned tasks of a user
+func (r *userRepoImpl) ExportAccount(ctx context.Context, userID int) (*models.AccountExport, error) {
+	profile, err := r.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := models.AccountExport{
+		ExportedAt:    time.Now().UTC(),
+		Profile:       *profile,
+		OwnedProjects: make([]models.ProjectDetail, 0),
+		Memberships:   make([]models.Project, 0),
+		AssignedTasks: make([]models.AssignedTask, 0),
+	}
+
+	projects := &projectRepoImpl{db: r.db}
+	memberOf, err := projects.GetProjects(ctx, userID, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export projects: %w", err)
+	}
+	for _, p := range memberOf {
+		if p.Owner.ID != userID {
+			export.Memberships = append(export.Memberships, p)
+			continue
+		}
+		detail, err := projects.GetProjectByID(ctx, userID, p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export project %d: %w", p.ID, err)
+		}
+		export.OwnedProjects = append(export.OwnedProjects, detail)
+	}
+
+	query := `
+	SELECT t.id, t.title, t.description,
+	       pr.id, pr.name,
+	       s.id, s.name,
+	       u.id, u.name, u.username, u.email, u.avatar_url,
+	       p.id, p.title
+	FROM tasks t
+	JOIN projects p ON p.id = t.project_id
+	JOIN priorities pr ON pr.id = t.priority_id
+	JOIN statuses s ON s.id = t.status_id
+	JOIN users u ON u.id = t.assignee_id
+	WHERE t.assignee_id = $1 AND p.deleted_at IS NULL
+	ORDER BY t.id
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export tasks: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.AssignedTask
+		err := rows.Scan(&t.ID, &t.Title, &t.Description,
+			&t.Priority.ID, &t.Priority.Name,
+			&t.Status.ID, &t.Status.Name,
+			&t.Assignee.ID, &t.Assignee.Name, &t.Assignee.Username, &t.Assignee.Email, &t.Assignee.AvatarUrl,
+			&t.ProjectID, &t.ProjectName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		export.AssignedTasks = append(export.AssignedTasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &export, nil
+}
+
+// DeleteAccount erases a user in one transaction. Owned projects are handed
+// to transferTo[projectID], or else to the member with the most assigned
+// tasks, and archived when archive is set or nobody else is left. Tasks the
+// user was assigned in projects that stay active go to the project owner.
+// The users row is kept for the remaining references but anonymised, and
+// the credentials, keys and identities of the account are deleted.
+func (r *userRepoImpl) DeleteAccount(ctx context.Context, userID int, hashedPassword string, archive bool, transferTo map[int]int) (*models.AccountDeletion, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var username string
+	err = tx.QueryRowContext(ctx,
+		`SELECT username FROM users WHERE id = $1 AND deleted_at IS NULL`, userID,
+	).Scan(&username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id FROM projects WHERE owner_id = $1 AND deleted_at IS NULL ORDER BY id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list owned projects: %w", err)
+	}
+	var owned []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		owned = append(owned, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	result := models.AccountDeletion{
+		TransferredProjects: make(map[int]int),
+		ArchivedProjects:    make([]int, 0),
+	}
+
+	for _, projectID := range owned {
+		newOwner := 0
+		if !archive {
+			newOwner, err = transferTarget(ctx, tx, userID, projectID, transferTo[projectID])
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if newOwner == 0 {
+			_, err = tx.ExecContext(ctx, `UPDATE projects SET deleted_at = $1 WHERE id = $2`, now, projectID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to archive project: %w", err)
+			}
+			result.ArchivedProjects = append(result.ArchivedProjects, projectID)
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE projects SET owner_id = $1 WHERE id = $2`, newOwner, projectID)
+		if err == nil {
+			_, err = tx.ExecContext(ctx,
+				`UPDATE project_members SET role = $1 WHERE project_id = $2 AND user_id = $3`,
+				authz.RoleOwner, projectID, newOwner)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to transfer project: %w", err)
+		}
+		err = recordAudit(ctx, tx, models.ProjectAuditEntry{
+			ProjectID:    projectID,
+			ActorID:      &userID,
+			Action:       models.AuditOwnershipTransferred,
+			TargetUserID: &newOwner,
+			Details:      "previous owner deleted their account",
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.TransferredProjects[projectID] = newOwner
+	}
+
+	res, err := tx.ExecContext(ctx, `
+	UPDATE tasks
+	SET assignee_id = (SELECT p.owner_id FROM projects p WHERE p.id = tasks.project_id)
+	WHERE assignee_id = $1
+	  AND project_id IN (SELECT id FROM projects WHERE owner_id <> $1)
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reassign tasks: %w", err)
+	}
+	reassigned, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	result.ReassignedTasks = int(reassigned)
+
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM project_members
+	WHERE user_id = $1 AND project_id IN (SELECT id FROM projects WHERE owner_id <> $1)
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove memberships: %w", err)
+	}
+
+	// Organizations left without an admin get their longest standing member
+	_, err = tx.ExecContext(ctx, `
+	UPDATE organization_members SET role = $1
+	WHERE org_id IN (SELECT org_id FROM organization_members WHERE user_id = $2 AND role = $1)
+	  AND NOT EXISTS (
+		SELECT 1 FROM organization_members a
+		WHERE a.org_id = organization_members.org_id AND a.role = $1 AND a.user_id <> $2
+	  )
+	  AND user_id = (
+		SELECT m.user_id FROM organization_members m
+		WHERE m.org_id = organization_members.org_id AND m.user_id <> $2
+		ORDER BY m.created_at, m.user_id
+		LIMIT 1
+	  )
+	`, authz.OrgAdmin, userID)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `
+		DELETE FROM organization_members
+		WHERE user_id = $1 AND org_id NOT IN (SELECT id FROM organizations WHERE personal_owner_id = $1)
+		`, userID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE organizations SET name = 'Deleted user''s workspace' WHERE personal_owner_id = $1`, userID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM team_members WHERE user_id = $1`, userID)
+	}
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `UPDATE teams SET lead_id = NULL WHERE lead_id = $1`, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to leave organizations: %w", err)
+	}
+
+	for _, table := range []string{"user_tokens", "user_recovery_codes", "api_keys", "user_identities", "login_attempts"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+			return nil, fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_throttles WHERE username = $1`, username); err != nil {
+		return nil, fmt.Errorf("failed to delete login throttle: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE users
+	SET name = 'Deleted user', username = $1, email = $2, avatar_url = '', password = $3,
+	    pending_email = NULL, email_verified_at = NULL,
+	    totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0,
+	    deleted_at = $4
+	WHERE id = $5
+	`, fmt.Sprintf("deleted-%d", userID), fmt.Sprintf("deleted-%d@deleted.invalid", userID), hashedPassword, now, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to anonymise user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return &result, nil
+}
+
+// transferTarget picks the new owner of a project whose owner is deleted.
+// A requested owner must be an active member, otherwise the member with the
+// most assigned tasks is chosen. Zero means nobody is left to take it.
+func transferTarget(ctx context.Context, tx *sql.Tx, ownerID, projectID, requested int) (int, error) {
+	if requested != 0 {
+		var isMember bool
+		err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM project_members pm
+			JOIN users u ON u.id = pm.user_id
+			WHERE pm.project_id = $1 AND pm.user_id = $2 AND u.deleted_at IS NULL
+		)
+		`, projectID, requested).Scan(&isMember)
+		if err != nil {
+			return 0, fmt.Errorf("membership check failed: %w", err)
+		}
+		if !isMember || requested == ownerID {
+			return 0, fmt.Errorf("project %d: %w", projectID, ErrInvalidTransferTarget)
+		}
+		return requested, nil
+	}
+
+	var newOwner int
+	err := tx.QueryRowContext(ctx, `
+	SELECT pm.user_id
+	FROM project_members pm
+	JOIN users u ON u.id = pm.user_id
+	WHERE pm.project_id = $1 AND pm.user_id <> $2 AND u.deleted_at IS NULL
+	ORDER BY (SELECT COUNT(*) FROM tasks t WHERE t.project_id = pm.project_id AND t.assignee_id = pm.user_id) DESC, pm.user_id
+	LIMIT 1
+	`, projectID, ownerID).Scan(&newOwner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to pick new project owner: %w", err)
+	}
+	return newOwner, nil
+}
@@ -0,0 +1,323 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+var ErrLastAdmin = errors.New("at least one administrator has to remain")
+
+// Filters of the user list of the admin console
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusDeleted  = "deleted"
+)
+
+// Filters of the project list of the admin console
+const (
+	DeletedInclude = "include"
+	DeletedExclude = "exclude"
+	DeletedOnly    = "only"
+)
+
+// adminUserQuery selects the columns scanned by scanAdminUser
+const adminUserQuery = `
+	SELECT id, name, username, email, avatar_url, is_admin, email_verified_at IS NOT NULL,
+	       totp_enabled, password_reset_required, disabled_at, deleted_at
+	FROM users
+`
+
+func scanAdminUser(row rowScanner) (models.AdminUser, error) {
+	var u models.AdminUser
+	var disabledAt, deletedAt sql.NullTime
+	err := row.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.AvatarUrl, &u.IsAdmin, &u.EmailVerified,
+		&u.MFAEnabled, &u.PasswordResetRequired, &disabledAt, &deletedAt)
+	u.DisabledAt = nullTimePtr(disabledAt)
+	u.DeletedAt = nullTimePtr(deletedAt)
+	return u, err
+}
+
+// IsAdmin reports whether a user is an administrator of the installation
+func (r *userRepoImpl) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	var admin bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT is_admin FROM users WHERE id = $1 AND disabled_at IS NULL AND deleted_at IS NULL`, userID,
+	).Scan(&admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check administrator: %w", err)
+	}
+	return admin, nil
+}
+
+// PromoteAdmins makes the users with the given usernames administrators.
+// Unknown usernames are skipped.
+func (r *userRepoImpl) PromoteAdmins(ctx context.Context, usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(usernames))
+	for _, username := range usernames {
+		args = append(args, username)
+	}
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET is_admin = TRUE WHERE username IN (`+placeholders(len(args))+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to promote administrators: %w", err)
+	}
+	return nil
+}
+
+// GetAccountStatus returns whether a user may log in
+func (r *userRepoImpl) GetAccountStatus(ctx context.Context, userID int) (models.AccountStatus, error) {
+	var status models.AccountStatus
+	err := r.db.QueryRowContext(ctx,
+		`SELECT disabled_at IS NOT NULL, password_reset_required FROM users WHERE id = $1`, userID,
+	).Scan(&status.Disabled, &status.PasswordResetRequired)
+	if err != nil {
+		return status, fmt.Errorf("failed to get account status: %w", err)
+	}
+	return status, nil
+}
+
+// ListUsers returns the users matching query on name, username or email,
+// all of them when it is empty, optionally only those with a status or the
+// administrators
+func (r *userRepoImpl) ListUsers(ctx context.Context, query, status string, adminsOnly bool, limit, offset int) ([]models.AdminUser, error) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	rows, err := r.db.QueryContext(ctx, adminUserQuery+`
+	WHERE (
+		$1 = ''
+		OR LOWER(username) LIKE $2 ESCAPE '\'
+		OR LOWER(name) LIKE $2 ESCAPE '\'
+		OR LOWER(email) LIKE $2 ESCAPE '\'
+	)
+	AND CASE $3
+		WHEN 'active' THEN disabled_at IS NULL AND deleted_at IS NULL
+		WHEN 'disabled' THEN disabled_at IS NOT NULL AND deleted_at IS NULL
+		WHEN 'deleted' THEN deleted_at IS NOT NULL
+		ELSE TRUE
+	END
+	AND ($4 = FALSE OR is_admin = TRUE)
+	ORDER BY LOWER(username), id
+	LIMIT $5 OFFSET $6
+	`, q, "%"+escapeLike(q)+"%", status, adminsOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]models.AdminUser, 0)
+	for rows.Next() {
+		u, err := scanAdminUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetAdminUser returns a user as shown in the admin console
+func (r *userRepoImpl) GetAdminUser(ctx context.Context, userID int) (models.AdminUser, error) {
+	u, err := scanAdminUser(r.db.QueryRowContext(ctx, adminUserQuery+`WHERE id = $1`, userID))
+	if err != nil {
+		return u, fmt.Errorf("failed to get user: %w", err)
+	}
+	return u, nil
+}
+
+// SetUserDisabled disables or re-enables the account of a user that is not
+// deleted
+func (r *userRepoImpl) SetUserDisabled(ctx context.Context, userID int, disabled bool) error {
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now().UTC()
+		disabledAt = &now
+	}
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET disabled_at = $1 WHERE id = $2 AND deleted_at IS NULL`, disabledAt, userID)
+	if err != nil {
+		return fmt.Errorf("failed to disable user: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// SetAdmin grants or revokes the administrator flag of a user, keeping at
+// least one administrator
+func (r *userRepoImpl) SetAdmin(ctx context.Context, userID int, admin bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !admin {
+		var others bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM users
+				WHERE id <> $1 AND is_admin = TRUE AND disabled_at IS NULL AND deleted_at IS NULL
+			)
+		`, userID).Scan(&others)
+		if err != nil {
+			return fmt.Errorf("administrator check failed: %w", err)
+		}
+		if !others {
+			return ErrLastAdmin
+		}
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE users SET is_admin = $1 WHERE id = $2 AND deleted_at IS NULL`, admin, userID)
+	if err != nil {
+		return fmt.Errorf("failed to change administrator flag: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RequirePasswordReset blocks password logins of a user until they reset
+// their password, which UpdatePasswordHash records
+func (r *userRepoImpl) RequirePasswordReset(ctx context.Context, userID int) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET password_reset_required = TRUE WHERE id = $1 AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to require password reset: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetSystemStats counts the users, projects and tasks of the installation.
+// Users are active when they logged in since activeSince. Sessions are
+// counted in sessionTable unless it is empty.
+func (r *userRepoImpl) GetSystemStats(ctx context.Context, activeSince time.Time, sessionTable string) (models.SystemStats, error) {
+	var stats models.SystemStats
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*),
+			COUNT(CASE WHEN is_admin AND deleted_at IS NULL THEN 1 END),
+			COUNT(CASE WHEN disabled_at IS NOT NULL AND deleted_at IS NULL THEN 1 END),
+			COUNT(deleted_at),
+			COUNT(CASE WHEN email_verified_at IS NULL AND deleted_at IS NULL THEN 1 END)
+		FROM users
+	`).Scan(&stats.Users.Total, &stats.Users.Admins, &stats.Users.Disabled, &stats.Users.Deleted, &stats.Users.Unverified)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT user_id) FROM login_attempts WHERE success = TRUE AND created_at >= $1`, activeSince,
+	).Scan(&stats.Users.Active)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count active users: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*), COUNT(deleted_at) FROM projects`,
+	).Scan(&stats.Projects.Total, &stats.Projects.Deleted)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count projects: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(CASE WHEN s.name = 'Completed' THEN 1 END)
+		FROM tasks t
+		JOIN statuses s ON s.id = t.status_id
+	`).Scan(&stats.Tasks.Total, &stats.Tasks.Completed)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count tasks: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx,
+		`SELECT (SELECT COUNT(*) FROM organizations), (SELECT COUNT(*) FROM teams)`,
+	).Scan(&stats.Organizations, &stats.Teams)
+	if err != nil {
+		return stats, fmt.Errorf("failed to count organizations: %w", err)
+	}
+
+	if sessionTable != "" {
+		var sessions int
+		err = r.db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM `+sessionTable+` WHERE expires_at > $1`, time.Now().UTC(),
+		).Scan(&sessions)
+		if err != nil {
+			return stats, fmt.Errorf("failed to count sessions: %w", err)
+		}
+		stats.ActiveSessions = &sessions
+	}
+
+	return stats, nil
+}
+
+// ListAllProjects returns the projects of every user matching query on
+// their name, deleted ones included, only or excluded as asked
+func (r *projectRepoImpl) ListAllProjects(ctx context.Context, query, deleted string, limit, offset int) ([]models.AdminProject, error) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT
+			p.id, COALESCE(p.org_id, 0), p.title, s.id, s.name,
+			u.id, u.name, u.username, u.email, u.avatar_url,
+			(SELECT COUNT(*) FROM project_members pm WHERE pm.project_id = p.id),
+			(SELECT COUNT(*) FROM tasks t WHERE t.project_id = p.id),
+			p.created_at, p.deleted_at
+		FROM projects p
+		JOIN statuses s ON s.id = p.status_id
+		JOIN users u ON u.id = p.owner_id
+		WHERE ($1 = '' OR LOWER(p.title) LIKE $2 ESCAPE '\')
+		  AND CASE $3
+			WHEN 'exclude' THEN p.deleted_at IS NULL
+			WHEN 'only' THEN p.deleted_at IS NOT NULL
+			ELSE TRUE
+		  END
+		ORDER BY p.id DESC
+		LIMIT $4 OFFSET $5
+	`, q, "%"+escapeLike(q)+"%", deleted, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	projects := make([]models.AdminProject, 0)
+	for rows.Next() {
+		var p models.AdminProject
+		var createdAt, deletedAt sql.NullTime
+		err := rows.Scan(&p.ID, &p.OrgID, &p.Name, &p.Status.ID, &p.Status.Name,
+			&p.Owner.ID, &p.Owner.Name, &p.Owner.Username, &p.Owner.Email, &p.Owner.AvatarUrl,
+			&p.MemberCount, &p.TotalTasks, &createdAt, &deletedAt)
+		if err != nil {
+			return nil, err
+		}
+		p.CreatedAt = nullTimePtr(createdAt)
+		p.DeletedAt = nullTimePtr(deletedAt)
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
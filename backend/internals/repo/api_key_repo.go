@@ -0,0 +1,145 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+// Scopes are stored space separated in a single column
+
+func joinScopes(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+func splitScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// CreateAPIKey stores a new API key of a user and returns the generated ID
+func (r *userRepoImpl) CreateAPIKey(ctx context.Context, userID int, key models.APIKey, keyHash string) (int, error) {
+	query := `
+	INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id
+	`
+	var id int
+	err := r.db.QueryRowContext(ctx, query,
+		userID, key.Name, key.Prefix, keyHash, joinScopes(key.Scopes), key.CreatedAt, key.ExpiresAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create api key: %w", err)
+	}
+	return id, nil
+}
+
+const apiKeyColumns = `k.id, k.name, k.prefix, k.scopes, k.created_at, k.expires_at, k.last_used_at`
+
+func scanAPIKey(row interface{ Scan(...any) error }, dest ...any) (*models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(append([]any{
+		&key.ID, &key.Name, &key.Prefix, &scopes, &key.CreatedAt, &expiresAt, &lastUsedAt,
+	}, dest...)...)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = splitScopes(scopes)
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	return &key, nil
+}
+
+// ListAPIKeys returns the API keys of a user, newest first
+func (r *userRepoImpl) ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys k WHERE k.user_id = $1 ORDER BY k.created_at DESC, k.id DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetAPIKey fetches an API key of a user by ID
+func (r *userRepoImpl) GetAPIKey(ctx context.Context, userID, keyID int) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys k WHERE k.id = $1 AND k.user_id = $2`
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyID, userID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+// UpdateAPIKey changes the name and scopes of an API key of a user
+func (r *userRepoImpl) UpdateAPIKey(ctx context.Context, userID int, key models.APIKey) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE api_keys SET name = $1, scopes = $2 WHERE id = $3 AND user_id = $4`,
+		key.Name, joinScopes(key.Scopes), key.ID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteAPIKey revokes an API key of a user
+func (r *userRepoImpl) DeleteAPIKey(ctx context.Context, userID, keyID int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetAPIKeyByHash fetches an API key and its owner by the hash of the key
+func (r *userRepoImpl) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, *models.User, error) {
+	query := `
+	SELECT ` + apiKeyColumns + `, u.id, u.name, u.username, u.email, u.avatar_url
+	FROM api_keys k
+	JOIN users u ON u.id = k.user_id
+	WHERE k.key_hash = $1 AND u.disabled_at IS NULL
+	`
+	var user models.User
+	key, err := scanAPIKey(r.db.QueryRowContext(ctx, query, keyHash),
+		&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, &user, nil
+}
+
+// TouchAPIKey records when an API key was last used
+func (r *userRepoImpl) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, usedAt, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+var ErrChecklistItemNotFound = errors.New("checklist item not found")
+
+// checklistItemQuery selects the columns scanned by scanChecklistItem
+const checklistItemQuery = `
+	SELECT ci.id, ci.task_id, ci.title, ci.done, ci.created_at
+	FROM task_checklist_items ci
+`
+
+func scanChecklistItem(row rowScanner) (models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	var createdAt sql.NullTime
+	err := row.Scan(&item.ID, &item.TaskID, &item.Title, &item.Done, &createdAt)
+	item.CreatedAt = nullTimePtr(createdAt)
+	return item, err
+}
+
+// checkTask returns ErrTaskNotFound unless the task belongs to the project
+func checkTask(ctx context.Context, q authz.Querier, projectID, taskID int) error {
+	var exists bool
+	err := q.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND project_id = $2)`, taskID, projectID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check task: %w", err)
+	}
+	if !exists {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+// ListChecklistItems returns the checklist of a task in the order the items
+// were added
+func (r *taskRepoImpl) ListChecklistItems(ctx context.Context, currentUserID, projectID, taskID int) ([]models.ChecklistItem, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ViewProject); err != nil {
+		return nil, err
+	}
+	if err := checkTask(ctx, r.db, projectID, taskID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, checklistItemQuery+`WHERE ci.task_id = $1 ORDER BY ci.id`, taskID)
+	if err != nil {
+		return nil, fmt.Errorf("list checklist items: %w", err)
+	}
+	defer rows.Close()
+
+	items := make([]models.ChecklistItem, 0)
+	for rows.Next() {
+		item, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// AddChecklistItem appends an item to the checklist of a task
+func (r *taskRepoImpl) AddChecklistItem(ctx context.Context, currentUserID, projectID, taskID int, title string, done bool) (models.ChecklistItem, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditTasks); err != nil {
+		return models.ChecklistItem{}, err
+	}
+	if err := checkTask(ctx, r.db, projectID, taskID); err != nil {
+		return models.ChecklistItem{}, err
+	}
+
+	now := time.Now().UTC()
+	item := models.ChecklistItem{TaskID: taskID, Title: title, Done: done, CreatedAt: &now}
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO task_checklist_items (task_id, title, done, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, taskID, title, done, now).Scan(&item.ID)
+	if err != nil {
+		return item, fmt.Errorf("add checklist item: %w", err)
+	}
+	return item, nil
+}
+
+// UpdateChecklistItem renames an item of the checklist of a task and checks
+// or unchecks it
+func (r *taskRepoImpl) UpdateChecklistItem(ctx context.Context, currentUserID, projectID, taskID, itemID int, title string, done bool) (models.ChecklistItem, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditTasks); err != nil {
+		return models.ChecklistItem{}, err
+	}
+
+	query := `
+		UPDATE task_checklist_items
+		SET title = $1, done = $2
+		WHERE id = $3 AND task_id = $4
+		  AND EXISTS (SELECT 1 FROM tasks WHERE id = $4 AND project_id = $5)
+	`
+	res, err := r.db.ExecContext(ctx, query, title, done, itemID, taskID, projectID)
+	if err != nil {
+		return models.ChecklistItem{}, fmt.Errorf("update checklist item: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return models.ChecklistItem{}, ErrChecklistItemNotFound
+	}
+
+	item, err := scanChecklistItem(r.db.QueryRowContext(ctx, checklistItemQuery+`WHERE ci.id = $1`, itemID))
+	if err != nil {
+		return item, fmt.Errorf("get checklist item: %w", err)
+	}
+	return item, nil
+}
+
+// DeleteChecklistItem removes an item from the checklist of a task
+func (r *taskRepoImpl) DeleteChecklistItem(ctx context.Context, currentUserID, projectID, taskID, itemID int) error {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditTasks); err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM task_checklist_items
+		WHERE id = $1 AND task_id = $2
+		  AND EXISTS (SELECT 1 FROM tasks WHERE id = $2 AND project_id = $3)
+	`
+	res, err := r.db.ExecContext(ctx, query, itemID, taskID, projectID)
+	if err != nil {
+		return fmt.Errorf("delete checklist item: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrChecklistItemNotFound
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+var (
+	ErrBlockerNotFound    = errors.New("blocking task not found in the project")
+	ErrDependencyExists   = errors.New("the task is already blocked by this task")
+	ErrDependencyNotFound = errors.New("dependency not found")
+	ErrDependencyCycle    = errors.New("the dependency would make the tasks block each other in a cycle")
+	// ErrTaskBlocked is returned when a task would be completed while tasks
+	// blocking it are still open
+	ErrTaskBlocked = errors.New("task is blocked by open tasks")
+)
+
+// AddTaskDependency makes blockerID block taskID, both tasks of the project.
+// Dependencies never form cycles, so there is always an order in which the
+// tasks can be completed.
+func (r *taskRepoImpl) AddTaskDependency(ctx context.Context, currentUserID, projectID, taskID, blockerID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.EditTasks); err != nil {
+		return err
+	}
+
+	if err := lockProject(ctx, tx, projectID); err != nil {
+		return err
+	}
+
+	if err := checkTask(ctx, tx, projectID, taskID); err != nil {
+		return err
+	}
+	if err := checkTask(ctx, tx, projectID, blockerID); errors.Is(err, ErrTaskNotFound) {
+		return ErrBlockerNotFound
+	} else if err != nil {
+		return err
+	}
+	if blockerID == taskID {
+		return ErrDependencyCycle
+	}
+
+	var exists bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM task_dependencies WHERE blocker_task_id = $1 AND blocked_task_id = $2)`,
+		blockerID, taskID,
+	).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check dependency: %w", err)
+	}
+	if exists {
+		return ErrDependencyExists
+	}
+
+	// The new edge closes a cycle when the task already blocks the blocker,
+	// directly or through other tasks
+	visited := map[int]bool{taskID: true}
+	level := []any{taskID}
+	for len(level) > 0 {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT blocked_task_id FROM task_dependencies WHERE blocker_task_id IN (`+placeholders(len(level))+`)`, level...)
+		if err != nil {
+			return fmt.Errorf("list blocked tasks: %w", err)
+		}
+		var next []any
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			if id == blockerID {
+				rows.Close()
+				return ErrDependencyCycle
+			}
+			if !visited[id] {
+				visited[id] = true
+				next = append(next, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		level = next
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO task_dependencies (blocker_task_id, blocked_task_id, created_at) VALUES ($1, $2, $3)`,
+		blockerID, taskID, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("add dependency: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveTaskDependency stops blockerID from blocking taskID
+func (r *taskRepoImpl) RemoveTaskDependency(ctx context.Context, currentUserID, projectID, taskID, blockerID int) error {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditTasks); err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM task_dependencies
+		WHERE blocker_task_id = $1 AND blocked_task_id = $2
+		  AND EXISTS (SELECT 1 FROM tasks WHERE id = $2 AND project_id = $3)
+	`
+	res, err := r.db.ExecContext(ctx, query, blockerID, taskID, projectID)
+	if err != nil {
+		return fmt.Errorf("remove dependency: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrDependencyNotFound
+	}
+	return nil
+}
+
+// blockersOnCompletion returns the open tasks blocking a task when statusID
+// would move it into the Completed status, and nothing when it stays out of
+// it or was completed already
+func blockersOnCompletion(ctx context.Context, tx *sql.Tx, taskID, statusID int) ([]int, error) {
+	query := `
+		SELECT d.blocker_task_id
+		FROM task_dependencies d
+		JOIN tasks b ON b.id = d.blocker_task_id
+		JOIN tasks t ON t.id = d.blocked_task_id
+		WHERE d.blocked_task_id = $1
+		  AND $2 = ` + completedStatusQuery + `
+		  AND t.status_id <> ` + completedStatusQuery + `
+		  AND b.status_id <> ` + completedStatusQuery + `
+		ORDER BY d.blocker_task_id
+	`
+	rows, err := tx.QueryContext(ctx, query, taskID, statusID)
+	if err != nil {
+		return nil, fmt.Errorf("list open blockers: %w", err)
+	}
+	defer rows.Close()
+
+	var blockers []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blockers = append(blockers, id)
+	}
+	return blockers, rows.Err()
+}
+
+// GetDependencyGraph returns the dependencies between the tasks of a project
+func (r *taskRepoImpl) GetDependencyGraph(ctx context.Context, currentUserID, projectID int) (models.DependencyGraph, error) {
+	graph := models.DependencyGraph{
+		ProjectID: projectID,
+		Nodes:     make([]models.DependencyNode, 0),
+		Edges:     make([]models.DependencyEdge, 0),
+	}
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ViewProject); err != nil {
+		return graph, err
+	}
+
+	err := r.db.QueryRowContext(ctx, `SELECT title FROM projects WHERE id = $1`, projectID).Scan(&graph.ProjectName)
+	if err != nil {
+		return graph, fmt.Errorf("get project: %w", err)
+	}
+
+	nodeQuery := `
+		SELECT t.id, t.title, s.id, s.name
+		FROM tasks t
+		JOIN statuses s ON s.id = t.status_id
+		WHERE t.project_id = $1
+		  AND (EXISTS (SELECT 1 FROM task_dependencies d WHERE d.blocker_task_id = t.id)
+		       OR EXISTS (SELECT 1 FROM task_dependencies d WHERE d.blocked_task_id = t.id))
+		ORDER BY t.id
+	`
+	rows, err := r.db.QueryContext(ctx, nodeQuery, projectID)
+	if err != nil {
+		return graph, fmt.Errorf("list dependency nodes: %w", err)
+	}
+	defer rows.Close()
+
+	completed := make(map[int]bool)
+	for rows.Next() {
+		var n models.DependencyNode
+		if err := rows.Scan(&n.ID, &n.Title, &n.Status.ID, &n.Status.Name); err != nil {
+			return graph, err
+		}
+		n.Completed = n.Status.Name == completedStatus
+		completed[n.ID] = n.Completed
+		graph.Nodes = append(graph.Nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return graph, err
+	}
+
+	edgeQuery := `
+		SELECT d.blocker_task_id, d.blocked_task_id
+		FROM task_dependencies d
+		JOIN tasks t ON t.id = d.blocked_task_id
+		WHERE t.project_id = $1
+		ORDER BY d.blocker_task_id, d.blocked_task_id
+	`
+	edgeRows, err := r.db.QueryContext(ctx, edgeQuery, projectID)
+	if err != nil {
+		return graph, fmt.Errorf("list dependency edges: %w", err)
+	}
+	defer edgeRows.Close()
+
+	blocked := make(map[int]bool)
+	for edgeRows.Next() {
+		var e models.DependencyEdge
+		if err := edgeRows.Scan(&e.From, &e.To); err != nil {
+			return graph, err
+		}
+		if !completed[e.From] && !completed[e.To] {
+			blocked[e.To] = true
+		}
+		graph.Edges = append(graph.Edges, e)
+	}
+	if err := edgeRows.Err(); err != nil {
+		return graph, err
+	}
+
+	for i := range graph.Nodes {
+		graph.Nodes[i].Blocked = blocked[graph.Nodes[i].ID]
+	}
+	return graph, nil
+}
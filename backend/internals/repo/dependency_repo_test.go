@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAddTaskDependency(t *testing.T) {
+	// Tasks of the fixture: a blocks b, which blocks c, d stands alone and
+	// foreign is a task of another project
+	type fixture struct {
+		a, b, c, d, foreign int
+	}
+
+	tests := []struct {
+		name string
+		// edge returns the task and the task to block it
+		edge func(f fixture) (taskID, blockerID int)
+		want error
+	}{
+		{"independent task", func(f fixture) (int, int) { return f.d, f.c }, nil},
+		{"shortcut", func(f fixture) (int, int) { return f.c, f.a }, nil},
+		{"itself", func(f fixture) (int, int) { return f.a, f.a }, ErrDependencyCycle},
+		{"direct cycle", func(f fixture) (int, int) { return f.a, f.b }, ErrDependencyCycle},
+		{"transitive cycle", func(f fixture) (int, int) { return f.a, f.c }, ErrDependencyCycle},
+		{"existing dependency", func(f fixture) (int, int) { return f.b, f.a }, ErrDependencyExists},
+		{"blocker of another project", func(f fixture) (int, int) { return f.a, f.foreign }, ErrBlockerNotFound},
+		{"task of another project", func(f fixture) (int, int) { return f.foreign, f.a }, ErrTaskNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ur, pr, tr := newTestRepos(t)
+			ctx := context.Background()
+			userID, projectID := newTestProject(t, ur, pr, "tester")
+			outsiderID, foreignProjectID := newTestProject(t, ur, pr, "outsider")
+
+			var f fixture
+			f.a = newTestTask(t, tr, userID, projectID, testTask{title: "a"})
+			f.b = newTestTask(t, tr, userID, projectID, testTask{title: "b"})
+			f.c = newTestTask(t, tr, userID, projectID, testTask{title: "c"})
+			f.d = newTestTask(t, tr, userID, projectID, testTask{title: "d"})
+			f.foreign = newTestTask(t, tr, outsiderID, foreignProjectID, testTask{title: "foreign"})
+			for _, edge := range [][2]int{{f.b, f.a}, {f.c, f.b}} {
+				if err := tr.AddTaskDependency(ctx, userID, projectID, edge[0], edge[1]); err != nil {
+					t.Fatalf("AddTaskDependency(%d, %d): %v", edge[0], edge[1], err)
+				}
+			}
+
+			taskID, blockerID := tt.edge(f)
+			if err := tr.AddTaskDependency(ctx, userID, projectID, taskID, blockerID); !errors.Is(err, tt.want) {
+				t.Fatalf("AddTaskDependency(%d, %d) err = %v; want %v", taskID, blockerID, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompleteBlockedTask(t *testing.T) {
+	ur, pr, tr := newTestRepos(t)
+	ctx := context.Background()
+	userID, projectID := newTestProject(t, ur, pr, "tester")
+	outsiderID, foreignProjectID := newTestProject(t, ur, pr, "outsider")
+
+	blocker := newTestTask(t, tr, userID, projectID, testTask{title: "blocker"})
+	done := newTestTask(t, tr, userID, projectID, testTask{title: "done", statusID: testStatusCompleted})
+	blocked := newTestTask(t, tr, userID, projectID, testTask{title: "blocked"})
+	for _, id := range []int{blocker, done} {
+		if err := tr.AddTaskDependency(ctx, userID, projectID, blocked, id); err != nil {
+			t.Fatalf("AddTaskDependency: %v", err)
+		}
+	}
+	foreignBlocker := newTestTask(t, tr, outsiderID, foreignProjectID, testTask{title: "foreign blocker"})
+	foreignBlocked := newTestTask(t, tr, outsiderID, foreignProjectID, testTask{title: "foreign blocked"})
+	if err := tr.AddTaskDependency(ctx, outsiderID, foreignProjectID, foreignBlocked, foreignBlocker); err != nil {
+		t.Fatalf("AddTaskDependency: %v", err)
+	}
+
+	setStatus := func(projectID, taskID, statusID int, allowBlocked bool) ([]int, error) {
+		return tr.UpdateTaskByID(ctx, userID, projectID, taskID, "task", "", testPriorityMedium, statusID, userID, nil, nil, nil, allowBlocked)
+	}
+
+	tests := []struct {
+		name         string
+		projectID    int
+		taskID       int
+		statusID     int
+		allowBlocked bool
+		wantBlockers []int
+		wantErr      error
+		wantStatus   int
+	}{
+		{"not completing", projectID, blocked, testStatusInProgress, false, nil, nil, testStatusInProgress},
+		{"completing while blocked", projectID, blocked, testStatusCompleted, false, []int{blocker}, ErrTaskBlocked, testStatusInProgress},
+		{"task of another project", projectID, foreignBlocked, testStatusCompleted, false, nil, ErrTaskNotFound, 0},
+		{"completing anyway", projectID, blocked, testStatusCompleted, true, []int{blocker}, nil, testStatusCompleted},
+		{"already completed", projectID, blocked, testStatusCompleted, false, nil, nil, testStatusCompleted},
+		{"reopening", projectID, blocked, testStatusTodo, false, nil, nil, testStatusTodo},
+		{"completing the blocker", projectID, blocker, testStatusCompleted, false, nil, nil, testStatusCompleted},
+		{"completing once unblocked", projectID, blocked, testStatusCompleted, false, nil, nil, testStatusCompleted},
+	}
+	// The cases run in order, each starting where the previous one left off
+	for _, tt := range tests {
+		blockers, err := setStatus(tt.projectID, tt.taskID, tt.statusID, tt.allowBlocked)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: err = %v; want %v", tt.name, err, tt.wantErr)
+		}
+		if !slices.Equal(blockers, tt.wantBlockers) {
+			t.Fatalf("%s: blockers = %v; want %v", tt.name, blockers, tt.wantBlockers)
+		}
+		if tt.wantStatus == 0 {
+			continue
+		}
+		task, err := tr.GetTask(ctx, userID, tt.projectID, tt.taskID)
+		if err != nil {
+			t.Fatalf("%s: GetTask: %v", tt.name, err)
+		}
+		if task.Status.ID != tt.wantStatus {
+			t.Fatalf("%s: status = %d; want %d", tt.name, task.Status.ID, tt.wantStatus)
+		}
+	}
+}
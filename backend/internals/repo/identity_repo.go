@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+// CreateOIDCState stores the PKCE verifier and nonce of a pending OIDC login
+// under the hash of its state parameter. Expired logins are purged.
+func (r *userRepoImpl) CreateOIDCState(ctx context.Context, stateHash, nonce, codeVerifier string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_states WHERE expires_at <= $1`, now); err != nil {
+		return fmt.Errorf("failed to purge oidc states: %w", err)
+	}
+
+	query := `
+	INSERT INTO oidc_states (state_hash, nonce, code_verifier, expires_at)
+	VALUES ($1, $2, $3, $4)
+	`
+	if _, err := r.db.ExecContext(ctx, query, stateHash, nonce, codeVerifier, expiresAt); err != nil {
+		return fmt.Errorf("failed to create oidc state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCState deletes a pending OIDC login and returns its nonce and
+// PKCE verifier if it has not expired
+func (r *userRepoImpl) ConsumeOIDCState(ctx context.Context, stateHash string) (string, string, error) {
+	query := `
+	DELETE FROM oidc_states
+	WHERE state_hash = $1 AND expires_at > $2
+	RETURNING nonce, code_verifier
+	`
+	var nonce, codeVerifier string
+	err := r.db.QueryRowContext(ctx, query, stateHash, time.Now().UTC()).Scan(&nonce, &codeVerifier)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to consume oidc state: %w", err)
+	}
+	return nonce, codeVerifier, nil
+}
+
+// GetUserByIdentity fetches the user linked to an external identity and
+// records the login on the identity
+func (r *userRepoImpl) GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	query := `
+	SELECT u.id, u.name, u.username, u.email, u.avatar_url
+	FROM user_identities i
+	JOIN users u ON u.id = i.user_id
+	WHERE i.issuer = $1 AND i.subject = $2
+	`
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, issuer, subject).Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by identity: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE user_identities SET last_login_at = $1 WHERE issuer = $2 AND subject = $3`,
+		time.Now().UTC(), issuer, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update identity: %w", err)
+	}
+	return &user, nil
+}
+
+// LinkIdentity links an external identity to a user
+func (r *userRepoImpl) LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error {
+	now := time.Now().UTC()
+	query := `
+	INSERT INTO user_identities (user_id, issuer, subject, email, created_at, last_login_at)
+	VALUES ($1, $2, $3, $4, $5, $5)
+	`
+	if _, err := r.db.ExecContext(ctx, query, userID, issuer, subject, email, now); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+var (
+	ErrAlreadyMember        = errors.New("user is already a member of the project")
+	ErrAlreadyInvited       = errors.New("email address already has a pending invitation")
+	ErrInvitationNotForUser = errors.New("invitation was sent to another email address")
+	ErrEmailNotVerified     = errors.New("email address is not verified")
+	ErrLinkNotDeclinable    = errors.New("invitation links cannot be declined")
+)
+
+// invitationQuery selects the columns scanned by scanInvitation
+const invitationQuery = `
+	SELECT i.id, i.project_id, p.title, i.inviter_id, COALESCE(u.name, ''),
+	       i.email, iu.username, i.role, i.status, i.created_at, i.expires_at, i.responded_at
+	FROM project_invitations i
+	JOIN projects p ON p.id = i.project_id
+	LEFT JOIN users u ON u.id = i.inviter_id
+	LEFT JOIN users iu ON iu.id = i.user_id
+`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvitation(row rowScanner) (models.ProjectInvitation, error) {
+	var inv models.ProjectInvitation
+	var inviterID sql.NullInt64
+	var email, username sql.NullString
+	var respondedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.ProjectID, &inv.ProjectName, &inviterID, &inv.InviterName,
+		&email, &username, &inv.Role, &inv.Status, &inv.CreatedAt, &inv.ExpiresAt, &respondedAt)
+	if err != nil {
+		return inv, err
+	}
+	inv.InviterID = nullIntPtr(inviterID)
+	if email.Valid {
+		inv.Email = &email.String
+	}
+	if username.Valid {
+		inv.Username = &username.String
+	}
+	inv.RespondedAt = nullTimePtr(respondedAt)
+	return inv, nil
+}
+
+func queryInvitations(ctx context.Context, db *sql.DB, where string, args ...any) ([]models.ProjectInvitation, error) {
+	rows, err := db.QueryContext(ctx, invitationQuery+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := make([]models.ProjectInvitation, 0)
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// CreateInvitation invites email, or anyone with the link when email is
+// nil, to join a project with a role below the role of the current user.
+// An empty role stands for the default role of the organization.
+func (r *projectRepoImpl) CreateInvitation(ctx context.Context, currentUserID, projectID int, email *string, role authz.Role, tokenHash string, expiresAt time.Time) (models.ProjectInvitation, error) {
+	return r.createInvitation(ctx, currentUserID, projectID, email, nil, role, tokenHash, expiresAt)
+}
+
+// createInvitation is CreateInvitation recording the user invited by
+// username, if any
+func (r *projectRepoImpl) createInvitation(ctx context.Context, currentUserID, projectID int, email *string, userID *int, role authz.Role, tokenHash string, expiresAt time.Time) (models.ProjectInvitation, error) {
+	actor, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ManageMembers)
+	if err != nil {
+		return models.ProjectInvitation{}, err
+	}
+	if role == "" {
+		if role, err = defaultMemberRole(ctx, r.db, projectID); err != nil {
+			return models.ProjectInvitation{}, err
+		}
+	}
+	if !authz.CanManage(actor, role) {
+		return models.ProjectInvitation{}, fmt.Errorf("%w: %s cannot invite a member as %s", authz.ErrForbidden, actor, role)
+	}
+
+	now := time.Now().UTC()
+	if email != nil {
+		var exists bool
+		err := r.db.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM project_members pm
+				JOIN users u ON u.id = pm.user_id
+				WHERE pm.project_id = $1 AND LOWER(u.email) = LOWER($2)
+			)
+		`, projectID, *email).Scan(&exists)
+		if err != nil {
+			return models.ProjectInvitation{}, fmt.Errorf("membership check failed: %w", err)
+		}
+		if exists {
+			return models.ProjectInvitation{}, ErrAlreadyMember
+		}
+
+		err = r.db.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM project_invitations
+				WHERE project_id = $1 AND LOWER(email) = LOWER($2) AND status = $3 AND expires_at > $4
+			)
+		`, projectID, *email, models.InvitationPending, now).Scan(&exists)
+		if err != nil {
+			return models.ProjectInvitation{}, fmt.Errorf("invitation check failed: %w", err)
+		}
+		if exists {
+			return models.ProjectInvitation{}, ErrAlreadyInvited
+		}
+	}
+
+	query := `
+		INSERT INTO project_invitations (project_id, inviter_id, email, user_id, role, token_hash, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id
+	`
+	var id int
+	err = r.db.QueryRowContext(ctx, query,
+		projectID, currentUserID, email, userID, role, tokenHash, models.InvitationPending, now, expiresAt,
+	).Scan(&id)
+	if err != nil {
+		return models.ProjectInvitation{}, fmt.Errorf("create invitation: %w", err)
+	}
+
+	inv, err := scanInvitation(r.db.QueryRowContext(ctx, invitationQuery+`WHERE i.id = $1`, id))
+	if err != nil {
+		return inv, fmt.Errorf("get invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// ListInvitations returns every invitation of a project, newest first
+func (r *projectRepoImpl) ListInvitations(ctx context.Context, currentUserID, projectID int) ([]models.ProjectInvitation, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ManageMembers); err != nil {
+		return nil, err
+	}
+	return queryInvitations(ctx, r.db, `WHERE i.project_id = $1 ORDER BY i.created_at DESC, i.id DESC`, projectID)
+}
+
+// RevokeInvitation withdraws a pending invitation
+func (r *projectRepoImpl) RevokeInvitation(ctx context.Context, currentUserID, projectID, invitationID int) error {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ManageMembers); err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE project_invitations SET status = $1, responded_at = $2
+		WHERE id = $3 AND project_id = $4 AND status = $5
+	`, models.InvitationRevoked, time.Now().UTC(), invitationID, projectID, models.InvitationPending)
+	if err != nil {
+		return fmt.Errorf("revoke invitation: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListInvitationsForUser returns the pending invitations sent to the email
+// address of a user
+func (r *projectRepoImpl) ListInvitationsForUser(ctx context.Context, userID int) ([]models.ProjectInvitation, error) {
+	return queryInvitations(ctx, r.db, `
+		JOIN users me ON LOWER(me.email) = LOWER(i.email)
+		WHERE me.id = $1 AND i.status = $2 AND i.expires_at > $3 AND p.deleted_at IS NULL
+		ORDER BY i.created_at DESC, i.id DESC
+	`, userID, models.InvitationPending, time.Now().UTC())
+}
+
+// GetInvitationIDByToken finds a pending invitation by the hash of its token
+func (r *projectRepoImpl) GetInvitationIDByToken(ctx context.Context, tokenHash string) (int, error) {
+	var id int
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id FROM project_invitations
+		WHERE token_hash = $1 AND status = $2 AND expires_at > $3
+	`, tokenHash, models.InvitationPending, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("get invitation by token: %w", err)
+	}
+	return id, nil
+}
+
+// AcceptInvitation adds a user to the project of a pending invitation.
+// Email invitations are for the account with that address, which must be
+// verified unless the user showed the emailed token (byToken). Link
+// invitations stay pending for others to use until they expire.
+func (r *projectRepoImpl) AcceptInvitation(ctx context.Context, userID, invitationID int, byToken bool) (models.ProjectInvitation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProjectInvitation{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inv, err := invitationForUser(ctx, tx, userID, invitationID, byToken)
+	if err != nil {
+		return inv, err
+	}
+	if err := joinProject(ctx, tx, userID, inv); err != nil {
+		return inv, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return inv, fmt.Errorf("commit transaction: %w", err)
+	}
+	return inv, nil
+}
+
+// DeclineInvitation turns down an email invitation
+func (r *projectRepoImpl) DeclineInvitation(ctx context.Context, userID, invitationID int, byToken bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inv, err := invitationForUser(ctx, tx, userID, invitationID, byToken)
+	if err != nil {
+		return err
+	}
+	if inv.Email == nil {
+		return ErrLinkNotDeclinable
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE project_invitations SET status = $1, responded_at = $2 WHERE id = $3`,
+		models.InvitationDeclined, time.Now().UTC(), invitationID)
+	if err != nil {
+		return fmt.Errorf("decline invitation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// JoinInvitedProjects accepts every pending invitation sent to the email
+// address of a user, once they have proven they own it
+func (r *userRepoImpl) JoinInvitedProjects(ctx context.Context, userID int) ([]int, error) {
+	invitations, err := queryInvitations(ctx, r.db, `
+		JOIN users me ON LOWER(me.email) = LOWER(i.email)
+		WHERE me.id = $1 AND i.status = $2 AND i.expires_at > $3 AND p.deleted_at IS NULL
+		ORDER BY i.id
+	`, userID, models.InvitationPending, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	joined := make([]int, 0, len(invitations))
+	for _, inv := range invitations {
+		if err := joinProject(ctx, tx, userID, inv); err != nil {
+			return nil, err
+		}
+		joined = append(joined, inv.ProjectID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return joined, nil
+}
+
+// invitationForUser loads a pending invitation and checks that userID may
+// respond to it
+func invitationForUser(ctx context.Context, tx *sql.Tx, userID, invitationID int, byToken bool) (models.ProjectInvitation, error) {
+	inv, err := scanInvitation(tx.QueryRowContext(ctx, invitationQuery+`
+		WHERE i.id = $1 AND i.status = $2 AND i.expires_at > $3 AND p.deleted_at IS NULL
+	`, invitationID, models.InvitationPending, time.Now().UTC()))
+	if err != nil {
+		return inv, fmt.Errorf("get invitation: %w", err)
+	}
+	if inv.Email == nil {
+		return inv, nil
+	}
+
+	var email string
+	var verified bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT email, email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID,
+	).Scan(&email, &verified)
+	if err != nil {
+		return inv, fmt.Errorf("get user: %w", err)
+	}
+	if !strings.EqualFold(email, *inv.Email) {
+		return inv, ErrInvitationNotForUser
+	}
+	if !byToken && !verified {
+		return inv, ErrEmailNotVerified
+	}
+	return inv, nil
+}
+
+// joinProject adds userID to the project of an invitation and to its
+// organization, keeping the role of existing members, and closes email
+// invitations
+func joinProject(ctx context.Context, tx *sql.Tx, userID int, inv models.ProjectInvitation) error {
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO project_members (project_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, user_id) DO NOTHING
+	`, inv.ProjectID, userID, inv.Role)
+	if err != nil {
+		return fmt.Errorf("join project: %w", err)
+	}
+
+	// Project members always belong to the organization of the project
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO organization_members (org_id, user_id, role)
+		SELECT org_id, CAST($1 AS INTEGER), $2 FROM projects WHERE id = $3 AND org_id IS NOT NULL
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`, userID, authz.OrgMember, inv.ProjectID)
+	if err != nil {
+		return fmt.Errorf("join organization: %w", err)
+	}
+
+	if inv.Email != nil {
+		_, err = tx.ExecContext(ctx,
+			`UPDATE project_invitations SET status = $1, responded_at = $2 WHERE id = $3`,
+			models.InvitationAccepted, time.Now().UTC(), inv.ID)
+		if err != nil {
+			return fmt.Errorf("accept invitation: %w", err)
+		}
+	}
+
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	return recordAudit(ctx, tx, models.ProjectAuditEntry{
+		ProjectID:    inv.ProjectID,
+		ActorID:      &userID,
+		Action:       models.AuditMemberJoined,
+		TargetUserID: inv.InviterID,
+		Details:      fmt.Sprintf("joined as %s through invitation %d", inv.Role, inv.ID),
+	})
+}
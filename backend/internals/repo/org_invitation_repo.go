@@ -0,0 +1,212 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+var ErrAlreadyInvitedToOrg = errors.New("user already has a pending invitation to the organization")
+
+// orgInvitationQuery selects the columns scanned by scanOrgInvitation
+const orgInvitationQuery = `
+	SELECT i.id, i.org_id, o.name, i.inviter_id, COALESCE(inv.name, ''),
+	       u.id, u.username, u.name, u.email,
+	       i.role, i.status, i.created_at, i.expires_at, i.responded_at
+	FROM organization_invitations i
+	JOIN organizations o ON o.id = i.org_id
+	JOIN users u ON u.id = i.user_id
+	LEFT JOIN users inv ON inv.id = i.inviter_id
+`
+
+func scanOrgInvitation(row rowScanner) (models.OrgInvitation, error) {
+	var inv models.OrgInvitation
+	var inviterID sql.NullInt64
+	var respondedAt sql.NullTime
+	err := row.Scan(&inv.ID, &inv.OrgID, &inv.OrgName, &inviterID, &inv.InviterName,
+		&inv.UserID, &inv.Username, &inv.Name, &inv.Email,
+		&inv.Role, &inv.Status, &inv.CreatedAt, &inv.ExpiresAt, &respondedAt)
+	inv.InviterID = nullIntPtr(inviterID)
+	inv.RespondedAt = nullTimePtr(respondedAt)
+	return inv, err
+}
+
+func queryOrgInvitations(ctx context.Context, db *sql.DB, where string, args ...any) ([]models.OrgInvitation, error) {
+	rows, err := db.QueryContext(ctx, orgInvitationQuery+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list organization invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := make([]models.OrgInvitation, 0)
+	for rows.Next() {
+		inv, err := scanOrgInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// InviteOrgMember invites a user to an organization. They only become a
+// member, and visible to the other members, once they accept.
+func (r *orgRepoImpl) InviteOrgMember(ctx context.Context, userID, orgID int, username string, role authz.OrgRole, expiresAt time.Time) (models.OrgInvitation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.OrgInvitation{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.AuthorizeOrg(ctx, tx, userID, orgID, true); err != nil {
+		return models.OrgInvitation{}, err
+	}
+
+	var inviteeID int
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM users WHERE username = $1 AND deleted_at IS NULL`, username,
+	).Scan(&inviteeID)
+	if err != nil {
+		return models.OrgInvitation{}, fmt.Errorf("user not found: %w", err)
+	}
+	if _, err := authz.OrgMemberRole(ctx, tx, inviteeID, orgID); err == nil {
+		return models.OrgInvitation{}, ErrAlreadyOrgMember
+	} else if !errors.Is(err, authz.ErrNotOrgMember) {
+		return models.OrgInvitation{}, err
+	}
+
+	now := time.Now().UTC()
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_invitations
+			WHERE org_id = $1 AND user_id = $2 AND status = $3 AND expires_at > $4
+		)
+	`, orgID, inviteeID, models.InvitationPending, now).Scan(&exists)
+	if err != nil {
+		return models.OrgInvitation{}, fmt.Errorf("invitation check failed: %w", err)
+	}
+	if exists {
+		return models.OrgInvitation{}, ErrAlreadyInvitedToOrg
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO organization_invitations (org_id, inviter_id, user_id, role, status, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, orgID, userID, inviteeID, role, models.InvitationPending, now, expiresAt).Scan(&id)
+	if err != nil {
+		return models.OrgInvitation{}, fmt.Errorf("create organization invitation: %w", err)
+	}
+
+	inv, err := scanOrgInvitation(tx.QueryRowContext(ctx, orgInvitationQuery+`WHERE i.id = $1`, id))
+	if err != nil {
+		return inv, fmt.Errorf("get organization invitation: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return inv, fmt.Errorf("commit transaction: %w", err)
+	}
+	return inv, nil
+}
+
+// ListOrgInvitations returns every invitation of an organization, newest
+// first
+func (r *orgRepoImpl) ListOrgInvitations(ctx context.Context, userID, orgID int) ([]models.OrgInvitation, error) {
+	if _, err := authz.AuthorizeOrg(ctx, r.db, userID, orgID, true); err != nil {
+		return nil, err
+	}
+	return queryOrgInvitations(ctx, r.db, `WHERE i.org_id = $1 ORDER BY i.created_at DESC, i.id DESC`, orgID)
+}
+
+// RevokeOrgInvitation withdraws a pending invitation to an organization
+func (r *orgRepoImpl) RevokeOrgInvitation(ctx context.Context, userID, orgID, invitationID int) error {
+	if _, err := authz.AuthorizeOrg(ctx, r.db, userID, orgID, true); err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE organization_invitations SET status = $1, responded_at = $2
+		WHERE id = $3 AND org_id = $4 AND status = $5
+	`, models.InvitationRevoked, time.Now().UTC(), invitationID, orgID, models.InvitationPending)
+	if err != nil {
+		return fmt.Errorf("revoke organization invitation: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListOrgInvitationsForUser returns the pending invitations of a user to
+// organizations
+func (r *orgRepoImpl) ListOrgInvitationsForUser(ctx context.Context, userID int) ([]models.OrgInvitation, error) {
+	return queryOrgInvitations(ctx, r.db, `
+		WHERE i.user_id = $1 AND i.status = $2 AND i.expires_at > $3
+		ORDER BY i.created_at DESC, i.id DESC
+	`, userID, models.InvitationPending, time.Now().UTC())
+}
+
+// AcceptOrgInvitation makes a user a member of the organization they were
+// invited to, with the role of the invitation
+func (r *orgRepoImpl) AcceptOrgInvitation(ctx context.Context, userID, invitationID int) (models.OrgInvitation, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.OrgInvitation{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	inv, err := scanOrgInvitation(tx.QueryRowContext(ctx, orgInvitationQuery+`
+		WHERE i.id = $1 AND i.user_id = $2 AND i.status = $3 AND i.expires_at > $4
+	`, invitationID, userID, models.InvitationPending, time.Now().UTC()))
+	if err != nil {
+		return inv, fmt.Errorf("get organization invitation: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)
+		ON CONFLICT (org_id, user_id) DO NOTHING
+	`, inv.OrgID, userID, inv.Role)
+	if err != nil {
+		return inv, fmt.Errorf("join organization: %w", err)
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.ExecContext(ctx,
+		`UPDATE organization_invitations SET status = $1, responded_at = $2 WHERE id = $3`,
+		models.InvitationAccepted, now, inv.ID)
+	if err != nil {
+		return inv, fmt.Errorf("accept organization invitation: %w", err)
+	}
+	inv.Status = models.InvitationAccepted
+	inv.RespondedAt = &now
+
+	if err := tx.Commit(); err != nil {
+		return inv, fmt.Errorf("commit transaction: %w", err)
+	}
+	return inv, nil
+}
+
+// DeclineOrgInvitation turns down an invitation to an organization
+func (r *orgRepoImpl) DeclineOrgInvitation(ctx context.Context, userID, invitationID int) error {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE organization_invitations SET status = $1, responded_at = $2
+		WHERE id = $3 AND user_id = $4 AND status = $5 AND expires_at > $6
+	`, models.InvitationDeclined, now, invitationID, userID, models.InvitationPending, now)
+	if err != nil {
+		return fmt.Errorf("decline organization invitation: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,340 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+)
+
+var (
+	ErrAlreadyOrgMember = errors.New("user is already a member of the organization")
+	ErrLastOrgAdmin     = errors.New("an organization needs at least one admin")
+	ErrPersonalOrgOwner = errors.New("the owner of a personal organization cannot leave it")
+	ErrOrgProjectOwner  = errors.New("the member owns projects of the organization, transfer them first")
+)
+
+type orgRepoImpl struct {
+	db *sql.DB
+}
+
+// orgQuery selects the columns scanned by scanOrg for the user in $1
+const orgQuery = `
+	SELECT o.id, o.name, o.personal_owner_id IS NOT NULL, o.default_role, o.created_at, om.role
+	FROM organizations o
+	JOIN organization_members om ON om.org_id = o.id AND om.user_id = $1
+`
+
+func scanOrg(row rowScanner) (models.Organization, error) {
+	var o models.Organization
+	err := row.Scan(&o.ID, &o.Name, &o.Personal, &o.DefaultRole, &o.CreatedAt, &o.Role)
+	return o, err
+}
+
+// createPersonalOrg gives a new user the organization their projects go to
+// by default
+func createPersonalOrg(ctx context.Context, tx *sql.Tx, userID int, name string) error {
+	var orgID int
+	err := tx.QueryRowContext(ctx,
+		`INSERT INTO organizations (name, personal_owner_id) VALUES ($1, $2) RETURNING id`,
+		name+"'s workspace", userID,
+	).Scan(&orgID)
+	if err != nil {
+		return fmt.Errorf("create personal organization: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)`,
+		orgID, userID, authz.OrgAdmin)
+	if err != nil {
+		return fmt.Errorf("add personal organization member: %w", err)
+	}
+	return nil
+}
+
+// projectOrg returns the organization a new project of userID goes to, the
+// personal one when orgID is zero
+func projectOrg(ctx context.Context, q authz.Querier, userID, orgID int) (int, error) {
+	if orgID != 0 {
+		_, err := authz.AuthorizeOrg(ctx, q, userID, orgID, false)
+		return orgID, err
+	}
+	err := q.QueryRowContext(ctx,
+		`SELECT id FROM organizations WHERE personal_owner_id = $1`, userID,
+	).Scan(&orgID)
+	if err != nil {
+		return 0, fmt.Errorf("get personal organization: %w", err)
+	}
+	return orgID, nil
+}
+
+// defaultMemberRole returns the role new members of a project get when none
+// is asked for, as configured on its organization
+func defaultMemberRole(ctx context.Context, q authz.Querier, projectID int) (authz.Role, error) {
+	var role authz.Role
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(o.default_role, $1)
+		FROM projects p
+		LEFT JOIN organizations o ON o.id = p.org_id
+		WHERE p.id = $2
+	`, authz.DefaultRole, projectID).Scan(&role)
+	if err != nil {
+		return "", fmt.Errorf("get default role: %w", err)
+	}
+	return role, nil
+}
+
+// CreateOrganization creates an organization with userID as its admin
+func (r *orgRepoImpl) CreateOrganization(ctx context.Context, userID int, name string, defaultRole authz.Role) (models.Organization, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var orgID int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO organizations (name, default_role) VALUES ($1, $2) RETURNING id`,
+		name, defaultRole,
+	).Scan(&orgID)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("create organization: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO organization_members (org_id, user_id, role) VALUES ($1, $2, $3)`,
+		orgID, userID, authz.OrgAdmin)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("add organization admin: %w", err)
+	}
+
+	org, err := scanOrg(tx.QueryRowContext(ctx, orgQuery+`WHERE o.id = $2`, userID, orgID))
+	if err != nil {
+		return org, fmt.Errorf("get organization: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return org, fmt.Errorf("commit transaction: %w", err)
+	}
+	return org, nil
+}
+
+// ListOrganizations returns the organizations of a user, the personal one
+// first
+func (r *orgRepoImpl) ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, orgQuery+`
+		ORDER BY o.personal_owner_id IS NULL, LOWER(o.name), o.id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := make([]models.Organization, 0)
+	for rows.Next() {
+		org, err := scanOrg(rows)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetOrganization returns an organization and its members
+func (r *orgRepoImpl) GetOrganization(ctx context.Context, userID, orgID int) (models.OrganizationDetail, error) {
+	var detail models.OrganizationDetail
+
+	org, err := scanOrg(r.db.QueryRowContext(ctx, orgQuery+`WHERE o.id = $2`, userID, orgID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return detail, authz.ErrNotOrgMember
+	}
+	if err != nil {
+		return detail, fmt.Errorf("get organization: %w", err)
+	}
+	detail.Organization = org
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.name, u.username, u.email, u.avatar_url, om.role
+		FROM organization_members om
+		JOIN users u ON u.id = om.user_id
+		WHERE om.org_id = $1
+		ORDER BY om.role, LOWER(u.name), u.id
+	`, orgID)
+	if err != nil {
+		return detail, fmt.Errorf("list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	detail.Members = make([]models.OrganizationMember, 0)
+	for rows.Next() {
+		var m models.OrganizationMember
+		if err := rows.Scan(&m.ID, &m.Name, &m.Username, &m.Email, &m.AvatarUrl, &m.Role); err != nil {
+			return detail, err
+		}
+		detail.Members = append(detail.Members, m)
+	}
+	return detail, rows.Err()
+}
+
+// UpdateOrganization changes the name or default role of an organization
+func (r *orgRepoImpl) UpdateOrganization(ctx context.Context, userID, orgID int, name *string, defaultRole *authz.Role) (models.Organization, error) {
+	if _, err := authz.AuthorizeOrg(ctx, r.db, userID, orgID, true); err != nil {
+		return models.Organization{}, err
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE organizations
+		SET name = COALESCE($1, name), default_role = COALESCE($2, default_role)
+		WHERE id = $3
+	`, name, defaultRole, orgID)
+	if err != nil {
+		return models.Organization{}, fmt.Errorf("update organization: %w", err)
+	}
+
+	org, err := scanOrg(r.db.QueryRowContext(ctx, orgQuery+`WHERE o.id = $2`, userID, orgID))
+	if err != nil {
+		return org, fmt.Errorf("get organization: %w", err)
+	}
+	return org, nil
+}
+
+// ChangeOrgMemberRole changes the role of an organization member, keeping
+// at least one admin
+func (r *orgRepoImpl) ChangeOrgMemberRole(ctx context.Context, userID, orgID, memberID int, role authz.OrgRole) (models.OrganizationMember, error) {
+	m := models.OrganizationMember{Role: string(role)}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return m, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.AuthorizeOrg(ctx, tx, userID, orgID, true); err != nil {
+		return m, err
+	}
+	current, err := authz.OrgMemberRole(ctx, tx, memberID, orgID)
+	if errors.Is(err, authz.ErrNotOrgMember) {
+		return m, fmt.Errorf("member not found: %w", sql.ErrNoRows)
+	}
+	if err != nil {
+		return m, err
+	}
+	if current == authz.OrgAdmin && role != authz.OrgAdmin {
+		if err := ensureOtherAdmin(ctx, tx, orgID, memberID); err != nil {
+			return m, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE organization_members SET role = $1 WHERE org_id = $2 AND user_id = $3`,
+		role, orgID, memberID)
+	if err != nil {
+		return m, fmt.Errorf("change organization role: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`SELECT id, name, username, email, avatar_url FROM users WHERE id = $1`, memberID,
+	).Scan(&m.ID, &m.Name, &m.Username, &m.Email, &m.AvatarUrl)
+	if err != nil {
+		return m, fmt.Errorf("get member: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return m, fmt.Errorf("commit transaction: %w", err)
+	}
+	return m, nil
+}
+
+// RemoveOrgMember removes a member from an organization, its teams and its
+// projects, since project members always belong to the organization of the
+// project. Admins remove anyone and members may leave, as long as an admin
+// is left and the member owns none of its projects.
+func (r *orgRepoImpl) RemoveOrgMember(ctx context.Context, userID, orgID, memberID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.AuthorizeOrg(ctx, tx, userID, orgID, memberID != userID); err != nil {
+		return err
+	}
+	current, err := authz.OrgMemberRole(ctx, tx, memberID, orgID)
+	if errors.Is(err, authz.ErrNotOrgMember) {
+		return fmt.Errorf("member not found: %w", sql.ErrNoRows)
+	}
+	if err != nil {
+		return err
+	}
+
+	var personal bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM organizations WHERE id = $1 AND personal_owner_id = $2)`,
+		orgID, memberID,
+	).Scan(&personal)
+	if err != nil {
+		return fmt.Errorf("get organization: %w", err)
+	}
+	if personal {
+		return ErrPersonalOrgOwner
+	}
+	if current == authz.OrgAdmin {
+		if err := ensureOtherAdmin(ctx, tx, orgID, memberID); err != nil {
+			return err
+		}
+	}
+
+	var owner bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM projects
+			WHERE org_id = $1 AND owner_id = $2 AND deleted_at IS NULL
+		)
+	`, orgID, memberID).Scan(&owner)
+	if err != nil {
+		return fmt.Errorf("ownership check failed: %w", err)
+	}
+	if owner {
+		return ErrOrgProjectOwner
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM organization_members WHERE org_id = $1 AND user_id = $2`, orgID, memberID)
+	if err != nil {
+		return fmt.Errorf("remove organization member: %w", err)
+	}
+	if err := leaveOrgTeams(ctx, tx, orgID, memberID); err != nil {
+		return err
+	}
+	// Owners keep their role in deleted projects, which nobody can open
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM project_members
+		WHERE project_id IN (SELECT id FROM projects WHERE org_id = $1) AND user_id = $2 AND role <> $3
+	`, orgID, memberID, authz.RoleOwner)
+	if err != nil {
+		return fmt.Errorf("leave projects: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ensureOtherAdmin fails unless the organization has an admin besides userID
+func ensureOtherAdmin(ctx context.Context, tx *sql.Tx, orgID, userID int) error {
+	var others bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_members
+			WHERE org_id = $1 AND user_id <> $2 AND role = $3
+		)
+	`, orgID, userID, authz.OrgAdmin).Scan(&others)
+	if err != nil {
+		return fmt.Errorf("admin check failed: %w", err)
+	}
+	if !others {
+		return ErrLastOrgAdmin
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/models"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrUsernameTaken is returned when another account already uses the username
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// isUniqueViolation reports whether err comes from a UNIQUE constraint of
+// either database
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+// GetPasswordHash returns the stored password hash of a user
+func (r *userRepoImpl) GetPasswordHash(ctx context.Context, userID int) (string, error) {
+	var hashed string
+	err := r.db.QueryRowContext(ctx, `SELECT password FROM users WHERE id = $1`, userID).Scan(&hashed)
+	if err != nil {
+		return "", fmt.Errorf("failed to get password hash: %w", err)
+	}
+	return hashed, nil
+}
+
+// GetProfile fetches a user together with their account status
+func (r *userRepoImpl) GetProfile(ctx context.Context, userID int) (*models.UserProfile, error) {
+	query := `
+	SELECT id, name, username, email, avatar_url, email_verified_at IS NOT NULL, pending_email, totp_enabled, is_admin
+	FROM users
+	WHERE id = $1
+	`
+	var p models.UserProfile
+	var pendingEmail sql.NullString
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&p.ID, &p.Name, &p.Username, &p.Email, &p.AvatarUrl, &p.EmailVerified, &pendingEmail, &p.MFAEnabled, &p.IsAdmin,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get profile: %w", err)
+	}
+	if pendingEmail.Valid {
+		p.PendingEmail = &pendingEmail.String
+	}
+	return &p, nil
+}
+
+// UpdateProfile changes the name, username and avatar of a user, or returns
+// ErrUsernameTaken when another account took the username first
+func (r *userRepoImpl) UpdateProfile(ctx context.Context, user models.User) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET name = $1, username = $2, avatar_url = $3 WHERE id = $4`,
+		user.Name, user.Username, user.AvatarUrl, user.ID,
+	)
+	if isUniqueViolation(err) {
+		return ErrUsernameTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update profile: %w", err)
+	}
+	return nil
+}
+
+// SetPendingEmail records an email address the user wants to switch to once
+// they have confirmed it
+func (r *userRepoImpl) SetPendingEmail(ctx context.Context, userID int, email string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE users SET pending_email = $1 WHERE id = $2`, email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+	return nil
+}
+
+// ConfirmPendingEmail makes the pending email address of a user their
+// verified address and returns it
+func (r *userRepoImpl) ConfirmPendingEmail(ctx context.Context, userID int) (string, error) {
+	query := `
+	UPDATE users
+	SET email = pending_email, pending_email = NULL, email_verified_at = $1
+	WHERE id = $2 AND pending_email IS NOT NULL
+	RETURNING email
+	`
+	var email string
+	err := r.db.QueryRowContext(ctx, query, time.Now().UTC(), userID).Scan(&email)
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm pending email: %w", err)
+	}
+	return email, nil
+}
@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+// execer is satisfied by *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// recordAudit appends an entry to the audit log of a project, usually in
+// the transaction of the change it records
+func recordAudit(ctx context.Context, db execer, entry models.ProjectAuditEntry) error {
+	query := `
+		INSERT INTO project_audit_log (project_id, actor_id, action, target_user_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := db.ExecContext(ctx, query,
+		entry.ProjectID, entry.ActorID, entry.Action, entry.TargetUserID, entry.Details, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("record audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the audit log of a project, newest first
+func (r *projectRepoImpl) GetAuditLog(ctx context.Context, currentUserID, projectID, limit int) ([]models.ProjectAuditEntry, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditProject); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, project_id, actor_id, action, target_user_id, details, created_at
+		FROM project_audit_log
+		WHERE project_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, projectID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("get audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]models.ProjectAuditEntry, 0)
+	for rows.Next() {
+		var e models.ProjectAuditEntry
+		var actorID, targetUserID sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.ProjectID, &actorID, &e.Action, &targetUserID, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ActorID = nullIntPtr(actorID)
+		e.TargetUserID = nullIntPtr(targetUserID)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func nullIntPtr(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
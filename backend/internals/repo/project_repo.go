@@ -3,69 +3,85 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"task-matrix-be/internals/authz"
 	"task-matrix-be/internals/models"
+	"time"
 )
 
 type projectRepoImpl struct {
 	db *sql.DB
 }
 
-// CreateProject inserts a new project with currentUserID as the owner
-func (r *projectRepoImpl) CreateProject(ctx context.Context, currentUserID int, name, description, dueDate string) (int, error) {
+// CreateProject inserts a new project with currentUserID as the owner into
+// an organization they belong to, their personal one when orgID is zero
+func (r *projectRepoImpl) CreateProject(ctx context.Context, currentUserID, orgID int, name, description, dueDate string) (int, int, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("begin transaction: %w", err)
+		return 0, 0, fmt.Errorf("begin transaction: %w", err)
+	}
+
+	orgID, err = projectOrg(ctx, tx, currentUserID, orgID)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
 	}
 
 	insertProjectQuery := `
-		INSERT INTO projects (owner_id, title, description, due_date)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO projects (owner_id, org_id, title, description, due_date)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
 	`
 	var projectID int
-	err = tx.QueryRowContext(ctx, insertProjectQuery, currentUserID, name, description, dueDate).Scan(&projectID)
+	err = tx.QueryRowContext(ctx, insertProjectQuery, currentUserID, orgID, name, description, dueDate).Scan(&projectID)
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("insert project: %w", err)
+		return 0, 0, fmt.Errorf("insert project: %w", err)
 	}
 
 	insertMemberQuery := `
-		INSERT INTO project_members (project_id, user_id)
-		VALUES ($1, $2)
+		INSERT INTO project_members (project_id, user_id, role)
+		VALUES ($1, $2, $3)
 	`
-	_, err = tx.ExecContext(ctx, insertMemberQuery, projectID, currentUserID)
+	_, err = tx.ExecContext(ctx, insertMemberQuery, projectID, currentUserID, authz.RoleOwner)
 	if err != nil {
 		tx.Rollback()
-		return 0, fmt.Errorf("insert project member: %w", err)
+		return 0, 0, fmt.Errorf("insert project member: %w", err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return 0, fmt.Errorf("commit transaction: %w", err)
+		return 0, 0, fmt.Errorf("commit transaction: %w", err)
 	}
 
-	return projectID, nil
+	return projectID, orgID, nil
 }
 
-// GetProjects returns all projects the user owns or is a member of
-func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID int) ([]models.Project, error) {
+// GetProjects returns all projects the user owns or is a member of, only
+// those of one organization unless orgID is zero. With leafTasksOnly the
+// task counters leave out the tasks that have subtasks.
+func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID, orgID int, leafTasksOnly bool) ([]models.Project, error) {
+	counted := ""
+	if leafTasksOnly {
+		counted = " AND NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_task_id = t.id)"
+	}
 	query := `
 		SELECT
-			p.id, p.title, p.description, p.due_date,
+			p.id, COALESCE(p.org_id, 0), p.title, p.description, p.due_date,
 			s.id, s.name,
 			u.id, u.name, u.username, u.email, u.avatar_url,
-			(SELECT COUNT(*) FROM tasks t WHERE t.project_id = p.id) as total_tasks,
-			(SELECT COUNT(*) FROM tasks t JOIN statuses st ON t.status_id = st.id WHERE t.project_id = p.id AND st.name = 'Completed') as tasks_completed
+			(SELECT COUNT(*) FROM tasks t WHERE t.project_id = p.id` + counted + `) as total_tasks,
+			(SELECT COUNT(*) FROM tasks t JOIN statuses st ON t.status_id = st.id WHERE t.project_id = p.id AND st.name = 'Completed'` + counted + `) as tasks_completed
 		FROM projects p
 		JOIN statuses s ON s.id = p.status_id
 		JOIN users u ON u.id = p.owner_id
-		LEFT JOIN project_members pm ON pm.project_id = p.id
-		WHERE p.deleted_at IS NULL AND pm.user_id = $1  AND p.deleted_at IS NULL
-		GROUP BY p.id, s.id, u.id
+		WHERE p.deleted_at IS NULL
+		  AND p.id IN (` + visibleProjectIDs("$1") + `)
+		  AND ($2 = 0 OR p.org_id = $2)
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, currentUserID)
+	rows, err := r.db.QueryContext(ctx, query, currentUserID, orgID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +92,7 @@ func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID int) ([
 	for rows.Next() {
 		var p models.Project
 		err := rows.Scan(
-			&p.ID, &p.Name, &p.Description, &p.DueDate,
+			&p.ID, &p.OrgID, &p.Name, &p.Description, &p.DueDate,
 			&p.Status.ID, &p.Status.Name,
 			&p.Owner.ID, &p.Owner.Name, &p.Owner.Username, &p.Owner.Email, &p.Owner.AvatarUrl,
 			&p.TotalTasks, &p.TasksCompleted,
@@ -84,7 +100,7 @@ func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID int) ([
 		if err != nil {
 			return nil, err
 		}
-		p.Members = make([]models.User, 0, 1)
+		p.Members = make([]models.ProjectMember, 0, 1)
 		projectMap[p.ID] = &p
 		projects = append(projects, p)
 	}
@@ -101,7 +117,7 @@ func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID int) ([
 	memberQuery := `
 		SELECT
 			pm.project_id,
-			u.id, u.name, u.username, u.email, u.avatar_url
+			u.id, u.name, u.username, u.email, u.avatar_url, pm.role
 		FROM project_members pm
 		JOIN users u ON u.id = pm.user_id
 		WHERE pm.project_id IN (` + placeholders(len(projectIDs)) + `)
@@ -115,12 +131,12 @@ func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID int) ([
 
 	for memberRows.Next() {
 		var projectID int
-		var user models.User
-		if err := memberRows.Scan(&projectID, &user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl); err != nil {
+		var m models.ProjectMember
+		if err := memberRows.Scan(&projectID, &m.ID, &m.Name, &m.Username, &m.Email, &m.AvatarUrl, &m.Role); err != nil {
 			return nil, err
 		}
 		if project, exists := projectMap[projectID]; exists {
-			project.Members = append(project.Members, user)
+			project.Members = append(project.Members, m)
 		}
 	}
 
@@ -136,8 +152,19 @@ func (r *projectRepoImpl) GetProjects(ctx context.Context, currentUserID int) ([
 func (r *projectRepoImpl) GetProjectByID(ctx context.Context, currentUserID, projectID int) (models.ProjectDetail, error) {
 	var pd models.ProjectDetail
 
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ViewProject); err != nil {
+		return pd, err
+	}
+	return r.projectDetail(ctx, projectID)
+}
+
+// projectDetail loads a project with its members, teams and tasks, leaving
+// the access checks to the caller
+func (r *projectRepoImpl) projectDetail(ctx context.Context, projectID int) (models.ProjectDetail, error) {
+	var pd models.ProjectDetail
+
 	projectQuery := `
-		SELECT p.id, p.title, p.description, p.due_date,
+		SELECT p.id, COALESCE(p.org_id, 0), p.title, p.description, p.due_date,
 		       s.id, s.name,
 		       u.id, u.name, u.username, u.email, u.avatar_url
 		FROM projects p
@@ -146,7 +173,7 @@ func (r *projectRepoImpl) GetProjectByID(ctx context.Context, currentUserID, pro
 		WHERE p.id = $1 AND p.deleted_at IS NULL
 	`
 	err := r.db.QueryRowContext(ctx, projectQuery, projectID).Scan(
-		&pd.ID, &pd.Name, &pd.Description, &pd.DueDate,
+		&pd.ID, &pd.OrgID, &pd.Name, &pd.Description, &pd.DueDate,
 		&pd.Status.ID, &pd.Status.Name,
 		&pd.Owner.ID, &pd.Owner.Name, &pd.Owner.Username, &pd.Owner.Email, &pd.Owner.AvatarUrl,
 	)
@@ -155,7 +182,7 @@ func (r *projectRepoImpl) GetProjectByID(ctx context.Context, currentUserID, pro
 	}
 
 	membersQuery := `
-		SELECT u.id, u.name, u.username, u.email, u.avatar_url
+		SELECT u.id, u.name, u.username, u.email, u.avatar_url, pm.role
 		FROM project_members pm
 		JOIN users u ON u.id = pm.user_id
 		WHERE pm.project_id = $1
@@ -167,37 +194,45 @@ func (r *projectRepoImpl) GetProjectByID(ctx context.Context, currentUserID, pro
 	defer memberRows.Close()
 
 	for memberRows.Next() {
-		var u models.User
-		if err := memberRows.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.AvatarUrl); err != nil {
+		var m models.ProjectMember
+		if err := memberRows.Scan(&m.ID, &m.Name, &m.Username, &m.Email, &m.AvatarUrl, &m.Role); err != nil {
 			return pd, err
 		}
-		pd.Members = append(pd.Members, u)
+		pd.Members = append(pd.Members, m)
 	}
 
-	tasksQuery := `
-		SELECT t.id, t.title, t.description,
-		       p.id, p.name,
-		       s.id, s.name,
-		       u.id, u.name, u.username, u.email, u.avatar_url
-		FROM tasks t
-		JOIN priorities p ON p.id = t.priority_id
-		JOIN statuses s ON s.id = t.status_id
-		JOIN users u ON u.id = t.assignee_id
-		WHERE t.project_id = $1
+	teamsQuery := `
+		SELECT t.id, t.name,
+		       (SELECT COUNT(*) FROM team_members tm WHERE tm.team_id = t.id),
+		       pt.role
+		FROM project_teams pt
+		JOIN teams t ON t.id = pt.team_id
+		WHERE pt.project_id = $1
+		ORDER BY LOWER(t.name), t.id
 	`
-	taskRows, err := r.db.QueryContext(ctx, tasksQuery, projectID)
+	teamRows, err := r.db.QueryContext(ctx, teamsQuery, projectID)
+	if err != nil {
+		return pd, err
+	}
+	defer teamRows.Close()
+
+	pd.Teams = make([]models.ProjectTeam, 0)
+	for teamRows.Next() {
+		var t models.ProjectTeam
+		if err := teamRows.Scan(&t.ID, &t.Name, &t.MemberCount, &t.Role); err != nil {
+			return pd, err
+		}
+		pd.Teams = append(pd.Teams, t)
+	}
+
+	taskRows, err := r.db.QueryContext(ctx, taskQuery+`WHERE t.project_id = $1 ORDER BY t.id`, projectID)
 	if err != nil {
 		return pd, err
 	}
 	defer taskRows.Close()
 
 	for taskRows.Next() {
-		var t models.Task
-		err := taskRows.Scan(&t.ID, &t.Title, &t.Description,
-			&t.Priority.ID, &t.Priority.Name,
-			&t.Status.ID, &t.Status.Name,
-			&t.Assignee.ID, &t.Assignee.Name, &t.Assignee.Username, &t.Assignee.Email, &t.Assignee.AvatarUrl,
-		)
+		t, err := scanTask(taskRows)
 		if err != nil {
 			return pd, err
 		}
@@ -207,19 +242,23 @@ func (r *projectRepoImpl) GetProjectByID(ctx context.Context, currentUserID, pro
 	return pd, nil
 }
 
-// UpdateProjectByID updates a project if the user is the owner
+// UpdateProjectByID updates a project if the user's role allows it
 func (r *projectRepoImpl) UpdateProjectByID(ctx context.Context, currentUserID, projectID int, name, description, dueDate string, statusId int) (models.Project, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditProject); err != nil {
+		return models.Project{}, err
+	}
+
 	query := `
 		UPDATE projects
 		SET title = $1, description = $2, due_date = $3, status_id = $4
-		WHERE id = $5 AND owner_id = $6;
+		WHERE id = $5;
 	`
-	_, err := r.db.ExecContext(ctx, query, name, description, dueDate, statusId, projectID, currentUserID)
+	_, err := r.db.ExecContext(ctx, query, name, description, dueDate, statusId, projectID)
 	if err != nil {
 		return models.Project{}, fmt.Errorf("update project: %w", err)
 	}
 
-	projects, err := r.GetProjects(ctx, currentUserID)
+	projects, err := r.GetProjects(ctx, currentUserID, 0, false)
 	if err != nil {
 		return models.Project{}, err
 	}
@@ -231,47 +270,81 @@ func (r *projectRepoImpl) UpdateProjectByID(ctx context.Context, currentUserID,
 	return models.Project{}, sql.ErrNoRows
 }
 
-// AddMemberToProject adds a user to the project by username
-func (r *projectRepoImpl) AddMemberToProject(ctx context.Context, currentUserID, projectID int, username string) (models.User, error) {
-	var u models.User
+// InviteUserToProject invites a user by username, with an email invitation
+// to the address of their account. Users only join once they accept it, the
+// role has to be below the role of the current user.
+func (r *projectRepoImpl) InviteUserToProject(ctx context.Context, currentUserID, projectID int, username string, role authz.Role, tokenHash string, expiresAt time.Time) (models.ProjectInvitation, error) {
+	// Checked first so that usernames cannot be probed through any project
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ManageMembers); err != nil {
+		return models.ProjectInvitation{}, err
+	}
+
+	var userID int
+	var email string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, email FROM users WHERE username = $1 AND deleted_at IS NULL`, username,
+	).Scan(&userID, &email)
+	if err != nil {
+		return models.ProjectInvitation{}, fmt.Errorf("user not found: %w", err)
+	}
 
-	var ownerID int
-	err := r.db.QueryRowContext(ctx, `SELECT owner_id FROM projects WHERE id = $1`, projectID).Scan(&ownerID)
+	return r.createInvitation(ctx, currentUserID, projectID, &email, &userID, role, tokenHash, expiresAt)
+}
+
+// ChangeMemberRole changes the role of a member. Both the current and the
+// new role of the member have to be below the role of the current user,
+// except for the owner who can appoint admins.
+func (r *projectRepoImpl) ChangeMemberRole(ctx context.Context, currentUserID, projectID, userID int, role authz.Role) (models.ProjectMember, error) {
+	var m models.ProjectMember
+
+	actor, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ManageMembers)
+	if err != nil {
+		return m, err
+	}
+	current, err := authz.DirectRole(ctx, r.db, userID, projectID)
+	if errors.Is(err, authz.ErrNotMember) {
+		return m, fmt.Errorf("member not found: %w", sql.ErrNoRows)
+	}
 	if err != nil {
-		return u, fmt.Errorf("project not found or fetch failed: %w", err)
+		return m, err
 	}
-	if ownerID != currentUserID {
-		return u, fmt.Errorf("permission denied: user is not the owner of the project")
+	if !authz.CanManage(actor, current) || !authz.CanManage(actor, role) {
+		return m, fmt.Errorf("%w: %s cannot change %s to %s", authz.ErrForbidden, actor, current, role)
 	}
 
 	query := `
-		SELECT id, name, username, email, avatar_url FROM users WHERE username = $1
+		UPDATE project_members SET role = $1
+		WHERE project_id = $2 AND user_id = $3
 	`
-	err = r.db.QueryRowContext(ctx, query, username).Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.AvatarUrl)
-	if err != nil {
-		return u, fmt.Errorf("user not found: %w", err)
+	if _, err := r.db.ExecContext(ctx, query, role, projectID, userID); err != nil {
+		return m, fmt.Errorf("change member role: %w", err)
 	}
 
-	_, err = r.db.ExecContext(ctx, `INSERT INTO project_members (project_id, user_id) VALUES ($1, $2)`, projectID, u.ID)
+	err = r.db.QueryRowContext(ctx,
+		`SELECT id, name, username, email, avatar_url FROM users WHERE id = $1`, userID,
+	).Scan(&m.ID, &m.Name, &m.Username, &m.Email, &m.AvatarUrl)
 	if err != nil {
-		return u, fmt.Errorf("add member failed: %w", err)
+		return m, fmt.Errorf("get member: %w", err)
 	}
-
-	return u, nil
+	m.Role = string(role)
+	return m, nil
 }
 
 // RemoveMemberFromProject removes a user from the project
 func (r *projectRepoImpl) RemoveMemberFromProject(ctx context.Context, currentUserID, projectID, userID int) error {
-	var ownerID int
-	err := r.db.QueryRowContext(ctx, `SELECT owner_id FROM projects WHERE id = $1`, projectID).Scan(&ownerID)
+	actor, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ManageMembers)
 	if err != nil {
-		return fmt.Errorf("project not found or fetch failed: %w", err)
+		return err
 	}
-	if ownerID != currentUserID {
-		return fmt.Errorf("permission denied: user is not the owner of the project")
+	target, err := authz.DirectRole(ctx, r.db, userID, projectID)
+	if errors.Is(err, authz.ErrNotMember) {
+		return fmt.Errorf("member not found: %w", sql.ErrNoRows)
 	}
-	if userID == currentUserID {
-		return fmt.Errorf("cannot remove project owner from the project")
+	if err != nil {
+		return err
+	}
+	if !authz.CanManage(actor, target) {
+		return fmt.Errorf("%w: %s cannot remove a member who is %s", authz.ErrForbidden, actor, target)
 	}
 
 	_, err = r.db.ExecContext(ctx,
@@ -285,15 +358,89 @@ func (r *projectRepoImpl) RemoveMemberFromProject(ctx context.Context, currentUs
 
 // DeleteProjectByID soft-deletes a project
 func (r *projectRepoImpl) DeleteProjectByID(ctx context.Context, currentUserID, projectID int) error {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.DeleteProject); err != nil {
+		return err
+	}
+
 	_, err := r.db.ExecContext(ctx,
-		`UPDATE projects SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1 AND owner_id = $2`,
-		projectID, currentUserID)
+		`UPDATE projects SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		projectID)
 	if err != nil {
 		return fmt.Errorf("delete project failed: %w", err)
 	}
 	return nil
 }
 
+// TransferOwnership makes another member the owner of a project in one
+// transaction, gives the current owner previousOwnerRole and records the
+// transfer in the audit log
+func (r *projectRepoImpl) TransferOwnership(ctx context.Context, currentUserID, projectID, newOwnerID int, previousOwnerRole authz.Role) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.TransferProject); err != nil {
+		return err
+	}
+	if _, err := authz.DirectRole(ctx, tx, newOwnerID, projectID); err != nil {
+		if errors.Is(err, authz.ErrNotMember) {
+			return fmt.Errorf("member not found: %w", sql.ErrNoRows)
+		}
+		return err
+	}
+
+	// The owner check in the WHERE clause makes concurrent transfers fail
+	// instead of both succeeding
+	res, err := tx.ExecContext(ctx,
+		`UPDATE projects SET owner_id = $1 WHERE id = $2 AND owner_id = $3`,
+		newOwnerID, projectID, currentUserID)
+	if err != nil {
+		return fmt.Errorf("transfer project: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n != 1 {
+		return fmt.Errorf("%w: project ownership changed concurrently", authz.ErrForbidden)
+	}
+
+	query := `UPDATE project_members SET role = $1 WHERE project_id = $2 AND user_id = $3`
+	if _, err := tx.ExecContext(ctx, query, authz.RoleOwner, projectID, newOwnerID); err != nil {
+		return fmt.Errorf("promote new owner: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, previousOwnerRole, projectID, currentUserID); err != nil {
+		return fmt.Errorf("downgrade previous owner: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.ProjectAuditEntry{
+		ProjectID:    projectID,
+		ActorID:      &currentUserID,
+		Action:       models.AuditOwnershipTransferred,
+		TargetUserID: &newOwnerID,
+		Details:      fmt.Sprintf("previous owner is now %s", previousOwnerRole),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// visibleProjectIDs selects the IDs of the projects the user in the userID
+// placeholder is a member of, directly or through a team
+func visibleProjectIDs(userID string) string {
+	return `
+		SELECT pm.project_id FROM project_members pm WHERE pm.user_id = ` + userID + `
+		UNION
+		SELECT pt.project_id FROM project_teams pt
+		JOIN team_members tm ON tm.team_id = pt.team_id
+		WHERE tm.user_id = ` + userID
+}
+
 // placeholders generates $1,$2,... for PostgreSQL IN clauses
 func placeholders(n int) string {
 	var b strings.Builder
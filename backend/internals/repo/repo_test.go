@@ -0,0 +1,91 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"task-matrix-be/internals/dbconnectors"
+	"task-matrix-be/internals/migrate"
+)
+
+// Statuses and priorities seeded by the migrations
+const (
+	testStatusTodo       = 1
+	testStatusInProgress = 2
+	testStatusCompleted  = 4
+
+	testPriorityLow    = 1
+	testPriorityMedium = 2
+	testPriorityHigh   = 3
+)
+
+// newTestRepos returns repositories on a fresh in-memory SQLite database
+func newTestRepos(t *testing.T) (UserRepo, ProjectRepo, TaskRepo) {
+	t.Helper()
+	db, err := dbconnectors.GetSqliteDb(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatalf("GetSqliteDb: %v", err)
+	}
+	// Connections to a shared-cache database fail with SQLITE_LOCKED instead
+	// of waiting for each other
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if err := migrate.MigrateSQLite(context.Background(), db); err != nil {
+		t.Fatalf("MigrateSQLite: %v", err)
+	}
+	ur, pr, tr, _, err := GetRepos(db)
+	if err != nil {
+		t.Fatalf("GetRepos: %v", err)
+	}
+	return ur, pr, tr
+}
+
+// newTestProject creates a user and a project they own. The migrations
+// seed sample users, so username must not be one of theirs.
+func newTestProject(t *testing.T, ur UserRepo, pr ProjectRepo, username string) (userID, projectID int) {
+	t.Helper()
+	ctx := context.Background()
+	userID, err := ur.CreateUser(ctx, username, username, username+"@example.com", "", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	projectID, _, err = pr.CreateProject(ctx, userID, 0, "Project of "+username, "", "2030-01-01")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	return userID, projectID
+}
+
+// testTask is a task created by newTestTask, zero values are defaults
+type testTask struct {
+	title      string
+	priorityID int
+	statusID   int
+	dueDate    string
+	parentID   int
+}
+
+func newTestTask(t *testing.T, tr TaskRepo, userID, projectID int, task testTask) int {
+	t.Helper()
+	if task.priorityID == 0 {
+		task.priorityID = testPriorityMedium
+	}
+	if task.statusID == 0 {
+		task.statusID = testStatusTodo
+	}
+	var dueDate *string
+	if task.dueDate != "" {
+		dueDate = &task.dueDate
+	}
+	var parentID *int
+	if task.parentID != 0 {
+		parentID = &task.parentID
+	}
+	id, err := tr.CreateTask(context.Background(), userID, projectID, task.title, "", task.priorityID, task.statusID, userID, nil, dueDate, parentID)
+	if err != nil {
+		t.Fatalf("CreateTask(%q): %v", task.title, err)
+	}
+	return id
+}
@@ -4,36 +4,139 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"task-matrix-be/internals/authz"
 	"task-matrix-be/internals/models"
+	"time"
 )
 
 type UserRepo interface {
 	CreateUser(ctx context.Context, name, username, email, avatarUrl, hashedPassword string) (id int, err error)
-	GetUserByCreds(ctx context.Context, username, hashedPassword string) (user *models.User, err error)
+	GetUserByUsername(ctx context.Context, username string) (user *models.User, hashedPassword string, err error)
+	UpdatePasswordHash(ctx context.Context, userID int, hashedPassword string) error
+	GetUserByEmail(ctx context.Context, email string) (user *models.User, err error)
+	IsEmailVerified(ctx context.Context, userID int) (bool, error)
+	MarkEmailVerified(ctx context.Context, userID int) error
+	CreateUserToken(ctx context.Context, userID int, purpose, tokenHash string, expiresAt time.Time) error
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (userID int, err error)
+	LookupUserToken(ctx context.Context, purpose, tokenHash string) (userID int, err error)
+	GetUserByID(ctx context.Context, userID int) (user *models.User, err error)
+	GetTOTP(ctx context.Context, userID int) (secret string, enabled bool, err error)
+	SetPendingTOTPSecret(ctx context.Context, userID int, secret string) error
+	EnableTOTP(ctx context.Context, userID int, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID int) error
+	AdvanceTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodeHashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	GetLoginLock(ctx context.Context, username string) (lockedUntil time.Time, err error)
+	RegisterFailedLogin(ctx context.Context, username string, window time.Duration) (failedCount int, err error)
+	SetLoginLock(ctx context.Context, username string, lockedUntil time.Time) error
+	ResetLoginThrottle(ctx context.Context, username string) (bool, error)
+	RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error
+	ListLoginAttempts(ctx context.Context, username string, limit int) ([]models.LoginAttempt, error)
+	CreateAPIKey(ctx context.Context, userID int, key models.APIKey, keyHash string) (id int, err error)
+	ListAPIKeys(ctx context.Context, userID int) ([]models.APIKey, error)
+	GetAPIKey(ctx context.Context, userID, keyID int) (*models.APIKey, error)
+	UpdateAPIKey(ctx context.Context, userID int, key models.APIKey) error
+	DeleteAPIKey(ctx context.Context, userID, keyID int) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, *models.User, error)
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+	CreateOIDCState(ctx context.Context, stateHash, nonce, codeVerifier string, expiresAt time.Time) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (nonce, codeVerifier string, err error)
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+	LinkIdentity(ctx context.Context, userID int, issuer, subject, email string) error
+	GetPasswordHash(ctx context.Context, userID int) (hashedPassword string, err error)
+	GetProfile(ctx context.Context, userID int) (*models.UserProfile, error)
+	UpdateProfile(ctx context.Context, user models.User) error
+	SetPendingEmail(ctx context.Context, userID int, email string) error
+	ConfirmPendingEmail(ctx context.Context, userID int) (email string, err error)
+	SearchUsers(ctx context.Context, viewerID int, query string, limit, offset int) ([]models.User, error)
+	JoinInvitedProjects(ctx context.Context, userID int) (projectIDs []int, err error)
+	ExportAccount(ctx context.Context, userID int) (*models.AccountExport, error)
+	DeleteAccount(ctx context.Context, userID int, hashedPassword string, archive bool, transferTo map[int]int) (*models.AccountDeletion, error)
+	IsAdmin(ctx context.Context, userID int) (bool, error)
+	PromoteAdmins(ctx context.Context, usernames []string) error
+	GetAccountStatus(ctx context.Context, userID int) (models.AccountStatus, error)
+	ListUsers(ctx context.Context, query, status string, adminsOnly bool, limit, offset int) ([]models.AdminUser, error)
+	GetAdminUser(ctx context.Context, userID int) (models.AdminUser, error)
+	SetUserDisabled(ctx context.Context, userID int, disabled bool) error
+	SetAdmin(ctx context.Context, userID int, admin bool) error
+	RequirePasswordReset(ctx context.Context, userID int) error
+	GetSystemStats(ctx context.Context, activeSince time.Time, sessionTable string) (models.SystemStats, error)
 }
 
 type ProjectRepo interface {
-	CreateProject(ctx context.Context, currentUserID int, name, description, due_date string) (id int, err error)
-	GetProjects(ctx context.Context, currentUserID int) ([]models.Project, error)
+	CreateProject(ctx context.Context, currentUserID, orgID int, name, description, due_date string) (id, resolvedOrgID int, err error)
+	GetProjects(ctx context.Context, currentUserID, orgID int, leafTasksOnly bool) ([]models.Project, error)
 	GetProjectByID(ctx context.Context, currentUserID, projectID int) (models.ProjectDetail, error)
 	UpdateProjectByID(ctx context.Context, currentUserID, projectID int, name, description, dueDate string, statusId int) (models.Project, error)
-	AddMemberToProject(ctx context.Context, currentUserID, projectID int, username string) (models.User, error)
+	InviteUserToProject(ctx context.Context, currentUserID, projectID int, username string, role authz.Role, tokenHash string, expiresAt time.Time) (models.ProjectInvitation, error)
+	ChangeMemberRole(ctx context.Context, currentUserID, projectID, userID int, role authz.Role) (models.ProjectMember, error)
+	TransferOwnership(ctx context.Context, currentUserID, projectID, newOwnerID int, previousOwnerRole authz.Role) error
+	GetAuditLog(ctx context.Context, currentUserID, projectID, limit int) ([]models.ProjectAuditEntry, error)
+	CreateInvitation(ctx context.Context, currentUserID, projectID int, email *string, role authz.Role, tokenHash string, expiresAt time.Time) (models.ProjectInvitation, error)
+	ListInvitations(ctx context.Context, currentUserID, projectID int) ([]models.ProjectInvitation, error)
+	RevokeInvitation(ctx context.Context, currentUserID, projectID, invitationID int) error
+	ListInvitationsForUser(ctx context.Context, userID int) ([]models.ProjectInvitation, error)
+	GetInvitationIDByToken(ctx context.Context, tokenHash string) (invitationID int, err error)
+	AcceptInvitation(ctx context.Context, userID, invitationID int, byToken bool) (models.ProjectInvitation, error)
+	DeclineInvitation(ctx context.Context, userID, invitationID int, byToken bool) error
 	RemoveMemberFromProject(ctx context.Context, currentUserID, projectID, userID int) error
+	AddTeamToProject(ctx context.Context, currentUserID, projectID, teamID int, role authz.Role) (models.ProjectTeam, error)
+	ChangeTeamRole(ctx context.Context, currentUserID, projectID, teamID int, role authz.Role) (models.ProjectTeam, error)
+	RemoveTeamFromProject(ctx context.Context, currentUserID, projectID, teamID int) error
+	CreateShareLink(ctx context.Context, currentUserID, projectID int, slug string, passwordHash *string, expiresAt *time.Time) (models.ShareLink, error)
+	ListShareLinks(ctx context.Context, currentUserID, projectID int) ([]models.ShareLink, error)
+	DeleteShareLink(ctx context.Context, currentUserID, projectID, linkID int) error
+	GetShareLink(ctx context.Context, slug string) (link models.ShareLink, passwordHash string, err error)
+	GetSharedProject(ctx context.Context, link models.ShareLink) (models.ProjectDetail, error)
 	DeleteProjectByID(ctx context.Context, currentUserID, projectID int) error
+	ListAllProjects(ctx context.Context, query, deleted string, limit, offset int) ([]models.AdminProject, error)
 }
 
 type TaskRepo interface {
-	CreateTask(ctx context.Context, currentUserID, projectID int, title, description string, priorityID, statusID, assigneeID int) (id int, err error)
-	UpdateTaskByID(ctx context.Context, currentUserID, projectID, taskID int, title, description string, priorityID, statusID, assigneeID int) (err error)
+	CreateTask(ctx context.Context, currentUserID, projectID int, title, description string, priorityID, statusID, assigneeID int, startDate, dueDate *string, parentTaskID *int) (id int, err error)
+	UpdateTaskByID(ctx context.Context, currentUserID, projectID, taskID int, title, description string, priorityID, statusID, assigneeID int, startDate, dueDate *string, parentTaskID *int, allowBlocked bool) (openBlockers []int, err error)
 	DeleteTaskByID(ctx context.Context, currentUserID, projectID, taskID int) (err error)
+	GetTask(ctx context.Context, currentUserID, projectID, taskID int) (models.Task, error)
+	ListTasks(ctx context.Context, currentUserID, projectID int, filter models.TaskFilter) (tasks []models.Task, next *models.TaskCursor, err error)
+	ListMyTasks(ctx context.Context, currentUserID int, filter models.TaskFilter) (tasks []models.Task, next *models.TaskCursor, err error)
+	ListChecklistItems(ctx context.Context, currentUserID, projectID, taskID int) ([]models.ChecklistItem, error)
+	AddChecklistItem(ctx context.Context, currentUserID, projectID, taskID int, title string, done bool) (models.ChecklistItem, error)
+	UpdateChecklistItem(ctx context.Context, currentUserID, projectID, taskID, itemID int, title string, done bool) (models.ChecklistItem, error)
+	DeleteChecklistItem(ctx context.Context, currentUserID, projectID, taskID, itemID int) error
+	AddTaskDependency(ctx context.Context, currentUserID, projectID, taskID, blockerID int) error
+	RemoveTaskDependency(ctx context.Context, currentUserID, projectID, taskID, blockerID int) error
+	GetDependencyGraph(ctx context.Context, currentUserID, projectID int) (models.DependencyGraph, error)
+}
+
+type OrgRepo interface {
+	CreateOrganization(ctx context.Context, userID int, name string, defaultRole authz.Role) (models.Organization, error)
+	ListOrganizations(ctx context.Context, userID int) ([]models.Organization, error)
+	GetOrganization(ctx context.Context, userID, orgID int) (models.OrganizationDetail, error)
+	UpdateOrganization(ctx context.Context, userID, orgID int, name *string, defaultRole *authz.Role) (models.Organization, error)
+	InviteOrgMember(ctx context.Context, userID, orgID int, username string, role authz.OrgRole, expiresAt time.Time) (models.OrgInvitation, error)
+	ListOrgInvitations(ctx context.Context, userID, orgID int) ([]models.OrgInvitation, error)
+	RevokeOrgInvitation(ctx context.Context, userID, orgID, invitationID int) error
+	ListOrgInvitationsForUser(ctx context.Context, userID int) ([]models.OrgInvitation, error)
+	AcceptOrgInvitation(ctx context.Context, userID, invitationID int) (models.OrgInvitation, error)
+	DeclineOrgInvitation(ctx context.Context, userID, invitationID int) error
+	ChangeOrgMemberRole(ctx context.Context, userID, orgID, memberID int, role authz.OrgRole) (models.OrganizationMember, error)
+	RemoveOrgMember(ctx context.Context, userID, orgID, memberID int) error
+	ListTeams(ctx context.Context, userID, orgID int) ([]models.Team, error)
+	CreateTeam(ctx context.Context, userID, orgID int, name string, leadID *int) (models.Team, error)
+	GetTeam(ctx context.Context, userID, orgID, teamID int) (models.TeamDetail, error)
+	UpdateTeam(ctx context.Context, userID, orgID, teamID int, name *string, leadID *int) (models.Team, error)
+	DeleteTeam(ctx context.Context, userID, orgID, teamID int) error
+	AddTeamMember(ctx context.Context, userID, orgID, teamID int, username string) (models.User, error)
+	RemoveTeamMember(ctx context.Context, userID, orgID, teamID, memberID int) error
 }
 
 func GetRepos(db *sql.DB) (
-	UserRepo, ProjectRepo, TaskRepo, error,
+	UserRepo, ProjectRepo, TaskRepo, OrgRepo, error,
 ) {
 	if db == nil {
-		return nil, nil, nil, errors.New("nil value provided for db param in GetRepos")
+		return nil, nil, nil, nil, errors.New("nil value provided for db param in GetRepos")
 	}
 
-	return &userRepoImpl{db: db}, &projectRepoImpl{db: db}, &taskRepoImpl{db: db}, nil
+	return &userRepoImpl{db: db}, &projectRepoImpl{db: db}, &taskRepoImpl{db: db}, &orgRepoImpl{db: db}, nil
 }
@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+var ErrShareLinkNotFound = errors.New("share link not found")
+
+// shareLinkQuery selects the columns scanned by scanShareLink
+const shareLinkQuery = `
+	SELECT l.id, l.project_id, l.slug, l.password_hash, l.created_by, l.created_at, l.expires_at
+	FROM project_share_links l
+`
+
+// scanShareLink returns a share link and its password hash, empty when the
+// link has no password
+func scanShareLink(row rowScanner) (models.ShareLink, string, error) {
+	var link models.ShareLink
+	var passwordHash sql.NullString
+	var createdBy sql.NullInt64
+	var expiresAt sql.NullTime
+	err := row.Scan(&link.ID, &link.ProjectID, &link.Slug, &passwordHash, &createdBy, &link.CreatedAt, &expiresAt)
+	if err != nil {
+		return link, "", err
+	}
+	link.HasPassword = passwordHash.Valid
+	link.CreatedBy = nullIntPtr(createdBy)
+	link.ExpiresAt = nullTimePtr(expiresAt)
+	return link, passwordHash.String, nil
+}
+
+// CreateShareLink publishes a read-only view of a project under slug. A nil
+// passwordHash or expiresAt creates a link without password or expiry.
+func (r *projectRepoImpl) CreateShareLink(ctx context.Context, currentUserID, projectID int, slug string, passwordHash *string, expiresAt *time.Time) (models.ShareLink, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ShareLink{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.ShareProject); err != nil {
+		return models.ShareLink{}, err
+	}
+
+	query := `
+		INSERT INTO project_share_links (project_id, slug, password_hash, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, project_id, slug, password_hash, created_by, created_at, expires_at
+	`
+	link, _, err := scanShareLink(tx.QueryRowContext(ctx, query,
+		projectID, slug, passwordHash, currentUserID, time.Now().UTC(), expiresAt))
+	if err != nil {
+		return link, fmt.Errorf("create share link: %w", err)
+	}
+
+	details := "without password"
+	if passwordHash != nil {
+		details = "with password"
+	}
+	if expiresAt != nil {
+		details += ", expires " + expiresAt.Format(time.RFC3339)
+	}
+	err = recordAudit(ctx, tx, models.ProjectAuditEntry{
+		ProjectID: projectID,
+		ActorID:   &currentUserID,
+		Action:    models.AuditShareLinkCreated,
+		Details:   fmt.Sprintf("share link %d created %s", link.ID, details),
+	})
+	if err != nil {
+		return link, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return link, fmt.Errorf("commit transaction: %w", err)
+	}
+	return link, nil
+}
+
+// ListShareLinks returns the share links of a project, expired ones
+// included, newest first
+func (r *projectRepoImpl) ListShareLinks(ctx context.Context, currentUserID, projectID int) ([]models.ShareLink, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ShareProject); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, shareLinkQuery+`
+		WHERE l.project_id = $1
+		ORDER BY l.created_at DESC, l.id DESC
+	`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("list share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := make([]models.ShareLink, 0)
+	for rows.Next() {
+		link, _, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// DeleteShareLink revokes a share link, its URL stops working at once
+func (r *projectRepoImpl) DeleteShareLink(ctx context.Context, currentUserID, projectID, linkID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.ShareProject); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM project_share_links WHERE id = $1 AND project_id = $2`, linkID, projectID)
+	if err != nil {
+		return fmt.Errorf("delete share link: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("delete share link: %w", err)
+	} else if n == 0 {
+		return ErrShareLinkNotFound
+	}
+
+	err = recordAudit(ctx, tx, models.ProjectAuditEntry{
+		ProjectID: projectID,
+		ActorID:   &currentUserID,
+		Action:    models.AuditShareLinkRevoked,
+		Details:   fmt.Sprintf("share link %d revoked", linkID),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetShareLink resolves the slug of a share link of a project that was not
+// deleted, returning the link and its password hash. Expiry is left to the
+// caller.
+func (r *projectRepoImpl) GetShareLink(ctx context.Context, slug string) (models.ShareLink, string, error) {
+	link, passwordHash, err := scanShareLink(r.db.QueryRowContext(ctx, shareLinkQuery+`
+		JOIN projects p ON p.id = l.project_id
+		WHERE l.slug = $1 AND p.deleted_at IS NULL
+	`, slug))
+	if errors.Is(err, sql.ErrNoRows) {
+		return link, "", ErrShareLinkNotFound
+	}
+	if err != nil {
+		return link, "", fmt.Errorf("get share link: %w", err)
+	}
+	return link, passwordHash, nil
+}
+
+// GetSharedProject returns the project a share link resolved by GetShareLink
+// points to. It does no access checks of its own.
+func (r *projectRepoImpl) GetSharedProject(ctx context.Context, link models.ShareLink) (models.ProjectDetail, error) {
+	return r.projectDetail(ctx, link.ProjectID)
+}
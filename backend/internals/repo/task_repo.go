@@ -3,83 +3,503 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+	"time"
+)
+
+// maxTaskDepth is how many levels of tasks and subtasks there can be
+const maxTaskDepth = 5
+
+var (
+	ErrTaskNotFound       = errors.New("task not found")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrParentTaskNotFound = errors.New("parent task not found in the project")
+	ErrTaskCycle          = errors.New("a task cannot be a subtask of itself or of its own subtasks")
+	ErrTaskTooDeep        = fmt.Errorf("subtasks cannot be nested more than %d levels deep", maxTaskDepth)
 )
 
 type taskRepoImpl struct {
 	db *sql.DB
 }
 
-// isProjectMember checks whether the user is a member of the given project
-func (r *taskRepoImpl) isProjectMember(ctx context.Context, userID, projectID int) (bool, error) {
-	var exists bool
-	query := `
-		SELECT EXISTS (
-			SELECT 1 FROM project_members
-			WHERE user_id = $1 AND project_id = $2
-		)
-	`
-	err := r.db.QueryRowContext(ctx, query, userID, projectID).Scan(&exists)
+// taskQuery selects the columns scanned by scanTask
+const taskQuery = `
+	SELECT t.id, t.project_id, pj.title, t.title, COALESCE(t.description, ''),
+	       p.id, p.name,
+	       s.id, s.name,
+	       u.id, u.name, u.username, u.email, u.avatar_url,
+	       t.start_date, t.due_date, t.created_at, t.updated_at, t.completed_at,
+	       t.parent_task_id,
+	       (SELECT COUNT(*) FROM tasks c WHERE c.parent_task_id = t.id AND c.status_id = ` + completedStatusQuery + `),
+	       (SELECT COUNT(*) FROM tasks c WHERE c.parent_task_id = t.id),
+	       (SELECT COUNT(*) FROM task_checklist_items ci WHERE ci.task_id = t.id AND ci.done = TRUE),
+	       (SELECT COUNT(*) FROM task_checklist_items ci WHERE ci.task_id = t.id)
+	FROM tasks t
+	JOIN projects pj ON pj.id = t.project_id
+	JOIN priorities p ON p.id = t.priority_id
+	JOIN statuses s ON s.id = t.status_id
+	JOIN users u ON u.id = t.assignee_id
+`
+
+func scanTask(row rowScanner) (models.Task, error) {
+	var t models.Task
+	var startDate, dueDate, createdAt, updatedAt, completedAt sql.NullTime
+	var parentTaskID sql.NullInt64
+	err := row.Scan(&t.ID, &t.ProjectID, &t.ProjectName, &t.Title, &t.Description,
+		&t.Priority.ID, &t.Priority.Name,
+		&t.Status.ID, &t.Status.Name,
+		&t.Assignee.ID, &t.Assignee.Name, &t.Assignee.Username, &t.Assignee.Email, &t.Assignee.AvatarUrl,
+		&startDate, &dueDate, &createdAt, &updatedAt, &completedAt,
+		&parentTaskID,
+		&t.Subtasks.Done, &t.Subtasks.Total,
+		&t.Checklist.Done, &t.Checklist.Total,
+	)
+	t.ParentTaskID = nullIntPtr(parentTaskID)
+	t.StartDate = nullDatePtr(startDate)
+	t.DueDate = nullDatePtr(dueDate)
+	t.CreatedAt = nullTimePtr(createdAt)
+	t.UpdatedAt = nullTimePtr(updatedAt)
+	t.CompletedAt = nullTimePtr(completedAt)
+	t.Overdue = t.DueDate != nil && *t.DueDate < today() && t.Status.Name != completedStatus
+	return t, err
+}
+
+// completedStatus is the name of the status that completes a task
+const completedStatus = "Completed"
+
+// today returns the current date in UTC as YYYY-MM-DD. Dates are stored in
+// that format, so they compare as strings on every database.
+func today() string {
+	return time.Now().UTC().Format(time.DateOnly)
+}
+
+func nullDatePtr(t sql.NullTime) *string {
+	if !t.Valid {
+		return nil
+	}
+	s := t.Time.Format(time.DateOnly)
+	return &s
+}
+
+// completedStatusQuery selects the ID of the status that completes a task
+const completedStatusQuery = `(SELECT id FROM statuses WHERE name = '` + completedStatus + `')`
+
+// Kinds of values task listings sort by
+const (
+	sortInt = iota
+	// sortText compares case-insensitively
+	sortText
+	sortDate
+)
+
+// noDueDate sorts tasks without a due date after all others
+const noDueDate = "9999-12-31"
+
+// taskSortKey is something task listings sort or group by
+type taskSortKey struct {
+	column string
+	kind   int
+	value  func(t models.Task) string
+}
+
+var taskSortKeys = map[string]taskSortKey{
+	models.TaskSortPriority: {"t.priority_id", sortInt, func(t models.Task) string { return strconv.Itoa(t.Priority.ID) }},
+	models.TaskSortStatus:   {"t.status_id", sortInt, func(t models.Task) string { return strconv.Itoa(t.Status.ID) }},
+	models.TaskSortTitle:    {"LOWER(t.title)", sortText, func(t models.Task) string { return t.Title }},
+	models.TaskSortProject:  {"t.project_id", sortInt, func(t models.Task) string { return strconv.Itoa(t.ProjectID) }},
+	models.TaskSortDue: {"COALESCE(t.due_date, '" + noDueDate + "')", sortDate, func(t models.Task) string {
+		if t.DueDate == nil {
+			return noDueDate
+		}
+		return *t.DueDate
+	}},
+}
+
+// queryArgs collects the arguments of a query built piece by piece, numbering
+// placeholders in the order they are added
+type queryArgs []any
+
+func (a *queryArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+func (a *queryArgs) addAll(vs []int) string {
+	ph := make([]string, len(vs))
+	for i, v := range vs {
+		ph[i] = a.add(v)
+	}
+	return strings.Join(ph, ", ")
+}
+
+// taskOrder is one of the keys a task listing is ordered by
+type taskOrder struct {
+	taskSortKey
+	desc bool
+}
+
+// taskOrders returns what a listing is ordered by: the group first, then the
+// sort key and the task ID, which breaks ties and stands for creation order
+func taskOrders(f models.TaskFilter) ([]taskOrder, error) {
+	var orders []taskOrder
+	if f.GroupBy != "" {
+		key, ok := taskSortKeys[f.GroupBy]
+		if !ok {
+			return nil, fmt.Errorf("unknown task grouping %q", f.GroupBy)
+		}
+		orders = append(orders, taskOrder{key, false})
+	}
+	if f.Sort != "" && f.Sort != models.TaskSortCreated && f.Sort != f.GroupBy {
+		key, ok := taskSortKeys[f.Sort]
+		if !ok {
+			return nil, fmt.Errorf("unknown task order %q", f.Sort)
+		}
+		orders = append(orders, taskOrder{key, f.Desc})
+	}
+	id := taskSortKey{"t.id", sortInt, func(t models.Task) string { return strconv.Itoa(t.ID) }}
+	return append(orders, taskOrder{id, f.Desc}), nil
+}
+
+// queryTasks lists the tasks matching the conditions in where and the
+// filter, one page at a time. The returned cursor is nil on the last page.
+func queryTasks(ctx context.Context, db *sql.DB, args queryArgs, where []string, f models.TaskFilter) ([]models.Task, *models.TaskCursor, error) {
+	if len(f.StatusIDs) > 0 {
+		where = append(where, "t.status_id IN ("+args.addAll(f.StatusIDs)+")")
+	}
+	if len(f.PriorityIDs) > 0 {
+		where = append(where, "t.priority_id IN ("+args.addAll(f.PriorityIDs)+")")
+	}
+	if len(f.AssigneeIDs) > 0 {
+		where = append(where, "t.assignee_id IN ("+args.addAll(f.AssigneeIDs)+")")
+	}
+	if text := strings.ToLower(strings.TrimSpace(f.Text)); text != "" {
+		pattern := args.add("%" + escapeLike(text) + "%")
+		where = append(where, fmt.Sprintf(
+			`(LOWER(t.title) LIKE %[1]s ESCAPE '\' OR LOWER(COALESCE(t.description, '')) LIKE %[1]s ESCAPE '\')`, pattern))
+	}
+	if f.CreatedFrom != nil {
+		where = append(where, "t.created_at >= "+args.add(f.CreatedFrom.UTC()))
+	}
+	if f.CreatedTo != nil {
+		where = append(where, "t.created_at < "+args.add(f.CreatedTo.UTC()))
+	}
+	if f.DueFrom != "" {
+		where = append(where, "t.due_date >= "+args.add(f.DueFrom))
+	}
+	if f.DueTo != "" {
+		where = append(where, "t.due_date <= "+args.add(f.DueTo))
+	}
+	if f.Overdue {
+		where = append(where, "t.due_date < "+args.add(today()),
+			"t.status_id <> "+completedStatusQuery)
+	}
+	if f.CompletedSince != nil {
+		where = append(where, "t.status_id = "+completedStatusQuery,
+			"t.completed_at >= "+args.add(f.CompletedSince.UTC()))
+	}
+	if f.ParentID != 0 {
+		where = append(where, "t.parent_task_id = "+args.add(f.ParentID))
+	}
+	if f.TopLevel {
+		where = append(where, "t.parent_task_id IS NULL")
+	}
+
+	orders, err := taskOrders(f)
 	if err != nil {
-		return false, fmt.Errorf("membership check failed: %w", err)
+		return nil, nil, err
 	}
-	return exists, nil
+
+	// Keyset pagination: the next page starts after the sort values of the
+	// last task, so tasks added meanwhile neither repeat nor get skipped
+	if f.After != nil {
+		if len(f.After.Values) != len(orders)-1 {
+			return nil, nil, ErrInvalidCursor
+		}
+		values := make([]string, len(orders))
+		for i, o := range orders {
+			var value any
+			switch {
+			case i == len(orders)-1:
+				value = f.After.ID
+			case o.kind == sortText:
+				value = f.After.Values[i]
+			case o.kind == sortDate:
+				if _, err := time.Parse(time.DateOnly, f.After.Values[i]); err != nil {
+					return nil, nil, ErrInvalidCursor
+				}
+				value = f.After.Values[i]
+			default:
+				n, err := strconv.Atoi(f.After.Values[i])
+				if err != nil {
+					return nil, nil, ErrInvalidCursor
+				}
+				value = n
+			}
+			values[i] = args.add(value)
+			if o.kind == sortText {
+				values[i] = "LOWER(" + values[i] + ")"
+			}
+		}
+
+		// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with < for descending keys
+		var after []string
+		for i, o := range orders {
+			var cond []string
+			for j := 0; j < i; j++ {
+				cond = append(cond, orders[j].column+" = "+values[j])
+			}
+			cmp := " > "
+			if o.desc {
+				cmp = " < "
+			}
+			cond = append(cond, o.column+cmp+values[i])
+			after = append(after, "("+strings.Join(cond, " AND ")+")")
+		}
+		where = append(where, "("+strings.Join(after, " OR ")+")")
+	}
+
+	query := taskQuery
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ")
+	}
+	orderBy := make([]string, len(orders))
+	for i, o := range orders {
+		orderBy[i] = o.column
+		if o.desc {
+			orderBy[i] += " DESC"
+		}
+	}
+	query += "\nORDER BY " + strings.Join(orderBy, ", ")
+	// One more than requested tells whether there is a next page
+	query += "\nLIMIT " + args.add(f.Limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := make([]models.Task, 0)
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(tasks) <= f.Limit {
+		return tasks, nil, nil
+	}
+	tasks = tasks[:f.Limit]
+	last := tasks[len(tasks)-1]
+	next := &models.TaskCursor{ID: last.ID, Values: make([]string, 0, len(orders)-1)}
+	for _, o := range orders[:len(orders)-1] {
+		next.Values = append(next.Values, o.value(last))
+	}
+	return tasks, next, nil
 }
 
-// CreateTask inserts a new task into the tasks table
-func (r *taskRepoImpl) CreateTask(ctx context.Context, currentUserID, projectID int, title, description string, priorityID, statusID, assigneeID int) (int, error) {
-	isMember, err := r.isProjectMember(ctx, currentUserID, projectID)
+// CreateTask inserts a new task into the tasks table, recording it as
+// completed now when it is created in the Completed status
+func (r *taskRepoImpl) CreateTask(ctx context.Context, currentUserID, projectID int, title, description string, priorityID, statusID, assigneeID int, startDate, dueDate *string, parentTaskID *int) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = authz.Authorize(ctx, tx, currentUserID, projectID, authz.EditTasks)
 	if err != nil {
 		return 0, err
 	}
-	if !isMember {
-		return 0, fmt.Errorf("permission denied: user is not a member of the project")
+	if parentTaskID != nil {
+		if err := lockProject(ctx, tx, projectID); err != nil {
+			return 0, err
+		}
+		if err := checkParentTask(ctx, tx, projectID, 0, *parentTaskID); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now().UTC()
+	var completedAt *time.Time
+	var completed bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM statuses WHERE id = $1 AND name = $2)`, statusID, completedStatus,
+	).Scan(&completed)
+	if err != nil {
+		return 0, fmt.Errorf("check status: %w", err)
+	}
+	if completed {
+		completedAt = &now
 	}
 
 	query := `
-		INSERT INTO tasks (title, description, priority_id, assignee_id, project_id, status_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO tasks (title, description, priority_id, assignee_id, project_id, status_id,
+		                   start_date, due_date, created_at, updated_at, completed_at, parent_task_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9, $10, $11)
 		RETURNING id
 	`
 	var id int
-	err = r.db.QueryRowContext(ctx, query, title, description, priorityID, assigneeID, projectID, statusID).Scan(&id)
+	err = tx.QueryRowContext(ctx, query, title, description, priorityID, assigneeID, projectID, statusID,
+		startDate, dueDate, now, completedAt, parentTaskID).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("create task: %w", err)
 	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
 	return id, nil
 }
 
-// UpdateTaskByID modifies an existing task's fields
-func (r *taskRepoImpl) UpdateTaskByID(ctx context.Context, currentUserID, projectID, taskID int, title, description string, priorityID, statusID, assigneeID int) error {
-	isMember, err := r.isProjectMember(ctx, currentUserID, projectID)
+// UpdateTaskByID modifies an existing task's fields. Moving it into the
+// Completed status records when, moving it out clears that again.
+//
+// Completing a task returns the tasks still open that block it. The update
+// fails with ErrTaskBlocked when there are any, unless allowBlocked is set.
+func (r *taskRepoImpl) UpdateTaskByID(ctx context.Context, currentUserID, projectID, taskID int, title, description string, priorityID, statusID, assigneeID int, startDate, dueDate *string, parentTaskID *int, allowBlocked bool) ([]int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = authz.Authorize(ctx, tx, currentUserID, projectID, authz.EditTasks)
+	if err != nil {
+		return nil, err
 	}
-	if !isMember {
-		return fmt.Errorf("permission denied: user is not a member of the project")
+	if err := checkTask(ctx, tx, projectID, taskID); err != nil {
+		return nil, err
+	}
+	if parentTaskID != nil {
+		if err := lockProject(ctx, tx, projectID); err != nil {
+			return nil, err
+		}
+		if err := checkParentTask(ctx, tx, projectID, taskID, *parentTaskID); err != nil {
+			return nil, err
+		}
+	}
+	blockers, err := blockersOnCompletion(ctx, tx, taskID, statusID)
+	if err != nil {
+		return nil, err
+	}
+	if len(blockers) > 0 && !allowBlocked {
+		return blockers, ErrTaskBlocked
 	}
 
 	query := `
 		UPDATE tasks
-		SET title = $1, description = $2, priority_id = $3, assignee_id = $4, status_id = $5
-		WHERE id = $6 AND project_id = $7
+		SET title = $1, description = $2, priority_id = $3, assignee_id = $4, status_id = $5,
+		    start_date = $6, due_date = $7, updated_at = $8,
+		    completed_at = CASE WHEN $5 = ` + completedStatusQuery + ` THEN COALESCE(completed_at, $8) END,
+		    parent_task_id = $9
+		WHERE id = $10 AND project_id = $11
 	`
-	_, err = r.db.ExecContext(ctx, query, title, description, priorityID, assigneeID, statusID, taskID, projectID)
+	res, err := tx.ExecContext(ctx, query, title, description, priorityID, assigneeID, statusID,
+		startDate, dueDate, time.Now().UTC(), parentTaskID, taskID, projectID)
 	if err != nil {
-		return fmt.Errorf("update task: %w", err)
+		return nil, fmt.Errorf("update task: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrTaskNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return blockers, nil
+}
+
+// lockProject locks the row of a project until the transaction ends.
+// Subtasks and dependencies only link tasks of one project, taking the lock
+// before checking them for cycles makes concurrent changes wait for each
+// other, else two links in opposite directions could both pass the check.
+func lockProject(ctx context.Context, tx *sql.Tx, projectID int) error {
+	if _, err := tx.ExecContext(ctx, `UPDATE projects SET id = id WHERE id = $1`, projectID); err != nil {
+		return fmt.Errorf("lock project: %w", err)
 	}
 	return nil
 }
 
-// DeleteTaskByID removes a task from the database
+// checkParentTask makes sure that parentID can be the parent of taskID, zero
+// for a task being created: it is a task of the same project that is not
+// the task or one of its subtasks, and the task and its own subtasks stay
+// within maxTaskDepth levels
+func checkParentTask(ctx context.Context, tx *sql.Tx, projectID, taskID, parentID int) error {
+	// Walk up from the parent, counting the levels above the task
+	above := 0
+	for id := parentID; id != 0; above++ {
+		if id == taskID {
+			return ErrTaskCycle
+		}
+		if above == maxTaskDepth-1 {
+			return ErrTaskTooDeep
+		}
+		var parent sql.NullInt64
+		err := tx.QueryRowContext(ctx,
+			`SELECT parent_task_id FROM tasks WHERE id = $1 AND project_id = $2`, id, projectID,
+		).Scan(&parent)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrParentTaskNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("get parent task: %w", err)
+		}
+		id = int(parent.Int64)
+	}
+	if taskID == 0 {
+		return nil
+	}
+
+	// Walk down the subtasks of the task one level at a time
+	level := []any{taskID}
+	for depth := above + 1; ; depth++ {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT id FROM tasks WHERE parent_task_id IN (`+placeholders(len(level))+`)`, level...)
+		if err != nil {
+			return fmt.Errorf("list subtasks: %w", err)
+		}
+		var next []any
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			next = append(next, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		if depth == maxTaskDepth {
+			return ErrTaskTooDeep
+		}
+		level = next
+	}
+}
+
+// DeleteTaskByID removes a task from the database along with its subtasks
 func (r *taskRepoImpl) DeleteTaskByID(ctx context.Context, currentUserID, projectID, taskID int) error {
-	isMember, err := r.isProjectMember(ctx, currentUserID, projectID)
+	_, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.EditTasks)
 	if err != nil {
 		return err
 	}
-	if !isMember {
-		return fmt.Errorf("permission denied: user is not a member of the project")
-	}
 
 	query := `
 		DELETE FROM tasks
@@ -90,4 +510,44 @@ func (r *taskRepoImpl) DeleteTaskByID(ctx context.Context, currentUserID, projec
 		return fmt.Errorf("delete task: %w", err)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// GetTask returns a task of a project the user can view
+func (r *taskRepoImpl) GetTask(ctx context.Context, currentUserID, projectID, taskID int) (models.Task, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ViewProject); err != nil {
+		return models.Task{}, err
+	}
+
+	t, err := scanTask(r.db.QueryRowContext(ctx, taskQuery+`WHERE t.id = $1 AND t.project_id = $2`, taskID, projectID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, ErrTaskNotFound
+	}
+	if err != nil {
+		return t, fmt.Errorf("get task: %w", err)
+	}
+	return t, nil
+}
+
+// ListTasks returns a page of the tasks of a project the user can view
+func (r *taskRepoImpl) ListTasks(ctx context.Context, currentUserID, projectID int, filter models.TaskFilter) ([]models.Task, *models.TaskCursor, error) {
+	if _, err := authz.Authorize(ctx, r.db, currentUserID, projectID, authz.ViewProject); err != nil {
+		return nil, nil, err
+	}
+
+	var args queryArgs
+	where := []string{"t.project_id = " + args.add(projectID)}
+	return queryTasks(ctx, r.db, args, where, filter)
+}
+
+// ListMyTasks returns a page of the tasks assigned to the user in all the
+// projects they can view
+func (r *taskRepoImpl) ListMyTasks(ctx context.Context, currentUserID int, filter models.TaskFilter) ([]models.Task, *models.TaskCursor, error) {
+	var args queryArgs
+	userID := args.add(currentUserID)
+	where := []string{
+		"t.assignee_id = " + userID,
+		"pj.deleted_at IS NULL",
+		"t.project_id IN (" + visibleProjectIDs(userID) + ")",
+	}
+	return queryTasks(ctx, r.db, args, where, filter)
+}
@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"task-matrix-be/internals/models"
+)
+
+// compareTaskKeys compares the values of one sort key of two tasks
+func compareTaskKeys(kind int, a, b string) int {
+	switch kind {
+	case sortInt:
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	case sortText:
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func TestListTasksCursorPaging(t *testing.T) {
+	ur, pr, tr := newTestRepos(t)
+	ctx := context.Background()
+	userID, projectID := newTestProject(t, ur, pr, "tester")
+
+	for _, task := range []testTask{
+		{title: "write docs", priorityID: testPriorityLow, statusID: testStatusTodo, dueDate: "2030-03-01"},
+		{title: "Fix login", priorityID: testPriorityHigh, statusID: testStatusInProgress},
+		{title: "deploy", priorityID: testPriorityHigh, statusID: testStatusTodo, dueDate: "2030-01-15"},
+		{title: "Deploy", priorityID: testPriorityMedium, statusID: testStatusCompleted, dueDate: "2030-01-15"},
+		{title: "review PR", priorityID: testPriorityMedium, statusID: testStatusInProgress, dueDate: "2030-02-01"},
+		{title: "archive", priorityID: testPriorityLow, statusID: testStatusCompleted},
+		{title: "plan sprint", priorityID: testPriorityHigh, statusID: testStatusTodo, dueDate: "2030-01-15"},
+	} {
+		newTestTask(t, tr, userID, projectID, task)
+	}
+
+	sorts := []string{"", models.TaskSortCreated, models.TaskSortPriority, models.TaskSortStatus, models.TaskSortTitle, models.TaskSortDue}
+	groups := []string{"", models.TaskSortPriority, models.TaskSortStatus, models.TaskSortDue}
+	for _, group := range groups {
+		for _, sort := range sorts {
+			for _, desc := range []bool{false, true} {
+				name := "group=" + group + "/sort=" + sort + "/desc=" + strconv.FormatBool(desc)
+				t.Run(name, func(t *testing.T) {
+					filter := models.TaskFilter{GroupBy: group, Sort: sort, Desc: desc, Limit: 100}
+					all, next, err := tr.ListTasks(ctx, userID, projectID, filter)
+					if err != nil {
+						t.Fatalf("ListTasks: %v", err)
+					}
+					if next != nil || len(all) != 7 {
+						t.Fatalf("ListTasks = %d tasks, next %v; want all 7 tasks on one page", len(all), next)
+					}
+
+					orders, err := taskOrders(filter)
+					if err != nil {
+						t.Fatalf("taskOrders: %v", err)
+					}
+					for i := 1; i < len(all); i++ {
+						for _, o := range orders {
+							c := compareTaskKeys(o.kind, o.value(all[i-1]), o.value(all[i]))
+							if o.desc {
+								c = -c
+							}
+							if c < 0 {
+								break
+							}
+							if c > 0 {
+								t.Fatalf("task %d listed before task %d, out of order on %s", all[i-1].ID, all[i].ID, o.column)
+							}
+						}
+					}
+
+					var paged []models.Task
+					filter.Limit = 2
+					for page := 0; ; page++ {
+						if page > len(all) {
+							t.Fatal("paging does not end")
+						}
+						tasks, next, err := tr.ListTasks(ctx, userID, projectID, filter)
+						if err != nil {
+							t.Fatalf("ListTasks page %d: %v", page, err)
+						}
+						paged = append(paged, tasks...)
+						if next == nil {
+							break
+						}
+						filter.After = next
+					}
+					if got, want := taskIDs(paged), taskIDs(all); !slices.Equal(got, want) {
+						t.Fatalf("paged tasks = %v; want %v", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestListTasksCursorSkipsTasksAddedBefore(t *testing.T) {
+	ur, pr, tr := newTestRepos(t)
+	ctx := context.Background()
+	userID, projectID := newTestProject(t, ur, pr, "tester")
+
+	for _, title := range []string{"b", "d", "f"} {
+		newTestTask(t, tr, userID, projectID, testTask{title: title})
+	}
+
+	filter := models.TaskFilter{Sort: models.TaskSortTitle, Limit: 2}
+	first, next, err := tr.ListTasks(ctx, userID, projectID, filter)
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	if next == nil {
+		t.Fatal("ListTasks returned no cursor after the first page")
+	}
+
+	// Sorts before the cursor, the next page must not start over
+	newTestTask(t, tr, userID, projectID, testTask{title: "a"})
+	e := newTestTask(t, tr, userID, projectID, testTask{title: "e"})
+
+	filter.After = next
+	second, next, err := tr.ListTasks(ctx, userID, projectID, filter)
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	if next != nil {
+		t.Fatalf("ListTasks returned cursor %+v on the last page", next)
+	}
+	titles := func(tasks []models.Task) []string {
+		var s []string
+		for _, task := range tasks {
+			s = append(s, task.Title)
+		}
+		return s
+	}
+	if got := titles(first); !slices.Equal(got, []string{"b", "d"}) {
+		t.Fatalf("first page = %v; want [b d]", got)
+	}
+	if got := titles(second); !slices.Equal(got, []string{"e", "f"}) || second[0].ID != e {
+		t.Fatalf("second page = %v; want [e f]", got)
+	}
+}
+
+func TestListTasksInvalidCursor(t *testing.T) {
+	ur, pr, tr := newTestRepos(t)
+	ctx := context.Background()
+	userID, projectID := newTestProject(t, ur, pr, "tester")
+
+	tests := []struct {
+		name   string
+		filter models.TaskFilter
+	}{
+		{"values for another order", models.TaskFilter{After: &models.TaskCursor{Values: []string{"1"}, ID: 1}}},
+		{"missing values", models.TaskFilter{Sort: models.TaskSortPriority, After: &models.TaskCursor{ID: 1}}},
+		{"not a number", models.TaskFilter{Sort: models.TaskSortStatus, After: &models.TaskCursor{Values: []string{"x"}, ID: 1}}},
+		{"not a date", models.TaskFilter{Sort: models.TaskSortDue, After: &models.TaskCursor{Values: []string{"tomorrow"}, ID: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Limit = 10
+			if _, _, err := tr.ListTasks(ctx, userID, projectID, tt.filter); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("ListTasks err = %v; want ErrInvalidCursor", err)
+			}
+		})
+	}
+}
+
+func taskIDs(tasks []models.Task) []int {
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+func TestSubtaskParentChecks(t *testing.T) {
+	// Tasks of the fixture: a chain root > t2 > t3 > t4 > t5 as deep as
+	// subtasks go, a task with one subtask, and a task of another project
+	type fixture struct {
+		root, t2, t3, t4, t5 int
+		other, otherSub      int
+		foreign              int
+	}
+
+	tests := []struct {
+		name string
+		// task returns the task to move under parent, zero to create one
+		task   func(f fixture) int
+		parent func(f fixture) int
+		want   error
+	}{
+		{"create on the last level", func(fixture) int { return 0 }, func(f fixture) int { return f.t4 }, nil},
+		{"create too deep", func(fixture) int { return 0 }, func(f fixture) int { return f.t5 }, ErrTaskTooDeep},
+		{"create under another project", func(fixture) int { return 0 }, func(f fixture) int { return f.foreign }, ErrParentTaskNotFound},
+		{"create under missing task", func(fixture) int { return 0 }, func(fixture) int { return 999 }, ErrParentTaskNotFound},
+		{"move under itself", func(f fixture) int { return f.t3 }, func(f fixture) int { return f.t3 }, ErrTaskCycle},
+		{"move under its subtask", func(f fixture) int { return f.root }, func(f fixture) int { return f.t4 }, ErrTaskCycle},
+		{"move with subtasks", func(f fixture) int { return f.other }, func(f fixture) int { return f.t3 }, nil},
+		{"move with subtasks too deep", func(f fixture) int { return f.other }, func(f fixture) int { return f.t4 }, ErrTaskTooDeep},
+		{"move on top of a chain too deep", func(f fixture) int { return f.root }, func(f fixture) int { return f.otherSub }, ErrTaskTooDeep},
+		{"move leaf to another branch", func(f fixture) int { return f.t5 }, func(f fixture) int { return f.other }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ur, pr, tr := newTestRepos(t)
+			ctx := context.Background()
+			userID, projectID := newTestProject(t, ur, pr, "tester")
+			outsiderID, foreignProjectID := newTestProject(t, ur, pr, "outsider")
+
+			var f fixture
+			f.root = newTestTask(t, tr, userID, projectID, testTask{title: "root"})
+			f.t2 = newTestTask(t, tr, userID, projectID, testTask{title: "t2", parentID: f.root})
+			f.t3 = newTestTask(t, tr, userID, projectID, testTask{title: "t3", parentID: f.t2})
+			f.t4 = newTestTask(t, tr, userID, projectID, testTask{title: "t4", parentID: f.t3})
+			f.t5 = newTestTask(t, tr, userID, projectID, testTask{title: "t5", parentID: f.t4})
+			f.other = newTestTask(t, tr, userID, projectID, testTask{title: "other"})
+			f.otherSub = newTestTask(t, tr, userID, projectID, testTask{title: "other sub", parentID: f.other})
+			f.foreign = newTestTask(t, tr, outsiderID, foreignProjectID, testTask{title: "foreign"})
+
+			var err error
+			taskID, parentID := tt.task(f), tt.parent(f)
+			if taskID == 0 {
+				_, err = tr.CreateTask(ctx, userID, projectID, "new", "", testPriorityMedium, testStatusTodo, userID, nil, nil, &parentID)
+			} else {
+				_, err = tr.UpdateTaskByID(ctx, userID, projectID, taskID, "moved", "", testPriorityMedium, testStatusTodo, userID, nil, nil, &parentID, false)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v; want %v", err, tt.want)
+			}
+			if tt.want != nil || taskID == 0 {
+				return
+			}
+			task, err := tr.GetTask(ctx, userID, projectID, taskID)
+			if err != nil {
+				t.Fatalf("GetTask: %v", err)
+			}
+			if task.ParentTaskID == nil || *task.ParentTaskID != parentID {
+				t.Fatalf("parent of task %d = %v; want %d", taskID, task.ParentTaskID, parentID)
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/models"
+)
+
+var (
+	ErrTeamNotFound       = errors.New("team not found")
+	ErrAlreadyTeamMember  = errors.New("user is already a member of the team")
+	ErrTeamAlreadyGranted = errors.New("the team already has a role in the project")
+	ErrTeamRoleAboveLead  = errors.New("the team has a role the lead cannot give")
+)
+
+// teamQuery selects the columns scanned by scanTeam
+const teamQuery = `
+	SELECT t.id, t.org_id, t.name, t.created_at,
+	       (SELECT COUNT(*) FROM team_members tm WHERE tm.team_id = t.id),
+	       l.id, l.name, l.username, l.email, l.avatar_url
+	FROM teams t
+	LEFT JOIN users l ON l.id = t.lead_id
+`
+
+func scanTeam(row rowScanner) (models.Team, error) {
+	var t models.Team
+	var leadID sql.NullInt64
+	var leadName, leadUsername, leadEmail, leadAvatar sql.NullString
+	err := row.Scan(&t.ID, &t.OrgID, &t.Name, &t.CreatedAt, &t.MemberCount,
+		&leadID, &leadName, &leadUsername, &leadEmail, &leadAvatar)
+	if err == nil && leadID.Valid {
+		t.Lead = &models.User{
+			ID:        int(leadID.Int64),
+			Name:      leadName.String,
+			Username:  leadUsername.String,
+			Email:     leadEmail.String,
+			AvatarUrl: leadAvatar.String,
+		}
+	}
+	return t, err
+}
+
+// authorizeTeam checks that a team belongs to an organization userID is a
+// member of. Changing the team is left to the organization admins and the
+// lead of the team.
+func authorizeTeam(ctx context.Context, q authz.Querier, userID, orgID, teamID int, manage bool) error {
+	role, err := authz.OrgMemberRole(ctx, q, userID, orgID)
+	if err != nil {
+		return err
+	}
+	var leadID sql.NullInt64
+	err = q.QueryRowContext(ctx,
+		`SELECT lead_id FROM teams WHERE id = $1 AND org_id = $2`, teamID, orgID,
+	).Scan(&leadID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTeamNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("get team: %w", err)
+	}
+	if manage && role != authz.OrgAdmin && int(leadID.Int64) != userID {
+		return fmt.Errorf("%w: only admins and the lead manage a team", authz.ErrForbidden)
+	}
+	return nil
+}
+
+// authorizeTeamGrants checks that userID may decide who holds the roles a
+// team has in projects. Organization admins may, the lead only when they
+// could manage a member with the role of the team in every project it is
+// granted on, or adding members would hand out roles above their own.
+func authorizeTeamGrants(ctx context.Context, tx *sql.Tx, userID, orgID, teamID int) error {
+	role, err := authz.OrgMemberRole(ctx, tx, userID, orgID)
+	if err != nil {
+		return err
+	}
+	if role == authz.OrgAdmin {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT pt.project_id, pt.role
+		FROM project_teams pt
+		JOIN projects p ON p.id = pt.project_id AND p.deleted_at IS NULL
+		WHERE pt.team_id = $1
+	`, teamID)
+	if err != nil {
+		return fmt.Errorf("list team projects: %w", err)
+	}
+	grants := map[int]authz.Role{}
+	for rows.Next() {
+		var projectID int
+		var granted authz.Role
+		if err := rows.Scan(&projectID, &granted); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan team project: %w", err)
+		}
+		grants[projectID] = granted
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list team projects: %w", err)
+	}
+
+	for projectID, granted := range grants {
+		actor, err := authz.MemberRole(ctx, tx, userID, projectID)
+		if errors.Is(err, authz.ErrNotMember) || (err == nil && !authz.CanManage(actor, granted)) {
+			return fmt.Errorf("%w: %w: %s in project %d", authz.ErrForbidden, ErrTeamRoleAboveLead, granted, projectID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTeamLead makes a member of the organization the lead of a team, and a
+// member of the team if they were not yet
+func setTeamLead(ctx context.Context, tx *sql.Tx, orgID, teamID, leadID int) error {
+	if _, err := authz.OrgMemberRole(ctx, tx, leadID, orgID); err != nil {
+		if errors.Is(err, authz.ErrNotOrgMember) {
+			return fmt.Errorf("lead not found: %w", sql.ErrNoRows)
+		}
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE teams SET lead_id = $1 WHERE id = $2`, leadID, teamID); err != nil {
+		return fmt.Errorf("set team lead: %w", err)
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO team_members (team_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (team_id, user_id) DO NOTHING
+	`, teamID, leadID)
+	if err != nil {
+		return fmt.Errorf("add team lead: %w", err)
+	}
+	return nil
+}
+
+// ListTeams returns the teams of an organization
+func (r *orgRepoImpl) ListTeams(ctx context.Context, userID, orgID int) ([]models.Team, error) {
+	if _, err := authz.OrgMemberRole(ctx, r.db, userID, orgID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx, teamQuery+`
+		WHERE t.org_id = $1
+		ORDER BY LOWER(t.name), t.id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("list teams: %w", err)
+	}
+	defer rows.Close()
+
+	teams := make([]models.Team, 0)
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// CreateTeam creates a team in an organization, led by leadID unless it is
+// nil
+func (r *orgRepoImpl) CreateTeam(ctx context.Context, userID, orgID int, name string, leadID *int) (models.Team, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Team{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := authz.AuthorizeOrg(ctx, tx, userID, orgID, true); err != nil {
+		return models.Team{}, err
+	}
+
+	var teamID int
+	err = tx.QueryRowContext(ctx,
+		`INSERT INTO teams (org_id, name) VALUES ($1, $2) RETURNING id`, orgID, name,
+	).Scan(&teamID)
+	if err != nil {
+		return models.Team{}, fmt.Errorf("create team: %w", err)
+	}
+	if leadID != nil {
+		if err := setTeamLead(ctx, tx, orgID, teamID, *leadID); err != nil {
+			return models.Team{}, err
+		}
+	}
+
+	team, err := scanTeam(tx.QueryRowContext(ctx, teamQuery+`WHERE t.id = $1`, teamID))
+	if err != nil {
+		return team, fmt.Errorf("get team: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return team, fmt.Errorf("commit transaction: %w", err)
+	}
+	return team, nil
+}
+
+// GetTeam returns a team with its members and the projects it has a role in
+func (r *orgRepoImpl) GetTeam(ctx context.Context, userID, orgID, teamID int) (models.TeamDetail, error) {
+	var detail models.TeamDetail
+
+	if err := authorizeTeam(ctx, r.db, userID, orgID, teamID, false); err != nil {
+		return detail, err
+	}
+	team, err := scanTeam(r.db.QueryRowContext(ctx, teamQuery+`WHERE t.id = $1`, teamID))
+	if err != nil {
+		return detail, fmt.Errorf("get team: %w", err)
+	}
+	detail.Team = team
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT u.id, u.name, u.username, u.email, u.avatar_url
+		FROM team_members tm
+		JOIN users u ON u.id = tm.user_id
+		WHERE tm.team_id = $1
+		ORDER BY LOWER(u.name), u.id
+	`, teamID)
+	if err != nil {
+		return detail, fmt.Errorf("list team members: %w", err)
+	}
+	defer rows.Close()
+
+	detail.Members = make([]models.User, 0)
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.AvatarUrl); err != nil {
+			return detail, err
+		}
+		detail.Members = append(detail.Members, u)
+	}
+	if err := rows.Err(); err != nil {
+		return detail, err
+	}
+
+	projectRows, err := r.db.QueryContext(ctx, `
+		SELECT p.id, p.title, pt.role
+		FROM project_teams pt
+		JOIN projects p ON p.id = pt.project_id
+		WHERE pt.team_id = $1 AND p.deleted_at IS NULL
+		ORDER BY LOWER(p.title), p.id
+	`, teamID)
+	if err != nil {
+		return detail, fmt.Errorf("list team projects: %w", err)
+	}
+	defer projectRows.Close()
+
+	detail.Projects = make([]models.TeamProject, 0)
+	for projectRows.Next() {
+		var p models.TeamProject
+		if err := projectRows.Scan(&p.ID, &p.Name, &p.Role); err != nil {
+			return detail, err
+		}
+		detail.Projects = append(detail.Projects, p)
+	}
+	return detail, projectRows.Err()
+}
+
+// UpdateTeam renames a team or changes its lead. A leadID of 0 leaves the
+// team without a lead. A new lead joins the team, so it is checked like
+// AddTeamMember.
+func (r *orgRepoImpl) UpdateTeam(ctx context.Context, userID, orgID, teamID int, name *string, leadID *int) (models.Team, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Team{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := authorizeTeam(ctx, tx, userID, orgID, teamID, true); err != nil {
+		return models.Team{}, err
+	}
+
+	if name != nil {
+		if _, err := tx.ExecContext(ctx, `UPDATE teams SET name = $1 WHERE id = $2`, *name, teamID); err != nil {
+			return models.Team{}, fmt.Errorf("rename team: %w", err)
+		}
+	}
+	switch {
+	case leadID == nil:
+	case *leadID == 0:
+		if _, err := tx.ExecContext(ctx, `UPDATE teams SET lead_id = NULL WHERE id = $1`, teamID); err != nil {
+			return models.Team{}, fmt.Errorf("clear team lead: %w", err)
+		}
+	default:
+		if err := authorizeTeamGrants(ctx, tx, userID, orgID, teamID); err != nil {
+			return models.Team{}, err
+		}
+		if err := setTeamLead(ctx, tx, orgID, teamID, *leadID); err != nil {
+			return models.Team{}, err
+		}
+	}
+
+	team, err := scanTeam(tx.QueryRowContext(ctx, teamQuery+`WHERE t.id = $1`, teamID))
+	if err != nil {
+		return team, fmt.Errorf("get team: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return team, fmt.Errorf("commit transaction: %w", err)
+	}
+	return team, nil
+}
+
+// DeleteTeam deletes a team, its members lose the roles it had in projects
+func (r *orgRepoImpl) DeleteTeam(ctx context.Context, userID, orgID, teamID int) error {
+	if _, err := authz.AuthorizeOrg(ctx, r.db, userID, orgID, true); err != nil {
+		return err
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM teams WHERE id = $1 AND org_id = $2`, teamID, orgID)
+	if err != nil {
+		return fmt.Errorf("delete team: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrTeamNotFound
+	}
+	return nil
+}
+
+// AddTeamMember adds a member of the organization to one of its teams. A
+// lead who is not an organization admin only adds members while they could
+// give them the roles of the team themselves.
+func (r *orgRepoImpl) AddTeamMember(ctx context.Context, userID, orgID, teamID int, username string) (models.User, error) {
+	var m models.User
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return m, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := authorizeTeam(ctx, tx, userID, orgID, teamID, true); err != nil {
+		return m, err
+	}
+	if err := authorizeTeamGrants(ctx, tx, userID, orgID, teamID); err != nil {
+		return m, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT u.id, u.name, u.username, u.email, u.avatar_url
+		FROM users u
+		JOIN organization_members om ON om.user_id = u.id AND om.org_id = $1
+		WHERE u.username = $2 AND u.deleted_at IS NULL
+	`, orgID, username).Scan(&m.ID, &m.Name, &m.Username, &m.Email, &m.AvatarUrl)
+	if err != nil {
+		return m, fmt.Errorf("member not found: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO team_members (team_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (team_id, user_id) DO NOTHING
+	`, teamID, m.ID)
+	if err != nil {
+		return m, fmt.Errorf("add team member: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return m, err
+	} else if n == 0 {
+		return m, ErrAlreadyTeamMember
+	}
+
+	if err := tx.Commit(); err != nil {
+		return m, fmt.Errorf("commit transaction: %w", err)
+	}
+	return m, nil
+}
+
+// RemoveTeamMember removes a member from a team. Admins and the lead remove
+// anyone and members may leave. A lead who leaves leaves the team without
+// a lead.
+func (r *orgRepoImpl) RemoveTeamMember(ctx context.Context, userID, orgID, teamID, memberID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := authorizeTeam(ctx, tx, userID, orgID, teamID, memberID != userID); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM team_members WHERE team_id = $1 AND user_id = $2`, teamID, memberID)
+	if err != nil {
+		return fmt.Errorf("remove team member: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("member not found: %w", sql.ErrNoRows)
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE teams SET lead_id = NULL WHERE id = $1 AND lead_id = $2`, teamID, memberID)
+	if err != nil {
+		return fmt.Errorf("clear team lead: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// leaveOrgTeams removes a user from the teams of an organization they leave
+func leaveOrgTeams(ctx context.Context, tx *sql.Tx, orgID, userID int) error {
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM team_members
+		WHERE team_id IN (SELECT id FROM teams WHERE org_id = $1) AND user_id = $2
+	`, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("leave teams: %w", err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`UPDATE teams SET lead_id = NULL WHERE org_id = $1 AND lead_id = $2`, orgID, userID)
+	if err != nil {
+		return fmt.Errorf("clear team leads: %w", err)
+	}
+	return nil
+}
+
+// projectTeam returns a team of the organization of a project, and its role
+// in the project if it has one
+func projectTeam(ctx context.Context, q authz.Querier, projectID, teamID int) (models.ProjectTeam, *authz.Role, error) {
+	var t models.ProjectTeam
+	var role sql.NullString
+	err := q.QueryRowContext(ctx, `
+		SELECT t.id, t.name,
+		       (SELECT COUNT(*) FROM team_members tm WHERE tm.team_id = t.id),
+		       pt.role
+		FROM projects p
+		JOIN teams t ON t.org_id = p.org_id
+		LEFT JOIN project_teams pt ON pt.team_id = t.id AND pt.project_id = p.id
+		WHERE p.id = $1 AND t.id = $2
+	`, projectID, teamID).Scan(&t.ID, &t.Name, &t.MemberCount, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return t, nil, ErrTeamNotFound
+	}
+	if err != nil {
+		return t, nil, fmt.Errorf("get team: %w", err)
+	}
+	if !role.Valid {
+		return t, nil, nil
+	}
+	current := authz.Role(role.String)
+	t.Role = role.String
+	return t, &current, nil
+}
+
+// AddTeamToProject gives every member of a team of the project's
+// organization role in the project, which has to be below the role of the
+// current user
+func (r *projectRepoImpl) AddTeamToProject(ctx context.Context, currentUserID, projectID, teamID int, role authz.Role) (models.ProjectTeam, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProjectTeam{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actor, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.ManageMembers)
+	if err != nil {
+		return models.ProjectTeam{}, err
+	}
+	if role == "" {
+		if role, err = defaultMemberRole(ctx, tx, projectID); err != nil {
+			return models.ProjectTeam{}, err
+		}
+	}
+	if !authz.CanManage(actor, role) {
+		return models.ProjectTeam{}, fmt.Errorf("%w: %s cannot add a team as %s", authz.ErrForbidden, actor, role)
+	}
+
+	team, current, err := projectTeam(ctx, tx, projectID, teamID)
+	if err != nil {
+		return team, err
+	}
+	if current != nil {
+		return team, ErrTeamAlreadyGranted
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO project_teams (project_id, team_id, role) VALUES ($1, $2, $3)`,
+		projectID, teamID, role)
+	if err != nil {
+		return team, fmt.Errorf("add team: %w", err)
+	}
+	team.Role = string(role)
+
+	err = recordAudit(ctx, tx, models.ProjectAuditEntry{
+		ProjectID: projectID,
+		ActorID:   &currentUserID,
+		Action:    models.AuditTeamGranted,
+		Details:   fmt.Sprintf("team %d (%s) added as %s", team.ID, team.Name, role),
+	})
+	if err != nil {
+		return team, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return team, fmt.Errorf("commit transaction: %w", err)
+	}
+	return team, nil
+}
+
+// ChangeTeamRole changes the role of a team in a project, under the same
+// rules as the role of a member
+func (r *projectRepoImpl) ChangeTeamRole(ctx context.Context, currentUserID, projectID, teamID int, role authz.Role) (models.ProjectTeam, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ProjectTeam{}, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actor, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.ManageMembers)
+	if err != nil {
+		return models.ProjectTeam{}, err
+	}
+	team, current, err := projectTeam(ctx, tx, projectID, teamID)
+	if err != nil {
+		return team, err
+	}
+	if current == nil {
+		return team, ErrTeamNotFound
+	}
+	if !authz.CanManage(actor, *current) || !authz.CanManage(actor, role) {
+		return team, fmt.Errorf("%w: %s cannot change a team from %s to %s", authz.ErrForbidden, actor, *current, role)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE project_teams SET role = $1 WHERE project_id = $2 AND team_id = $3`,
+		role, projectID, teamID)
+	if err != nil {
+		return team, fmt.Errorf("change team role: %w", err)
+	}
+	team.Role = string(role)
+
+	if err := tx.Commit(); err != nil {
+		return team, fmt.Errorf("commit transaction: %w", err)
+	}
+	return team, nil
+}
+
+// RemoveTeamFromProject takes the role of a team in a project away. Members
+// keep the roles they were given in person.
+func (r *projectRepoImpl) RemoveTeamFromProject(ctx context.Context, currentUserID, projectID, teamID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	actor, err := authz.Authorize(ctx, tx, currentUserID, projectID, authz.ManageMembers)
+	if err != nil {
+		return err
+	}
+	team, current, err := projectTeam(ctx, tx, projectID, teamID)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return ErrTeamNotFound
+	}
+	if !authz.CanManage(actor, *current) {
+		return fmt.Errorf("%w: %s cannot remove a team that is %s", authz.ErrForbidden, actor, *current)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM project_teams WHERE project_id = $1 AND team_id = $2`, projectID, teamID)
+	if err != nil {
+		return fmt.Errorf("remove team: %w", err)
+	}
+
+	err = recordAudit(ctx, tx, models.ProjectAuditEntry{
+		ProjectID: projectID,
+		ActorID:   &currentUserID,
+		Action:    models.AuditTeamRevoked,
+		Details:   fmt.Sprintf("team %d (%s) removed, was %s", team.ID, team.Name, *current),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
@@ -3,8 +3,19 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"task-matrix-be/internals/models"
+	"time"
+)
+
+// Purposes of single-use tokens sent to users by email
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeMFAChallenge      = "mfa_challenge"
+	TokenPurposeEmailChange       = "email_change"
+	TokenPurposeReauthentication  = "reauthentication"
 )
 
 type userRepoImpl struct {
@@ -13,31 +24,420 @@ type userRepoImpl struct {
 
 // CreateUser inserts a new user and returns the generated ID
 func (r *userRepoImpl) CreateUser(ctx context.Context, name, username, email, avatarUrl, hashedPassword string) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
 	query := `
 	INSERT INTO users (name, username, email, avatar_url, password)
 	VALUES ($1, $2, $3, $4, $5)
 	RETURNING id
 	`
 	var id int
-	err := r.db.QueryRowContext(ctx, query, name, username, email, avatarUrl, hashedPassword).Scan(&id)
+	err = tx.QueryRowContext(ctx, query, name, username, email, avatarUrl, hashedPassword).Scan(&id)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create user: %w", err)
 	}
+
+	if err := createPersonalOrg(ctx, tx, id, name); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit transaction: %w", err)
+	}
 	return id, nil
 }
 
-// GetUserByCreds fetches a user by username and password
-func (r *userRepoImpl) GetUserByCreds(ctx context.Context, username, hashedPassword string) (*models.User, error) {
+// GetUserByUsername fetches a user and their stored password hash by username
+func (r *userRepoImpl) GetUserByUsername(ctx context.Context, username string) (*models.User, string, error) {
+	query := `
+	SELECT id, name, username, email, avatar_url, password
+	FROM users
+	WHERE username = $1
+	`
+	row := r.db.QueryRowContext(ctx, query, username)
+
+	var user models.User
+	var hashedPassword string
+	if err := row.Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl, &hashedPassword); err != nil {
+		return nil, "", fmt.Errorf("failed to get user by username: %w", err)
+	}
+	return &user, hashedPassword, nil
+}
+
+// UpdatePasswordHash replaces the stored password hash of a user, which
+// satisfies a password reset required by an administrator
+func (r *userRepoImpl) UpdatePasswordHash(ctx context.Context, userID int, hashedPassword string) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET password = $1, password_reset_required = FALSE WHERE id = $2`, hashedPassword, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	return nil
+}
+
+// GetUserByEmail fetches a user by email address
+func (r *userRepoImpl) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
 	SELECT id, name, username, email, avatar_url
 	FROM users
-	WHERE username = $1 AND password = $2
+	WHERE email = $1
 	`
-	row := r.db.QueryRowContext(ctx, query, username, hashedPassword)
+	var user models.User
+	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return &user, nil
+}
 
+// IsEmailVerified reports whether the user has confirmed their email address
+func (r *userRepoImpl) IsEmailVerified(ctx context.Context, userID int) (bool, error) {
+	var verified bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1`, userID,
+	).Scan(&verified)
+	if err != nil {
+		return false, fmt.Errorf("failed to check email verification: %w", err)
+	}
+	return verified, nil
+}
+
+// MarkEmailVerified records that the user confirmed their email address
+func (r *userRepoImpl) MarkEmailVerified(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email_verified_at IS NULL`,
+		time.Now().UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	return nil
+}
+
+// CreateUserToken stores a single-use token for the user, replacing any
+// unused token previously issued for the same purpose
+func (r *userRepoImpl) CreateUserToken(ctx context.Context, userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purpose)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete previous tokens: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at) VALUES ($1, $2, $3, $4)`,
+		userID, purpose, tokenHash, expiresAt)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("insert token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ConsumeUserToken marks an unused, unexpired token as used and returns the
+// user it was issued to
+func (r *userRepoImpl) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (int, error) {
+	query := `
+	UPDATE user_tokens
+	SET used_at = $1
+	WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $1
+	RETURNING user_id
+	`
+	var userID int
+	err := r.db.QueryRowContext(ctx, query, time.Now().UTC(), tokenHash, purpose).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return userID, nil
+}
+
+// LookupUserToken returns the user an unused, unexpired token was issued to
+// without consuming it
+func (r *userRepoImpl) LookupUserToken(ctx context.Context, purpose, tokenHash string) (int, error) {
+	query := `
+	SELECT user_id FROM user_tokens
+	WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > $3
+	`
+	var userID int
+	err := r.db.QueryRowContext(ctx, query, tokenHash, purpose, time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up token: %w", err)
+	}
+	return userID, nil
+}
+
+// GetUserByID fetches a user by ID
+func (r *userRepoImpl) GetUserByID(ctx context.Context, userID int) (*models.User, error) {
+	query := `
+	SELECT id, name, username, email, avatar_url
+	FROM users
+	WHERE id = $1
+	`
 	var user models.User
-	if err := row.Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl); err != nil {
-		return nil, fmt.Errorf("failed to get user by credentials: %w", err)
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&user.ID, &user.Name, &user.Username, &user.Email, &user.AvatarUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
 	}
 	return &user, nil
 }
+
+// GetTOTP returns the user's TOTP secret (pending or confirmed) and whether it is enabled
+func (r *userRepoImpl) GetTOTP(ctx context.Context, userID int) (string, bool, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT totp_secret, totp_enabled FROM users WHERE id = $1`, userID,
+	).Scan(&secret, &enabled)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get totp settings: %w", err)
+	}
+	return secret.String, enabled, nil
+}
+
+// SetPendingTOTPSecret stores a secret that becomes active once EnableTOTP
+// is called. It never replaces the secret of an enabled TOTP.
+func (r *userRepoImpl) SetPendingTOTPSecret(ctx context.Context, userID int, secret string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2 AND totp_enabled = FALSE`,
+		secret, userID)
+	if err != nil {
+		return fmt.Errorf("failed to store totp secret: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errors.New("totp is already enabled")
+	}
+	return nil
+}
+
+// EnableTOTP activates the pending secret and replaces the recovery codes
+func (r *userRepoImpl) EnableTOTP(ctx context.Context, userID int, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET totp_enabled = TRUE WHERE id = $1 AND totp_secret IS NOT NULL`, userID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("enable totp: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP removes the TOTP secret and all recovery codes
+func (r *userRepoImpl) DisableTOTP(ctx context.Context, userID int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0 WHERE id = $1`, userID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("disable totp: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AdvanceTOTPStep records step as the last used TOTP time step. It returns
+// false if a code for this or a later step was already used (a replay).
+func (r *userRepoImpl) AdvanceTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_last_step < $1`, step, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record totp step: %w", err)
+	}
+	return n == 1, nil
+}
+
+// ReplaceRecoveryCodes discards every recovery code of the user and stores new ones
+func (r *userRepoImpl) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ConsumeRecoveryCode marks an unused recovery code of the user as used
+func (r *userRepoImpl) ConsumeRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE user_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`,
+		time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int, recoveryCodeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("delete recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return fmt.Errorf("insert recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetLoginLock returns until when logins for username are blocked; the zero
+// time if they are not
+func (r *userRepoImpl) GetLoginLock(ctx context.Context, username string) (time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := r.db.QueryRowContext(ctx,
+		`SELECT locked_until FROM login_throttles WHERE username = $1`, username,
+	).Scan(&lockedUntil)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get login lock: %w", err)
+	}
+	return lockedUntil.Time, nil
+}
+
+// RegisterFailedLogin counts a failed login for username and returns the
+// number of consecutive failures. Failures older than window are forgotten.
+func (r *userRepoImpl) RegisterFailedLogin(ctx context.Context, username string, window time.Duration) (int, error) {
+	now := time.Now().UTC()
+	query := `
+	INSERT INTO login_throttles (username, failed_count, last_failed_at)
+	VALUES ($1, 1, $2)
+	ON CONFLICT (username) DO UPDATE
+	SET failed_count = CASE
+			WHEN login_throttles.last_failed_at < $3 THEN 1
+			ELSE login_throttles.failed_count + 1
+		END,
+		last_failed_at = $2
+	RETURNING failed_count
+	`
+	var count int
+	err := r.db.QueryRowContext(ctx, query, username, now, now.Add(-window)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to register failed login: %w", err)
+	}
+	return count, nil
+}
+
+// SetLoginLock blocks logins for username until lockedUntil
+func (r *userRepoImpl) SetLoginLock(ctx context.Context, username string, lockedUntil time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE login_throttles SET locked_until = $1 WHERE username = $2`, lockedUntil, username)
+	if err != nil {
+		return fmt.Errorf("failed to set login lock: %w", err)
+	}
+	return nil
+}
+
+// ResetLoginThrottle forgets the failed logins and lock of username and
+// reports whether there was anything to reset
+func (r *userRepoImpl) ResetLoginThrottle(ctx context.Context, username string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM login_throttles WHERE username = $1`, username)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset login throttle: %w", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RecordLoginAttempt appends an entry to the login audit trail
+func (r *userRepoImpl) RecordLoginAttempt(ctx context.Context, attempt models.LoginAttempt) error {
+	query := `
+	INSERT INTO login_attempts (username, user_id, ip, user_agent, success, reason, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		attempt.Username, attempt.UserID, attempt.IP, attempt.UserAgent,
+		attempt.Success, attempt.Reason, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record login attempt: %w", err)
+	}
+	return nil
+}
+
+// ListLoginAttempts returns the most recent login attempts, optionally only
+// those for username
+func (r *userRepoImpl) ListLoginAttempts(ctx context.Context, username string, limit int) ([]models.LoginAttempt, error) {
+	query := `
+	SELECT id, username, user_id, ip, user_agent, success, reason, created_at
+	FROM login_attempts
+	WHERE $1 = '' OR username = $1
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2
+	`
+	rows, err := r.db.QueryContext(ctx, query, username, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := make([]models.LoginAttempt, 0)
+	for rows.Next() {
+		var a models.LoginAttempt
+		var userID sql.NullInt64
+		err := rows.Scan(&a.ID, &a.Username, &userID, &a.IP, &a.UserAgent, &a.Success, &a.Reason, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			a.UserID = &id
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"task-matrix-be/internals/models"
+)
+
+// escapeLike escapes the LIKE wildcards in s, for patterns using ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// SearchUsers finds users matching query on name, username or email among
+// those visible to viewerID, that is sharing a project, directly or through
+// a team, or an organization with them. Exact usernames rank first, then
+// prefixes of any field or word of the name, then substrings, then fuzzy
+// matches having the characters of query in order.
+func (r *userRepoImpl) SearchUsers(ctx context.Context, viewerID int, query string, limit, offset int) ([]models.User, error) {
+	q := strings.ToLower(strings.TrimSpace(query))
+	escaped := escapeLike(q)
+
+	var fuzzy strings.Builder
+	fuzzy.WriteString("%")
+	for _, c := range q {
+		fuzzy.WriteString(escapeLike(string(c)))
+		fuzzy.WriteString("%")
+	}
+
+	sqlQuery := `
+	SELECT u.id, u.name, u.username, u.email, u.avatar_url
+	FROM users u
+	WHERE (
+		EXISTS (
+			SELECT 1
+			FROM projects p
+			WHERE p.deleted_at IS NULL
+			  AND p.id IN (` + visibleProjectIDs("$1") + `)
+			  AND p.id IN (` + visibleProjectIDs("u.id") + `)
+		)
+		OR EXISTS (
+			SELECT 1
+			FROM organization_members om
+			JOIN organization_members mine ON mine.org_id = om.org_id
+			WHERE om.user_id = u.id AND mine.user_id = $1
+		)
+	)
+	AND u.deleted_at IS NULL
+	AND (
+		$2 = ''
+		OR LOWER(u.username) LIKE $3 ESCAPE '\'
+		OR LOWER(u.name) LIKE $3 ESCAPE '\'
+		OR LOWER(u.email) LIKE $3 ESCAPE '\'
+	)
+	ORDER BY
+		CASE
+			WHEN LOWER(u.username) = $2 THEN 0
+			WHEN LOWER(u.username) LIKE $4 ESCAPE '\'
+				OR LOWER(u.name) LIKE $4 ESCAPE '\'
+				OR LOWER(u.name) LIKE $5 ESCAPE '\'
+				OR LOWER(u.email) LIKE $4 ESCAPE '\' THEN 1
+			WHEN LOWER(u.username) LIKE $6 ESCAPE '\'
+				OR LOWER(u.name) LIKE $6 ESCAPE '\'
+				OR LOWER(u.email) LIKE $6 ESCAPE '\' THEN 2
+			ELSE 3
+		END,
+		LOWER(u.name), u.id
+	LIMIT $7 OFFSET $8
+	`
+	rows, err := r.db.QueryContext(ctx, sqlQuery,
+		viewerID, q, fuzzy.String(), escaped+"%", "% "+escaped+"%", "%"+escaped+"%", limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Username, &u.Email, &u.AvatarUrl); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
@@ -24,7 +24,7 @@ func NewChiRouter() *chi.Mux {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", services.OrgHeader, services.SharePasswordHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -32,36 +32,179 @@ func NewChiRouter() *chi.Mux {
 	return r
 }
 
-func RegisterRoutes(r *chi.Mux, user services.UserService, project services.ProjectService, task services.TaskService, validateTokenFunc func(tokenStr string) (models.User, error)) {
+func RegisterRoutes(r *chi.Mux, user services.UserService, project services.ProjectService, task services.TaskService, org services.OrgService, validateTokenFunc func(tokenStr string) (models.User, error)) {
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("healthy"))
 	})
 
+	authMiddleware := middlewares.AuthMiddleware(validateTokenFunc, user.ValidateAPIKey)
+
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/login", user.Login)
+		r.Post("/login/mfa", user.LoginMFA)
 		r.Post("/signup", user.Signup)
+		r.Post("/refresh", user.Refresh)
+		r.Post("/forgot-password", user.ForgotPassword)
+		r.Post("/reset-password", user.ResetPassword)
+		r.Post("/verify-email", user.VerifyEmail)
+		r.Get("/oidc/login", user.OIDCLogin)
+		r.Get("/oidc/callback", user.OIDCCallback)
 		r.Route("/validate", func(r chi.Router) {
-			r.Use(middlewares.AuthMiddleware(validateTokenFunc))
+			r.Use(authMiddleware)
 			r.Get("/", user.GetLoggedInUser)
 		})
+		r.Group(func(r chi.Router) {
+			r.Use(authMiddleware)
+			r.Use(middlewares.RejectAPIKeys)
+			r.Post("/logout", user.Logout)
+			r.Get("/sessions", user.ListSessions)
+			r.Delete("/sessions", user.RevokeAllSessions)
+			r.Delete("/sessions/{id}", user.RevokeSession)
+			r.Post("/verify-email/resend", user.ResendVerificationEmail)
+			r.Post("/mfa/totp/setup", user.SetupTOTP)
+			r.Post("/mfa/totp/confirm", user.ConfirmTOTP)
+			r.Post("/mfa/totp/disable", user.DisableTOTP)
+			r.Post("/mfa/recovery-codes", user.RegenerateRecoveryCodes)
+		})
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Use(middlewares.RejectAPIKeys)
+		r.Use(middlewares.RequireAdmin(user.IsAdmin))
+		r.Get("/login-attempts", user.ListLoginAttempts)
+		r.Delete("/lockouts/{username}", user.UnlockAccount)
+		r.Get("/users", user.ListUsers)
+		r.Get("/users/{id}", user.GetUser)
+		r.Patch("/users/{id}", user.UpdateUser)
+		r.Post("/users/{id}/disable", user.DisableUser)
+		r.Post("/users/{id}/enable", user.EnableUser)
+		r.Post("/users/{id}/force-password-reset", user.ForcePasswordReset)
+		r.Get("/projects", user.ListAllProjects)
+		r.Get("/stats", user.GetSystemStats)
+	})
+
+	// Profile routes stay reachable with an unverified email, so that a
+	// mistyped address can be corrected
+	r.Route("/me", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Get("/", user.GetProfile)
+		r.With(user.RequireVerifiedEmail).Get("/tasks", task.ListMyTasks)
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RejectAPIKeys)
+			r.Patch("/", user.UpdateProfile)
+			r.Post("/change-password", user.ChangePassword)
+			r.Post("/change-email", user.ChangeEmail)
+			r.Get("/export", user.ExportAccount)
+			r.Delete("/", user.DeleteAccount)
+			r.Post("/reauthenticate", user.RequestReauthentication)
+			r.Get("/invitations", project.ListMyInvitations)
+			r.Post("/invitations/{id}/accept", project.AcceptMyInvitation)
+			r.Post("/invitations/{id}/decline", project.DeclineMyInvitation)
+			r.Get("/org-invitations", org.ListMyOrgInvitations)
+			r.Post("/org-invitations/{id}/accept", org.AcceptMyOrgInvitation)
+			r.Post("/org-invitations/{id}/decline", org.DeclineMyOrgInvitation)
+		})
+		r.Route("/api-keys", func(r chi.Router) {
+			r.Use(middlewares.RejectAPIKeys)
+			r.Use(user.RequireVerifiedEmail)
+			r.Get("/", user.ListAPIKeys)
+			r.Post("/", user.CreateAPIKey)
+			r.Get("/{id}", user.GetAPIKey)
+			r.Patch("/{id}", user.UpdateAPIKey)
+			r.Delete("/{id}", user.DeleteAPIKey)
+		})
+	})
+
+	// Invitation links are answered by token, whatever the email of the
+	// account opening them
+	r.Route("/invitations", func(r chi.Router) {
+		r.Use(authMiddleware)
+		r.Use(middlewares.RejectAPIKeys)
+		r.Post("/accept", project.AcceptInvitation)
+		r.Post("/decline", project.DeclineInvitation)
+	})
+
+	// Share links are opened by people without an account, the tighter rate
+	// limit slows down guessing passwords
+	r.Route("/share", func(r chi.Router) {
+		r.Use(httprate.LimitByIP(20, time.Minute))
+		r.Get("/{slug}", project.ViewSharedProject)
 	})
 
 	r.Route("/", func(r chi.Router) {
-		r.Use(middlewares.AuthMiddleware(validateTokenFunc))
+		r.Use(authMiddleware)
+		r.Use(user.RequireVerifiedEmail)
+
+		r.Get("/users", user.SearchUsers)
 
+		r.Route("/orgs", func(r chi.Router) {
+			r.Get("/", org.ListOrganizations)
+			r.Get("/{org}", org.GetOrganization)
+			r.Get("/{org}/projects", project.GetAllProjects)
+			r.Get("/{org}/invitations", org.ListOrgInvitations)
+			r.Get("/{org}/teams", org.ListTeams)
+			r.Get("/{org}/teams/{team}", org.GetTeam)
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.RequireScope(models.ScopeProjectsAdmin))
+				r.Post("/", org.CreateOrganization)
+				r.Patch("/{org}", org.UpdateOrganization)
+				r.Post("/{org}/projects", project.CreateProject)
+				r.Post("/{org}/members/{username}", org.InviteOrgMember)
+				r.Delete("/{org}/invitations/{invitationID}", org.RevokeOrgInvitation)
+				r.Patch("/{org}/members/{userID}", org.ChangeOrgMemberRole)
+				r.Delete("/{org}/members/{userID}", org.RemoveOrgMember)
+				r.Post("/{org}/teams", org.CreateTeam)
+				r.Patch("/{org}/teams/{team}", org.UpdateTeam)
+				r.Delete("/{org}/teams/{team}", org.DeleteTeam)
+				r.Post("/{org}/teams/{team}/members/{username}", org.AddTeamMember)
+				r.Delete("/{org}/teams/{team}/members/{userID}", org.RemoveTeamMember)
+			})
+		})
+
+		// Without an /orgs prefix the organization comes from the X-Org-ID
+		// header, listing covers all of them and new projects go to the
+		// personal organization
 		r.Route("/projects", func(r chi.Router) {
-			r.Post("/", project.CreateProject)
 			r.Get("/", project.GetAllProjects)
 			r.Get("/{id}", project.ViewProject)
-			r.Put("/{id}", project.UpdateProject)
-			r.Post("/{id}/members/{username}", project.AddMemberToProject)
-			r.Delete("/{id}/members/{userID}", project.RemoveMemberFromProject)
-			r.Delete("/{id}", project.DeleteProject)
+			r.Get("/{id}/audit-log", project.GetAuditLog)
+			r.Get("/{id}/invitations", project.ListInvitations)
+			r.Get("/{id}/share-links", project.ListShareLinks)
+			r.Get("/{id}/dependency-graph", task.GetDependencyGraph)
+			r.Group(func(r chi.Router) {
+				r.Use(middlewares.RequireScope(models.ScopeProjectsAdmin))
+				r.Post("/", project.CreateProject)
+				r.Put("/{id}", project.UpdateProject)
+				r.Post("/{id}/members/{username}", project.InviteMember)
+				r.Patch("/{id}/members/{userID}", project.ChangeMemberRole)
+				r.Delete("/{id}/members/{userID}", project.RemoveMemberFromProject)
+				r.Post("/{id}/teams/{teamID}", project.AddTeamToProject)
+				r.Patch("/{id}/teams/{teamID}", project.ChangeTeamRole)
+				r.Delete("/{id}/teams/{teamID}", project.RemoveTeamFromProject)
+				r.Delete("/{id}", project.DeleteProject)
+				r.Post("/{id}/transfer", project.TransferProject)
+				r.Post("/{id}/invitations", project.CreateInvitation)
+				r.Delete("/{id}/invitations/{invitationID}", project.RevokeInvitation)
+				r.Post("/{id}/share-links", project.CreateShareLink)
+				r.Delete("/{id}/share-links/{linkID}", project.DeleteShareLink)
+			})
 			r.Route("/{projectId}/tasks", func(r chi.Router) {
-				r.Post("/", task.CreateTask)
-				r.Put("/{taskId}", task.UpdateTask)
-				r.Delete("/{taskId}", task.DeleteTask)
+				r.Get("/", task.ListTasks)
+				r.Get("/{taskId}", task.GetTask)
+				r.Get("/{taskId}/checklist", task.ListChecklist)
+				r.Group(func(r chi.Router) {
+					r.Use(middlewares.RequireScope(models.ScopeTasksWrite, models.ScopeProjectsAdmin))
+					r.Post("/", task.CreateTask)
+					r.Put("/{taskId}", task.UpdateTask)
+					r.Delete("/{taskId}", task.DeleteTask)
+					r.Post("/{taskId}/checklist", task.AddChecklistItem)
+					r.Put("/{taskId}/checklist/{itemId}", task.UpdateChecklistItem)
+					r.Delete("/{taskId}/checklist/{itemId}", task.DeleteChecklistItem)
+					r.Post("/{taskId}/blockers", task.AddTaskBlocker)
+					r.Delete("/{taskId}/blockers/{blockerId}", task.RemoveTaskBlocker)
+				})
 			})
 		})
 	})
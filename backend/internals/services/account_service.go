@@ -0,0 +1,227 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"task-matrix-be/internals/mailer"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"task-matrix-be/internals/utils"
+	"time"
+)
+
+// reauthTTL is how long a mailed reauthentication link stays valid
+const reauthTTL = 15 * time.Minute
+
+// RequestReauthentication mails the user a single-use token that stands in
+// for their password on the sensitive /me endpoints. Accounts created
+// through single sign-on have a random password, this is how they confirm
+// those changes.
+func (s *userServiceImpl) RequestReauthentication(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	current, err := s.repo.GetUserByID(r.Context(), user.ID)
+	if err == nil {
+		err = s.sendEmailToken(r.Context(), *current, repo.TokenPurposeReauthentication, reauthTTL,
+			"/reauthenticate", "Confirm it is you",
+			"Hi %s,\n\nA change to your account, such as deleting it or changing its password or email address, needs you to confirm it is you. If you started it, open the link below to continue:\n\n%s\n\nThe link expires in %s. If it was not you, sign out of your other sessions.\n")
+	}
+	if err != nil {
+		log.Printf("[ERROR] [RequestReauthentication] Failed to send a reauthentication link to user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [RequestReauthentication] Reauthentication link sent to user ID %d", user.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message":"A confirmation link has been sent to your email address"}`))
+}
+
+// reauthenticate checks that a sensitive request comes from the account
+// holder, by their password or by a token from RequestReauthentication. It
+// answers the request itself and returns false when it does not.
+func (s *userServiceImpl) reauthenticate(w http.ResponseWriter, r *http.Request, handler string, userID int, password, reauthToken string) bool {
+	if reauthToken != "" {
+		tokenHash := utils.HashToken(reauthToken)
+		tokenUserID, err := s.repo.LookupUserToken(r.Context(), repo.TokenPurposeReauthentication, tokenHash)
+		if err == nil && tokenUserID == userID {
+			_, err = s.repo.ConsumeUserToken(r.Context(), repo.TokenPurposeReauthentication, tokenHash)
+		}
+		if err != nil || tokenUserID != userID {
+			log.Printf("[WARN] [%s] Invalid or expired reauthentication token for user ID %d", handler, userID)
+			http.Error(w, "Invalid or expired reauthentication token", http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+
+	hashed, err := s.repo.GetPasswordHash(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] [%s] Failed to load user ID %d: %v", handler, userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	match, _, err := utils.VerifyPassword(hashed, password)
+	if err != nil {
+		log.Printf("[ERROR] [%s] Failed to verify password for user ID %d: %v", handler, userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !match {
+		log.Printf("[WARN] [%s] Wrong password for user ID %d", handler, userID)
+		http.Error(w, "Password is incorrect", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (s *userServiceImpl) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "zip" {
+		http.Error(w, "format must be json or zip", http.StatusBadRequest)
+		return
+	}
+
+	export, err := s.repo.ExportAccount(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ExportAccount] Failed to export data of user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to export account data", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [ExportAccount] User ID %d exported their data as %s", user.ID, format)
+
+	filename := fmt.Sprintf("task-matrix-export-%s", export.ExportedAt.Format("20060102"))
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(export)
+		return
+	}
+
+	// The archive has one file per part of the export
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"owned_projects.json", export.OwnedProjects},
+		{"memberships.json", export.Memberships},
+		{"assigned_tasks.json", export.AssignedTasks},
+	}
+	for _, f := range files {
+		fw, err := archive.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err == nil {
+			enc := json.NewEncoder(fw)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			log.Printf("[ERROR] [ExportAccount] Failed to write %s for user ID %d: %v", f.name, user.ID, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("[ERROR] [ExportAccount] Failed to finish archive for user ID %d: %v", user.ID, err)
+	}
+}
+
+func (s *userServiceImpl) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.DeleteAccountPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [DeleteAccount] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.ProjectAction == "" {
+		payload.ProjectAction = models.ProjectActionTransfer
+	}
+	if payload.ProjectAction != models.ProjectActionTransfer && payload.ProjectAction != models.ProjectActionArchive {
+		http.Error(w, "project_action must be transfer or archive", http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.repo.GetUserByID(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [DeleteAccount] Failed to load user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !s.reauthenticate(w, r, "DeleteAccount", user.ID, payload.Password, payload.ReauthToken) {
+		return
+	}
+
+	// The anonymised row keeps a random password nobody knows
+	password, err := utils.RandomToken()
+	var unusable string
+	if err == nil {
+		unusable, err = utils.HashPassword(password)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [DeleteAccount] Failed to generate password for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := s.repo.DeleteAccount(r.Context(), user.ID, unusable,
+		payload.ProjectAction == models.ProjectActionArchive, payload.TransferTo)
+	if errors.Is(err, repo.ErrInvalidTransferTarget) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [DeleteAccount] Failed to delete user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.auth.RevokeAllForUser(*current); err != nil {
+		log.Printf("[ERROR] [DeleteAccount] Failed to revoke sessions for user ID %d: %v", user.ID, err)
+	}
+
+	s.deliver(user.ID, mailer.Message{
+		To:      current.Email,
+		Subject: "Your account was deleted",
+		Body:    fmt.Sprintf("Hi %s,\n\nYour account and personal data were deleted as requested. Projects you owned were transferred to other members or archived.\n", current.Name),
+	})
+
+	log.Printf("[INFO] [DeleteAccount] User ID %d deleted their account: %d projects transferred, %d archived, %d tasks reassigned",
+		user.ID, len(result.TransferredProjects), len(result.ArchivedProjects), result.ReassignedTasks)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"task-matrix-be/internals/authmodule"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultAdminListLimit = 50
+	maxAdminListLimit     = 200
+
+	// activeUserWindow is how recently users must have logged in to count as
+	// active in the system statistics
+	activeUserWindow = 30 * 24 * time.Hour
+)
+
+// Reasons recorded in the login audit trail for accounts an administrator
+// blocked
+const (
+	loginReasonDisabled              = "account_disabled"
+	loginReasonPasswordResetRequired = "password_reset_required"
+)
+
+var errAccountDisabled = errors.New("this account has been disabled")
+
+// ValidateToken authenticates bearer tokens for the AuthMiddleware. Disabling
+// an account revokes its sessions, but JWT access tokens stay valid until
+// they expire, so the account is checked again on every request.
+func (s *userServiceImpl) ValidateToken(tokenStr string) (models.User, error) {
+	user, err := s.auth.Validate(tokenStr)
+	if err != nil {
+		return user, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	status, err := s.repo.GetAccountStatus(ctx, user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ValidateToken] Failed to load account status of user ID %d: %v", user.ID, err)
+		return models.User{}, authmodule.ErrInvalidToken
+	}
+	if status.Disabled {
+		return models.User{}, errAccountDisabled
+	}
+	return user, nil
+}
+
+// IsAdmin tells the RequireAdmin middleware whether a user is an
+// administrator. Disabled accounts never are.
+func (s *userServiceImpl) IsAdmin(ctx context.Context, userID int) (bool, error) {
+	return s.repo.IsAdmin(ctx, userID)
+}
+
+// checkAccountStatus answers a login of a disabled account, or a password
+// login of an account whose password has to be reset, and reports whether
+// the login may go on
+func (s *userServiceImpl) checkAccountStatus(w http.ResponseWriter, r *http.Request, user models.User, passwordLogin bool) bool {
+	status, err := s.repo.GetAccountStatus(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to load account status of user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+
+	switch {
+	case status.Disabled:
+		log.Printf("[WARN] [Login] Login of disabled user ID %d refused", user.ID)
+		s.recordLoginAttempt(r.Context(), r, user.Username, &user.ID, false, loginReasonDisabled)
+		http.Error(w, "This account has been disabled", http.StatusForbidden)
+		return false
+	case status.PasswordResetRequired && passwordLogin:
+		s.recordLoginAttempt(r.Context(), r, user.Username, &user.ID, false, loginReasonPasswordResetRequired)
+		http.Error(w, "Your password has to be reset, use the link sent to your email address", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (s *userServiceImpl) ListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := parsePagination(r, defaultAdminListLimit, maxAdminListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 200 and offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", repo.UserStatusActive, repo.UserStatusDisabled, repo.UserStatusDeleted:
+	default:
+		http.Error(w, "status must be active, disabled or deleted", http.StatusBadRequest)
+		return
+	}
+	adminsOnly := r.URL.Query().Get("admin") == "true"
+
+	// One more than requested tells whether there is a next page
+	users, err := s.repo.ListUsers(r.Context(), r.URL.Query().Get("q"), status, adminsOnly, limit+1, offset)
+	if err != nil {
+		log.Printf("[ERROR] [ListUsers] Failed to list users: %v", err)
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"users":    users,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	})
+}
+
+func (s *userServiceImpl) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse user ID", http.StatusBadRequest)
+		return
+	}
+
+	s.writeAdminUser(w, r, userID)
+}
+
+func (s *userServiceImpl) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse user ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.AdminUpdateUserPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.IsAdmin != nil {
+		err := s.repo.SetAdmin(r.Context(), userID, *payload.IsAdmin)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		case errors.Is(err, repo.ErrLastAdmin):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("[ERROR] [UpdateUser] Failed to change administrator flag of user ID %d: %v", userID, err)
+			http.Error(w, "Failed to update the user", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[INFO] [UpdateUser] User ID %d set administrator of user ID %d to %t", admin.ID, userID, *payload.IsAdmin)
+	}
+
+	s.writeAdminUser(w, r, userID)
+}
+
+func (s *userServiceImpl) DisableUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, true)
+}
+
+func (s *userServiceImpl) EnableUser(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, false)
+}
+
+// setUserDisabled disables or re-enables the account in the path. Disabled
+// users are logged out everywhere, ValidateToken and ValidateAPIKey turn
+// down the tokens and API keys they still hold.
+func (s *userServiceImpl) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	admin, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse user ID", http.StatusBadRequest)
+		return
+	}
+	if disabled && userID == admin.ID {
+		http.Error(w, "You cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.SetUserDisabled(r.Context(), userID, disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [DisableUser] Failed to change user ID %d: %v", userID, err)
+		http.Error(w, "Failed to update the user", http.StatusInternalServerError)
+		return
+	}
+
+	if disabled {
+		if err := s.auth.RevokeAllForUser(models.User{ID: userID}); err != nil {
+			log.Printf("[ERROR] [DisableUser] Failed to revoke sessions of user ID %d: %v", userID, err)
+		}
+		log.Printf("[INFO] [DisableUser] User ID %d disabled user ID %d", admin.ID, userID)
+	} else {
+		log.Printf("[INFO] [EnableUser] User ID %d enabled user ID %d", admin.ID, userID)
+	}
+
+	s.writeAdminUser(w, r, userID)
+}
+
+// ForcePasswordReset logs a user out everywhere and blocks their password
+// logins until they set a new password through the reset link mailed to them
+func (s *userServiceImpl) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse user ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.RequirePasswordReset(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ForcePasswordReset] Failed to require reset for user ID %d: %v", userID, err)
+		http.Error(w, "Failed to force a password reset", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.auth.RevokeAllForUser(models.User{ID: userID}); err != nil {
+		log.Printf("[ERROR] [ForcePasswordReset] Failed to revoke sessions of user ID %d: %v", userID, err)
+	}
+
+	user, err := s.repo.GetUserByID(r.Context(), userID)
+	if err == nil {
+		err = s.sendEmailToken(r.Context(), *user, repo.TokenPurposePasswordReset, s.cfg.PASSWORD_RESET_TTL,
+			"/reset-password", "Reset your password",
+			"Hi %s,\n\nAn administrator asked you to choose a new password. Open the link below to set it:\n\n%s\n\nThe link expires in %s. You can also ask for a new link from the login page.\n")
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ForcePasswordReset] Failed to send reset link to user ID %d: %v", userID, err)
+	}
+
+	log.Printf("[INFO] [ForcePasswordReset] User ID %d forced a password reset of user ID %d", admin.ID, userID)
+
+	s.writeAdminUser(w, r, userID)
+}
+
+func (s *userServiceImpl) ListAllProjects(w http.ResponseWriter, r *http.Request) {
+	limit, offset, ok := parsePagination(r, defaultAdminListLimit, maxAdminListLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 200 and offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	deleted := r.URL.Query().Get("deleted")
+	switch deleted {
+	case "":
+		deleted = repo.DeletedInclude
+	case repo.DeletedInclude, repo.DeletedExclude, repo.DeletedOnly:
+	default:
+		http.Error(w, "deleted must be include, exclude or only", http.StatusBadRequest)
+		return
+	}
+
+	projects, err := s.projects.ListAllProjects(r.Context(), r.URL.Query().Get("q"), deleted, limit+1, offset)
+	if err != nil {
+		log.Printf("[ERROR] [ListAllProjects] Failed to list projects: %v", err)
+		http.Error(w, "Failed to list projects", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(projects) > limit
+	if hasMore {
+		projects = projects[:limit]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"projects": projects,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	})
+}
+
+func (s *userServiceImpl) GetSystemStats(w http.ResponseWriter, r *http.Request) {
+	// Sessions of the redis and memory backends are not in the database
+	var sessionTable string
+	switch s.cfg.AUTH_BACKEND {
+	case "database":
+		sessionTable = "sessions"
+	case "jwt":
+		sessionTable = "refresh_sessions"
+	}
+
+	stats, err := s.repo.GetSystemStats(r.Context(), time.Now().UTC().Add(-activeUserWindow), sessionTable)
+	if err != nil {
+		log.Printf("[ERROR] [GetSystemStats] Failed to compute statistics: %v", err)
+		http.Error(w, "Failed to compute statistics", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(stats)
+}
+
+// writeAdminUser answers with a user as shown in the admin console
+func (s *userServiceImpl) writeAdminUser(w http.ResponseWriter, r *http.Request, userID int) {
+	user, err := s.repo.GetAdminUser(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [Admin] Failed to get user ID %d: %v", userID, err)
+		http.Error(w, "Failed to query the user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
+}
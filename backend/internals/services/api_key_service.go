@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/authmodule"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// apiKeyPrefix marks API keys so that they are recognisable in configs
+	// and secret scanners
+	apiKeyPrefix = "tm_"
+	// apiKeyDisplayLength is how much of a key is kept in clear to tell keys apart
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+	// apiKeyUsageGranularity throttles last-used updates of busy keys
+	apiKeyUsageGranularity = time.Minute
+)
+
+var apiKeyScopes = []string{models.ScopeReadOnly, models.ScopeTasksWrite, models.ScopeProjectsAdmin}
+
+// validateAPIKeyScopes checks that scopes is a non-empty set of known scopes
+// and returns it without duplicates
+func validateAPIKeyScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	var valid []string
+	for _, scope := range scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(apiKeyScopes, ", "))
+		}
+		if !slices.Contains(valid, scope) {
+			valid = append(valid, scope)
+		}
+	}
+
+	if len(valid) > 1 && slices.Contains(valid, models.ScopeReadOnly) {
+		return nil, errors.New("read-only cannot be combined with other scopes")
+	}
+	return valid, nil
+}
+
+// ValidateAPIKey resolves an "ApiKey" Authorization header for AuthMiddleware
+func (s *userServiceImpl) ValidateAPIKey(ctx context.Context, key string) (models.User, models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return models.User{}, models.APIKey{}, authmodule.ErrInvalidToken
+	}
+
+	apiKey, user, err := s.repo.GetAPIKeyByHash(ctx, utils.HashToken(key))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[ERROR] [ValidateAPIKey] Failed to look up API key: %v", err)
+		}
+		return models.User{}, models.APIKey{}, authmodule.ErrInvalidToken
+	}
+
+	now := time.Now().UTC()
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		return models.User{}, models.APIKey{}, authmodule.ErrTokenExpired
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyUsageGranularity {
+		if err := s.repo.TouchAPIKey(ctx, apiKey.ID, now); err != nil {
+			log.Printf("[WARN] [ValidateAPIKey] Failed to record use of API key ID %d: %v", apiKey.ID, err)
+		}
+		apiKey.LastUsedAt = &now
+	}
+
+	return *user, *apiKey, nil
+}
+
+func (s *userServiceImpl) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.APIKeyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [CreateAPIKey] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" || len(payload.Name) > 100 {
+		http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := validateAPIKeyScopes(payload.Scopes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	if payload.ExpiresAt != nil {
+		if !payload.ExpiresAt.After(now) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		expiresAt := payload.ExpiresAt.UTC()
+		payload.ExpiresAt = &expiresAt
+	}
+
+	secret, err := utils.RandomToken()
+	if err != nil {
+		log.Printf("[ERROR] [CreateAPIKey] Failed to generate key for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := models.APIKey{
+		Name:      payload.Name,
+		Prefix:    key[:apiKeyDisplayLength],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: payload.ExpiresAt,
+	}
+	apiKey.ID, err = s.repo.CreateAPIKey(r.Context(), user.ID, apiKey, utils.HashToken(key))
+	if err != nil {
+		log.Printf("[ERROR] [CreateAPIKey] Failed to store key for user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [CreateAPIKey] User ID %d created API key ID %d", user.ID, apiKey.ID)
+
+	// The key itself is only ever shown in this response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+func (s *userServiceImpl) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	keys, err := s.repo.ListAPIKeys(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ListAPIKeys] Failed to list keys for user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (s *userServiceImpl) GetAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.repo.GetAPIKey(r.Context(), user.ID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [GetAPIKey] Failed to get key %d for user ID %d: %v", keyID, user.ID, err)
+		http.Error(w, "Failed to get API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *userServiceImpl) UpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.UpdateAPIKeyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [UpdateAPIKey] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.repo.GetAPIKey(r.Context(), user.ID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [UpdateAPIKey] Failed to get key %d for user ID %d: %v", keyID, user.ID, err)
+		http.Error(w, "Failed to update API key", http.StatusInternalServerError)
+		return
+	}
+
+	if payload.Name != nil {
+		key.Name = strings.TrimSpace(*payload.Name)
+		if key.Name == "" || len(key.Name) > 100 {
+			http.Error(w, "Name is required and must be at most 100 characters", http.StatusBadRequest)
+			return
+		}
+	}
+	if payload.Scopes != nil {
+		if key.Scopes, err = validateAPIKeyScopes(payload.Scopes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.repo.UpdateAPIKey(r.Context(), user.ID, *key); err != nil {
+		log.Printf("[ERROR] [UpdateAPIKey] Failed to update key %d for user ID %d: %v", keyID, user.ID, err)
+		http.Error(w, "Failed to update API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(key)
+}
+
+func (s *userServiceImpl) DeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	keyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.DeleteAPIKey(r.Context(), user.ID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [DeleteAPIKey] Failed to delete key %d for user ID %d: %v", keyID, user.ID, err)
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [DeleteAPIKey] User ID %d revoked API key ID %d", user.ID, keyID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// taskURLParams reads the project and task IDs of a task route
+func taskURLParams(w http.ResponseWriter, r *http.Request) (projectID, taskID int, ok bool) {
+	projectID, err := strconv.Atoi(chi.URLParam(r, "projectId"))
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	taskID, err = strconv.Atoi(chi.URLParam(r, "taskId"))
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return projectID, taskID, true
+}
+
+// decodeChecklistItemPayload reads a checklist item from the request body
+func decodeChecklistItemPayload(w http.ResponseWriter, r *http.Request) (models.ChecklistItemPayload, bool) {
+	var payload models.ChecklistItemPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return payload, false
+	}
+	payload.Title = strings.TrimSpace(payload.Title)
+	if payload.Title == "" {
+		http.Error(w, "Checklist item title is required", http.StatusBadRequest)
+		return payload, false
+	}
+	return payload, true
+}
+
+func (s *taskServiceImpl) ListChecklist(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, taskID, ok := taskURLParams(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := s.repo.ListChecklistItems(r.Context(), currentUser.ID, projectID, taskID)
+	if err != nil {
+		log.Printf("[ERROR] [ListChecklist] Failed to list the checklist of task ID %d: %v", taskID, err)
+		writeTaskError(w, err, "Failed to query the checklist")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(items)
+}
+
+func (s *taskServiceImpl) AddChecklistItem(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, taskID, ok := taskURLParams(w, r)
+	if !ok {
+		return
+	}
+	payload, ok := decodeChecklistItemPayload(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := s.repo.AddChecklistItem(r.Context(), currentUser.ID, projectID, taskID, payload.Title, payload.Done)
+	if err != nil {
+		log.Printf("[ERROR] [AddChecklistItem] Failed to add a checklist item to task ID %d: %v", taskID, err)
+		writeTaskError(w, err, "Failed to add the checklist item")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+func (s *taskServiceImpl) UpdateChecklistItem(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, taskID, ok := taskURLParams(w, r)
+	if !ok {
+		return
+	}
+	itemID, err := strconv.Atoi(chi.URLParam(r, "itemId"))
+	if err != nil {
+		http.Error(w, "Invalid checklist item ID", http.StatusBadRequest)
+		return
+	}
+	payload, ok := decodeChecklistItemPayload(w, r)
+	if !ok {
+		return
+	}
+
+	item, err := s.repo.UpdateChecklistItem(r.Context(), currentUser.ID, projectID, taskID, itemID, payload.Title, payload.Done)
+	if err != nil {
+		log.Printf("[ERROR] [UpdateChecklistItem] Failed to update checklist item ID %d: %v", itemID, err)
+		writeTaskError(w, err, "Failed to update the checklist item")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(item)
+}
+
+func (s *taskServiceImpl) DeleteChecklistItem(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, taskID, ok := taskURLParams(w, r)
+	if !ok {
+		return
+	}
+	itemID, err := strconv.Atoi(chi.URLParam(r, "itemId"))
+	if err != nil {
+		http.Error(w, "Invalid checklist item ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.DeleteChecklistItem(r.Context(), currentUser.ID, projectID, taskID, itemID)
+	if err != nil {
+		log.Printf("[ERROR] [DeleteChecklistItem] Failed to delete checklist item ID %d: %v", itemID, err)
+		writeTaskError(w, err, "Failed to delete the checklist item")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Checklist item deleted successfully"}`))
+}
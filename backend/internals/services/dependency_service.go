@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AddTaskBlocker makes another task of the project block the task
+func (s *taskServiceImpl) AddTaskBlocker(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, taskID, ok := taskURLParams(w, r)
+	if !ok {
+		return
+	}
+
+	var payload models.TaskDependencyPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if payload.BlockerTaskID == 0 {
+		http.Error(w, "blocker_task_id is required", http.StatusBadRequest)
+		return
+	}
+
+	err := s.repo.AddTaskDependency(r.Context(), currentUser.ID, projectID, taskID, payload.BlockerTaskID)
+	if err != nil {
+		log.Printf("[ERROR] [AddTaskBlocker] Failed to block task ID %d by task ID %d: %v", taskID, payload.BlockerTaskID, err)
+		writeTaskError(w, err, "Failed to add the dependency")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.DependencyEdge{From: payload.BlockerTaskID, To: taskID})
+}
+
+func (s *taskServiceImpl) RemoveTaskBlocker(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, taskID, ok := taskURLParams(w, r)
+	if !ok {
+		return
+	}
+	blockerID, err := strconv.Atoi(chi.URLParam(r, "blockerId"))
+	if err != nil {
+		http.Error(w, "Invalid blocker task ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.RemoveTaskDependency(r.Context(), currentUser.ID, projectID, taskID, blockerID)
+	if err != nil {
+		log.Printf("[ERROR] [RemoveTaskBlocker] Failed to unblock task ID %d from task ID %d: %v", taskID, blockerID, err)
+		writeTaskError(w, err, "Failed to remove the dependency")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Dependency removed successfully"}`))
+}
+
+// GetDependencyGraph answers with the dependencies between the tasks of a
+// project as nodes and edges, or as a Graphviz DOT digraph with format=dot
+func (s *taskServiceImpl) GetDependencyGraph(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "dot" {
+		http.Error(w, "format must be json or dot", http.StatusBadRequest)
+		return
+	}
+
+	graph, err := s.repo.GetDependencyGraph(r.Context(), currentUser.ID, projectID)
+	if err != nil {
+		log.Printf("[ERROR] [GetDependencyGraph] Failed to build the dependency graph of project ID %d: %v", projectID, err)
+		writeProjectError(w, err, "Failed to query the dependency graph")
+		return
+	}
+
+	if format == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		writeDependencyDOT(w, graph)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(graph)
+}
+
+// writeDependencyDOT writes a dependency graph in the Graphviz DOT language,
+// with edges from each task to the tasks it blocks. Blocked tasks are red and
+// completed ones greyed out.
+func writeDependencyDOT(w io.Writer, graph models.DependencyGraph) {
+	fmt.Fprintf(w, "digraph %s {\n", dotQuote(graph.ProjectName))
+	fmt.Fprintln(w, "\trankdir=LR;")
+	fmt.Fprintln(w, "\tnode [shape=box];")
+	for _, n := range graph.Nodes {
+		attrs := "label=" + dotQuote(fmt.Sprintf("#%d %s\n%s", n.ID, n.Title, n.Status.Name))
+		switch {
+		case n.Completed:
+			attrs += ", style=filled, fillcolor=lightgrey"
+		case n.Blocked:
+			attrs += ", color=red"
+		}
+		fmt.Fprintf(w, "\tt%d [%s];\n", n.ID, attrs)
+	}
+	for _, e := range graph.Edges {
+		fmt.Fprintf(w, "\tt%d -> t%d;\n", e.From, e.To)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// dotQuote makes a DOT quoted string
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r", "", "\n", `\n`).Replace(s) + `"`
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/mailer"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (s projectServiceImpl) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.InvitationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var email *string
+	if payload.Email = strings.TrimSpace(payload.Email); payload.Email != "" {
+		if addr, err := mail.ParseAddress(payload.Email); err != nil || addr.Address != payload.Email {
+			http.Error(w, "A valid email address is required", http.StatusBadRequest)
+			return
+		}
+		email = &payload.Email
+	}
+
+	// An empty role stands for the default role of the organization
+	var role authz.Role
+	if payload.Role != "" {
+		role, err = authz.ParseRole(payload.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if role == authz.RoleOwner {
+		http.Error(w, "The owner role changes only with the ownership of the project", http.StatusBadRequest)
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(s.cfg.INVITATION_TTL)
+	if payload.ExpiresAt != nil {
+		if !payload.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		expiresAt = payload.ExpiresAt.UTC()
+	}
+
+	token, err := utils.RandomToken()
+	if err != nil {
+		log.Printf("[ERROR] [CreateInvitation] Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	invitation, err := s.repo.CreateInvitation(r.Context(), currentUser.ID, id, email, role, utils.HashToken(token), expiresAt)
+	switch {
+	case errors.Is(err, repo.ErrAlreadyMember), errors.Is(err, repo.ErrAlreadyInvited):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("[ERROR] [CreateInvitation] Failed to invite to project ID %d: %v", id, err)
+		writeProjectError(w, err, "Failed to create the invitation")
+		return
+	}
+
+	link := s.invitationLink(token)
+	log.Printf("[INFO] [CreateInvitation] User ID %d created invitation ID %d to project ID %d as %s", currentUser.ID, invitation.ID, id, invitation.Role)
+
+	if email != nil {
+		s.mailInvitation(currentUser, invitation, link)
+
+		// The emailed token proves who received it, so it is never shown here
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"invitation": invitation})
+		return
+	}
+
+	// Like API keys, the token of a link is only ever shown in this response
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"invitation": invitation,
+		"token":      token,
+		"link":       link,
+	})
+}
+
+// InviteMember invites an existing user by username. The invitation goes to
+// the email address of their account and they join once they accept it.
+func (s projectServiceImpl) InviteMember(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+	if username == "" {
+		http.Error(w, "member's username not provided", http.StatusBadRequest)
+		return
+	}
+
+	// The role is optional, members get the default role of the organization
+	var payload models.MemberRolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	var role authz.Role
+	if payload.Role != "" {
+		role, err = authz.ParseRole(payload.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if role == authz.RoleOwner {
+		http.Error(w, "The owner role changes only with the ownership of the project", http.StatusBadRequest)
+		return
+	}
+
+	token, err := utils.RandomToken()
+	if err != nil {
+		log.Printf("[ERROR] [InviteMember] Failed to generate token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	invitation, err := s.repo.InviteUserToProject(r.Context(), currentUser.ID, id, username, role,
+		utils.HashToken(token), time.Now().UTC().Add(s.cfg.INVITATION_TTL))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrAlreadyMember), errors.Is(err, repo.ErrAlreadyInvited):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("[ERROR] [InviteMember] Failed to invite %s to project ID %d: %v", username, id, err)
+		writeProjectError(w, err, "Failed to invite the member")
+		return
+	}
+
+	log.Printf("[INFO] [InviteMember] User ID %d invited %s to project ID %d as %s", currentUser.ID, username, id, invitation.Role)
+	s.mailInvitation(currentUser, invitation, s.invitationLink(token))
+	hideInviteeEmail(&invitation)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"invitation": invitation})
+}
+
+// hideInviteeEmail keeps the address of a user invited by username from the
+// project, which only learns it once they join
+func hideInviteeEmail(invitation *models.ProjectInvitation) {
+	if invitation.Username != nil {
+		invitation.Email = nil
+	}
+}
+
+// invitationLink is the frontend page answering the invitation of token
+func (s projectServiceImpl) invitationLink(token string) string {
+	return s.cfg.APP_BASE_URL + "/invitations?token=" + url.QueryEscape(token)
+}
+
+// mailInvitation sends an email invitation with its link to the invitee
+func (s projectServiceImpl) mailInvitation(inviter models.User, invitation models.ProjectInvitation, link string) {
+	sendInBackground(s.mailer, "invitee "+*invitation.Email, mailer.Message{
+		To:      *invitation.Email,
+		Subject: fmt.Sprintf("%s invited you to %s", inviter.Name, invitation.ProjectName),
+		Body: fmt.Sprintf("Hi,\n\n%s invited you to join the project %s as %s. Open the link below to accept or decline:\n\n%s\n\nThe invitation expires on %s.\n",
+			inviter.Name, invitation.ProjectName, invitation.Role, link, invitation.ExpiresAt.Format(time.RFC1123)),
+	})
+}
+
+func (s projectServiceImpl) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := s.repo.ListInvitations(r.Context(), currentUser.ID, id)
+	if err != nil {
+		writeProjectError(w, err, "Failed to query the invitations")
+		return
+	}
+	for i := range invitations {
+		hideInviteeEmail(&invitations[i])
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (s projectServiceImpl) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "invitationID"))
+	if err != nil {
+		http.Error(w, "unable to parse invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.RevokeInvitation(r.Context(), currentUser.ID, id, invitationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No pending invitation with this ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [RevokeInvitation] Failed to revoke invitation ID %d of project ID %d: %v", invitationID, id, err)
+		writeProjectError(w, err, "Failed to revoke the invitation")
+		return
+	}
+
+	log.Printf("[INFO] [RevokeInvitation] User ID %d revoked invitation ID %d of project ID %d", currentUser.ID, invitationID, id)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Invitation revoked successfully"}`))
+}
+
+func (s projectServiceImpl) ListMyInvitations(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	invitations, err := s.repo.ListInvitationsForUser(r.Context(), currentUser.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ListMyInvitations] Failed to list invitations of user ID %d: %v", currentUser.ID, err)
+		http.Error(w, "Failed to query the invitations", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (s projectServiceImpl) AcceptMyInvitation(w http.ResponseWriter, r *http.Request) {
+	s.respondToInvitation(w, r, true, false)
+}
+
+func (s projectServiceImpl) DeclineMyInvitation(w http.ResponseWriter, r *http.Request) {
+	s.respondToInvitation(w, r, false, false)
+}
+
+func (s projectServiceImpl) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	s.respondToInvitation(w, r, true, true)
+}
+
+func (s projectServiceImpl) DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	s.respondToInvitation(w, r, false, true)
+}
+
+// respondToInvitation accepts or declines an invitation named by the id in
+// the path, or by the token of its link when byToken is set
+func (s projectServiceImpl) respondToInvitation(w http.ResponseWriter, r *http.Request, accept, byToken bool) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var invitationID int
+	var err error
+	if byToken {
+		var payload models.InvitationTokenPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Token == "" {
+			http.Error(w, "Token is required", http.StatusBadRequest)
+			return
+		}
+		invitationID, err = s.repo.GetInvitationIDByToken(r.Context(), utils.HashToken(payload.Token))
+	} else {
+		invitationID, err = strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, "unable to parse invitation ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err == nil {
+		if accept {
+			var invitation models.ProjectInvitation
+			invitation, err = s.repo.AcceptInvitation(r.Context(), currentUser.ID, invitationID, byToken)
+			if err == nil {
+				log.Printf("[INFO] [AcceptInvitation] User ID %d joined project ID %d through invitation ID %d", currentUser.ID, invitation.ProjectID, invitationID)
+				project, err := s.repo.GetProjectByID(r.Context(), currentUser.ID, invitation.ProjectID)
+				if err != nil {
+					writeProjectError(w, err, "Failed to query the project")
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+				json.NewEncoder(w).Encode(project)
+				return
+			}
+		} else {
+			err = s.repo.DeclineInvitation(r.Context(), currentUser.ID, invitationID, byToken)
+			if err == nil {
+				log.Printf("[INFO] [DeclineInvitation] User ID %d declined invitation ID %d", currentUser.ID, invitationID)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"message":"Invitation declined"}`))
+				return
+			}
+		}
+	}
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Invitation not found or expired", http.StatusNotFound)
+	case errors.Is(err, repo.ErrInvitationNotForUser):
+		http.Error(w, "This invitation was not sent to your email address", http.StatusForbidden)
+	case errors.Is(err, repo.ErrLinkNotDeclinable):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repo.ErrEmailNotVerified):
+		http.Error(w, "Verify your email address to answer this invitation", http.StatusForbidden)
+	default:
+		log.Printf("[ERROR] [RespondToInvitation] Failed to answer invitation ID %d for user ID %d: %v", invitationID, currentUser.ID, err)
+		http.Error(w, "Failed to answer the invitation", http.StatusInternalServerError)
+	}
+}
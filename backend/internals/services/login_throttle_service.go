@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// failedLoginWindow is how long a failed login counts towards backoff and
+// lockout when no further failures follow
+const failedLoginWindow = 24 * time.Hour
+
+// Reasons recorded in the login audit trail
+const (
+	loginReasonPassword           = "password"
+	loginReasonMFA                = "mfa"
+	loginReasonOIDC               = "oidc"
+	loginReasonMFARequired        = "mfa_required"
+	loginReasonInvalidCredentials = "invalid_credentials"
+	loginReasonInvalidMFACode     = "invalid_mfa_code"
+	loginReasonLocked             = "locked"
+)
+
+// dummyPasswordHash is verified against when the username is unknown, so
+// that unknown usernames take as long to reject as wrong passwords
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hashed, err := utils.HashPassword("task-matrix-dummy-password")
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to compute dummy password hash: %v", err)
+	}
+	return hashed
+})
+
+// loginBlockedFor returns how long logins for username are still blocked
+func (s *userServiceImpl) loginBlockedFor(ctx context.Context, username string) (time.Duration, error) {
+	lockedUntil, err := s.repo.GetLoginLock(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	return time.Until(lockedUntil), nil
+}
+
+// loginBackoff returns how long logins are blocked after failures
+// consecutive failed attempts: nothing for the first LOGIN_BACKOFF_AFTER,
+// then one second doubling with every failure, and LOGIN_LOCKOUT_DURATION
+// from LOGIN_LOCKOUT_THRESHOLD on
+func (s *userServiceImpl) loginBackoff(failures int) time.Duration {
+	if s.cfg.LOGIN_LOCKOUT_THRESHOLD > 0 && failures >= s.cfg.LOGIN_LOCKOUT_THRESHOLD {
+		return s.cfg.LOGIN_LOCKOUT_DURATION
+	}
+	if failures <= s.cfg.LOGIN_BACKOFF_AFTER {
+		return 0
+	}
+
+	exp := float64(failures - s.cfg.LOGIN_BACKOFF_AFTER - 1)
+	backoff := time.Duration(math.Min(math.Pow(2, exp), math.MaxInt32)) * time.Second
+	return min(backoff, s.cfg.LOGIN_LOCKOUT_DURATION)
+}
+
+// registerLoginFailure counts a failed login against username, blocks it
+// for the resulting backoff and records the attempt. Unknown usernames are
+// counted the same way, so that lockouts do not reveal which ones exist.
+func (s *userServiceImpl) registerLoginFailure(ctx context.Context, r *http.Request, username string, userID *int, reason string) {
+	failures, err := s.repo.RegisterFailedLogin(ctx, username, failedLoginWindow)
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to register failed login for %s: %v", username, err)
+	} else if backoff := s.loginBackoff(failures); backoff > 0 {
+		if err := s.repo.SetLoginLock(ctx, username, time.Now().UTC().Add(backoff)); err != nil {
+			log.Printf("[ERROR] [Login] Failed to lock logins for %s: %v", username, err)
+		}
+		log.Printf("[WARN] [Login] %d failed logins for %s, blocked for %s", failures, username, backoff)
+	}
+
+	s.recordLoginAttempt(ctx, r, username, userID, false, reason)
+}
+
+// registerLoginSuccess clears the failed logins of user and records the attempt
+func (s *userServiceImpl) registerLoginSuccess(ctx context.Context, r *http.Request, user models.User, reason string) {
+	if _, err := s.repo.ResetLoginThrottle(ctx, user.Username); err != nil {
+		log.Printf("[ERROR] [Login] Failed to reset failed logins of user ID %d: %v", user.ID, err)
+	}
+	s.recordLoginAttempt(ctx, r, user.Username, &user.ID, true, reason)
+}
+
+func (s *userServiceImpl) recordLoginAttempt(ctx context.Context, r *http.Request, username string, userID *int, success bool, reason string) {
+	meta := requestMeta(r)
+	err := s.repo.RecordLoginAttempt(ctx, models.LoginAttempt{
+		Username: username, UserID: userID, IP: meta.IP, UserAgent: meta.UserAgent,
+		Success: success, Reason: reason,
+	})
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to record login attempt for %s: %v", username, err)
+	}
+}
+
+// writeLoginBlocked answers a login attempt for a blocked username
+func writeLoginBlocked(w http.ResponseWriter, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
+
+func (s *userServiceImpl) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	username := chi.URLParam(r, "username")
+	if username == "" {
+		http.Error(w, "username not provided", http.StatusBadRequest)
+		return
+	}
+
+	reset, err := s.repo.ResetLoginThrottle(r.Context(), username)
+	if err != nil {
+		log.Printf("[ERROR] [UnlockAccount] Failed to unlock %s: %v", username, err)
+		http.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+	if !reset {
+		http.Error(w, "No failed logins recorded for this username", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[INFO] [UnlockAccount] User ID %d unlocked logins for %s", admin.ID, username)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Account unlocked successfully"}`))
+}
+
+func (s *userServiceImpl) ListLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if val := r.URL.Query().Get("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	attempts, err := s.repo.ListLoginAttempts(r.Context(), r.URL.Query().Get("username"), limit)
+	if err != nil {
+		log.Printf("[ERROR] [ListLoginAttempts] Failed to list login attempts: %v", err)
+		http.Error(w, "Failed to list login attempts", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(attempts)
+}
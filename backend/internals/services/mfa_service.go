@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"task-matrix-be/internals/utils"
+	"time"
+)
+
+// recoveryCodeCount is how many recovery codes are issued at once
+const recoveryCodeCount = 10
+
+// sendMFAChallenge answers a password login of a TOTP user with a
+// short-lived challenge token instead of a session
+func (s *userServiceImpl) sendMFAChallenge(w http.ResponseWriter, r *http.Request, user models.User) {
+	token, err := utils.RandomToken()
+	if err == nil {
+		err = s.repo.CreateUserToken(r.Context(), user.ID, repo.TokenPurposeMFAChallenge,
+			utils.HashToken(token), time.Now().UTC().Add(s.cfg.MFA_CHALLENGE_TTL))
+	}
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to create MFA challenge for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [Login] User %s (ID %d) passed password check, MFA required", user.Username, user.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"expires_in":   int64(s.cfg.MFA_CHALLENGE_TTL.Seconds()),
+	})
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code,
+// for the user. Each TOTP code and recovery code is accepted only once.
+func (s *userServiceImpl) verifySecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	secret, enabled, err := s.repo.GetTOTP(ctx, userID)
+	if err != nil || !enabled {
+		return false, err
+	}
+
+	if step, ok := utils.ValidateTOTP(secret, code, time.Now()); ok {
+		return s.repo.AdvanceTOTPStep(ctx, userID, step)
+	}
+
+	err = s.repo.ConsumeRecoveryCode(ctx, userID, utils.HashToken(utils.NormalizeRecoveryCode(code)))
+	return err == nil, nil
+}
+
+// newRecoveryCodes generates recovery codes and the hashes to store for them
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	codes, err = utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes = make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(utils.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func (s *userServiceImpl) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var payload models.MFALoginPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [LoginMFA] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.MFAToken == "" || payload.Code == "" {
+		http.Error(w, "MFA token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := utils.HashToken(payload.MFAToken)
+	userID, err := s.repo.LookupUserToken(r.Context(), repo.TokenPurposeMFAChallenge, tokenHash)
+	if err != nil {
+		log.Printf("[WARN] [LoginMFA] Invalid or expired MFA token")
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] [LoginMFA] Failed to load user ID %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords, which
+	// keeps the code space from being brute forced through one challenge
+	blockedFor, err := s.loginBlockedFor(r.Context(), user.Username)
+	if err != nil {
+		log.Printf("[ERROR] [LoginMFA] Failed to check lockout for user ID %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if blockedFor > 0 {
+		s.recordLoginAttempt(r.Context(), r, user.Username, &user.ID, false, loginReasonLocked)
+		writeLoginBlocked(w, blockedFor)
+		return
+	}
+
+	ok, err := s.verifySecondFactor(r.Context(), userID, payload.Code)
+	if err != nil {
+		log.Printf("[ERROR] [LoginMFA] Failed to verify code for user ID %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		log.Printf("[WARN] [LoginMFA] Invalid code for user ID %d", userID)
+		s.registerLoginFailure(r.Context(), r, user.Username, &user.ID, loginReasonInvalidMFACode)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	// Consuming the challenge only after a valid code lets users retry typos,
+	// but still makes each challenge complete at most one login
+	if _, err := s.repo.ConsumeUserToken(r.Context(), repo.TokenPurposeMFAChallenge, tokenHash); err != nil {
+		http.Error(w, "Invalid or expired MFA token", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.checkAccountStatus(w, r, *user, true) {
+		return
+	}
+
+	resp, err := s.issueTokens(*user, requestMeta(r))
+	if err != nil {
+		log.Printf("[ERROR] [LoginMFA] Token generation failed for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.registerLoginSuccess(r.Context(), r, *user, loginReasonMFA)
+
+	log.Printf("[INFO] [LoginMFA] User %s (ID %d) logged in successfully", user.Username, user.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *userServiceImpl) SetupTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	_, enabled, err := s.repo.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [SetupTOTP] Failed to load MFA settings for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "TOTP is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err == nil {
+		err = s.repo.SetPendingTOTPSecret(r.Context(), user.ID, secret)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [SetupTOTP] Failed to store TOTP secret for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(s.cfg.TOTP_ISSUER, user.Username, secret),
+	})
+}
+
+func (s *userServiceImpl) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.TOTPCodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	secret, enabled, err := s.repo.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ConfirmTOTP] Failed to load MFA settings for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if enabled {
+		http.Error(w, "TOTP is already enabled", http.StatusConflict)
+		return
+	}
+	if secret == "" {
+		http.Error(w, "TOTP setup has not been started", http.StatusBadRequest)
+		return
+	}
+
+	step, valid := utils.ValidateTOTP(secret, payload.Code, time.Now())
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		err = s.repo.EnableTOTP(r.Context(), user.ID, hashes)
+	}
+	if err == nil {
+		_, err = s.repo.AdvanceTOTPStep(r.Context(), user.ID, step)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ConfirmTOTP] Failed to enable TOTP for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [ConfirmTOTP] TOTP enabled for user ID %d", user.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"recovery_codes": codes,
+	})
+}
+
+func (s *userServiceImpl) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.DisableTOTPPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if !s.reauthenticate(w, r, "DisableTOTP", user.ID, payload.Password, payload.ReauthToken) {
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r.Context(), user.ID, payload.Code)
+	if err != nil {
+		log.Printf("[ERROR] [DisableTOTP] Failed to verify code for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.repo.DisableTOTP(r.Context(), user.ID); err != nil {
+		log.Printf("[ERROR] [DisableTOTP] Failed to disable TOTP for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [DisableTOTP] TOTP disabled for user ID %d", user.ID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Two-factor authentication disabled"}`))
+}
+
+func (s *userServiceImpl) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.TOTPCodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := s.verifySecondFactor(r.Context(), user.ID, payload.Code)
+	if err != nil {
+		log.Printf("[ERROR] [RegenerateRecoveryCodes] Failed to verify code for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err == nil {
+		err = s.repo.ReplaceRecoveryCodes(r.Context(), user.ID, hashes)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [RegenerateRecoveryCodes] Failed to replace recovery codes for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"recovery_codes": codes,
+	})
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/oidc"
+	"task-matrix-be/internals/utils"
+	"time"
+)
+
+// oidcLoginTTL is how long a user has to complete a login at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcStateCookie binds a login to the browser that started it, so that a
+// callback URL carrying someone else's code and state is refused
+const oidcStateCookie = "oidc_state"
+
+// maxUsernameLength bounds usernames derived from OIDC claims
+const maxUsernameLength = 30
+
+var (
+	errOIDCNoEmail            = errors.New("the identity provider did not return an email address")
+	errOIDCEmailTaken         = errors.New("an account with this email address already exists, log in with your password")
+	errOIDCAccountUnverified  = errors.New("an account with this email address exists but its email is not verified, log in with your password and verify it first")
+	errOIDCUsernameUnassigned = errors.New("could not derive a free username")
+)
+
+func (s *userServiceImpl) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	state, err := utils.RandomToken()
+	var nonce, verifier string
+	if err == nil {
+		nonce, err = utils.RandomToken()
+	}
+	if err == nil {
+		verifier, err = utils.RandomToken()
+	}
+	if err == nil {
+		err = s.repo.CreateOIDCState(r.Context(), utils.HashToken(state), nonce, verifier, time.Now().UTC().Add(oidcLoginTTL))
+	}
+	if err != nil {
+		log.Printf("[ERROR] [OIDCLogin] Failed to start login: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := s.oidc.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("[ERROR] [OIDCLogin] Identity provider unavailable: %v", err)
+		http.Error(w, "Identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+	s.setOIDCStateCookie(w, utils.HashToken(state))
+
+	// Single page apps that start the login with fetch ask for the URL instead
+	if r.URL.Query().Get("redirect") == "false" {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{"authorization_url": authURL})
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (s *userServiceImpl) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "Single sign-on is not configured", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		log.Printf("[WARN] [OIDCCallback] Provider returned %s: %s", providerErr, query.Get("error_description"))
+		http.Error(w, "Single sign-on was cancelled or denied", http.StatusUnauthorized)
+		return
+	}
+
+	code, state := query.Get("code"), query.Get("state")
+	if code == "" || state == "" {
+		http.Error(w, "code and state are required", http.StatusBadRequest)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	s.setOIDCStateCookie(w, "")
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(utils.HashToken(state))) != 1 {
+		log.Printf("[WARN] [OIDCCallback] Login state does not belong to this browser")
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	nonce, verifier, err := s.repo.ConsumeOIDCState(r.Context(), utils.HashToken(state))
+	if err != nil {
+		log.Printf("[WARN] [OIDCCallback] Unknown or expired state: %v", err)
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := s.oidc.Exchange(r.Context(), code, verifier, nonce)
+	if err != nil {
+		log.Printf("[WARN] [OIDCCallback] Code exchange failed: %v", err)
+		http.Error(w, "Single sign-on failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.resolveOIDCUser(r.Context(), claims)
+	switch {
+	case errors.Is(err, errOIDCNoEmail):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, errOIDCEmailTaken), errors.Is(err, errOIDCAccountUnverified):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("[ERROR] [OIDCCallback] Failed to resolve user for %s/%s: %v", claims.Issuer, claims.Subject, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !s.checkAccountStatus(w, r, *user, false) {
+		return
+	}
+
+	_, totpEnabled, err := s.repo.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [OIDCCallback] Failed to load MFA settings for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if totpEnabled {
+		s.recordLoginAttempt(r.Context(), r, user.Username, &user.ID, false, loginReasonMFARequired)
+		s.sendMFAChallenge(w, r, *user)
+		return
+	}
+
+	resp, err := s.issueTokens(*user, requestMeta(r))
+	if err != nil {
+		log.Printf("[ERROR] [OIDCCallback] Token generation failed for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.registerLoginSuccess(r.Context(), r, *user, loginReasonOIDC)
+
+	log.Printf("[INFO] [OIDCCallback] User %s (ID %d) logged in through %s", user.Username, user.ID, claims.Issuer)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// setOIDCStateCookie stores the hash of a login state in the browser, or
+// removes it when value is empty
+func (s *userServiceImpl) setOIDCStateCookie(w http.ResponseWriter, value string) {
+	cookie := &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(s.cfg.OIDC_REDIRECT_URL, "https://"),
+		// Lax still sends the cookie on the top-level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	http.SetCookie(w, cookie)
+}
+
+// resolveOIDCUser returns the user of an OIDC identity. Unknown identities
+// are linked to the account with the same email when both the provider and
+// the account have verified it, and get a new account otherwise.
+func (s *userServiceImpl) resolveOIDCUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	user, err := s.repo.GetUserByIdentity(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errOIDCNoEmail
+	}
+
+	existing, err := s.repo.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !claims.EmailVerified {
+			return nil, errOIDCEmailTaken
+		}
+		// Linking into an unverified account would hand it to whoever
+		// registered the address first, possibly knowing its password
+		verified, err := s.repo.IsEmailVerified(ctx, existing.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !verified {
+			return nil, errOIDCAccountUnverified
+		}
+		if err := s.repo.LinkIdentity(ctx, existing.ID, claims.Issuer, claims.Subject, claims.Email); err != nil {
+			return nil, err
+		}
+		log.Printf("[INFO] [OIDCCallback] Linked %s/%s to user ID %d", claims.Issuer, claims.Subject, existing.ID)
+		return existing, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return nil, err
+	}
+
+	return s.provisionOIDCUser(ctx, claims)
+}
+
+// provisionOIDCUser creates an account for a first-time OIDC login. The
+// account gets a random password, so it can only log in through the
+// provider until the user resets it.
+func (s *userServiceImpl) provisionOIDCUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	username, err := s.freeUsername(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+
+	password, err := utils.RandomToken()
+	if err != nil {
+		return nil, err
+	}
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.repo.CreateUser(ctx, name, username, claims.Email, claims.Picture, hashed)
+	if err != nil {
+		return nil, err
+	}
+	if claims.EmailVerified {
+		if err := s.repo.MarkEmailVerified(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.repo.LinkIdentity(ctx, id, claims.Issuer, claims.Subject, claims.Email); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] [OIDCCallback] Provisioned user %s (ID %d) for %s/%s", username, id, claims.Issuer, claims.Subject)
+
+	user := models.User{ID: id, Name: name, Username: username, Email: claims.Email, AvatarUrl: claims.Picture}
+	if !claims.EmailVerified {
+		if err := s.sendVerificationEmail(ctx, user); err != nil {
+			log.Printf("[ERROR] [OIDCCallback] Failed to send verification email to user ID %d: %v", id, err)
+		}
+	}
+	return &user, nil
+}
+
+// freeUsername turns base into a valid username that is not taken yet,
+// appending a number when needed
+func (s *userServiceImpl) freeUsername(ctx context.Context, base string) (string, error) {
+	var b strings.Builder
+	for _, c := range strings.ToLower(base) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '.' || c == '_' || c == '-' {
+			b.WriteRune(c)
+		}
+	}
+	base = b.String()
+	if base == "" {
+		base = "user"
+	}
+	if len(base) > maxUsernameLength-3 {
+		base = base[:maxUsernameLength-3]
+	}
+
+	for i := 1; i < 1000; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+		_, _, err := s.repo.GetUserByUsername(ctx, candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errOIDCUsernameUnassigned
+}
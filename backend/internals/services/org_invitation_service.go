@@ -0,0 +1,218 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/mailer"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// InviteOrgMember invites an existing user by username. They join the
+// organization once they accept the invitation, until then the other
+// members do not see them.
+func (s orgServiceImpl) InviteOrgMember(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+	username := chi.URLParam(r, "username")
+
+	// The role is optional, people join as members by default
+	payload := models.MemberRolePayload{Role: string(authz.OrgMember)}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	role, err := authz.ParseOrgRole(payload.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := s.repo.InviteOrgMember(r.Context(), currentUser.ID, orgID, username, role,
+		time.Now().UTC().Add(s.cfg.INVITATION_TTL))
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrAlreadyOrgMember), errors.Is(err, repo.ErrAlreadyInvitedToOrg):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		writeOrgError(w, err, "Failed to invite the member")
+		return
+	}
+
+	log.Printf("[INFO] [InviteOrgMember] User ID %d invited user ID %d to organization ID %d as %s", currentUser.ID, invitation.UserID, orgID, role)
+
+	sendInBackground(s.mailer, "invitee "+invitation.Email, mailer.Message{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("%s invited you to %s", currentUser.Name, invitation.OrgName),
+		Body: fmt.Sprintf("Hi %s,\n\n%s invited you to join the organization %s as %s. Open the link below to accept or decline:\n\n%s\n\nThe invitation expires on %s.\n",
+			invitation.Name, currentUser.Name, invitation.OrgName, invitation.Role,
+			s.cfg.APP_BASE_URL+"/invitations", invitation.ExpiresAt.Format(time.RFC1123)),
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"invitation": invitation})
+}
+
+func (s orgServiceImpl) ListOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+
+	invitations, err := s.repo.ListOrgInvitations(r.Context(), currentUser.ID, orgID)
+	if err != nil {
+		writeOrgError(w, err, "Failed to query the invitations")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (s orgServiceImpl) RevokeOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "invitationID"))
+	if err != nil {
+		http.Error(w, "unable to parse invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.RevokeOrgInvitation(r.Context(), currentUser.ID, orgID, invitationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "No pending invitation with this ID", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeOrgError(w, err, "Failed to revoke the invitation")
+		return
+	}
+
+	log.Printf("[INFO] [RevokeOrgInvitation] User ID %d revoked invitation ID %d of organization ID %d", currentUser.ID, invitationID, orgID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Invitation revoked successfully"}`))
+}
+
+func (s orgServiceImpl) ListMyOrgInvitations(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	invitations, err := s.repo.ListOrgInvitationsForUser(r.Context(), currentUser.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ListMyOrgInvitations] Failed to list organization invitations of user ID %d: %v", currentUser.ID, err)
+		http.Error(w, "Failed to query the invitations", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(invitations)
+}
+
+func (s orgServiceImpl) AcceptMyOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := s.repo.AcceptOrgInvitation(r.Context(), currentUser.ID, invitationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Invitation not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [AcceptMyOrgInvitation] Failed to accept invitation ID %d for user ID %d: %v", invitationID, currentUser.ID, err)
+		http.Error(w, "Failed to answer the invitation", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [AcceptMyOrgInvitation] User ID %d joined organization ID %d through invitation ID %d", currentUser.ID, invitation.OrgID, invitationID)
+
+	org, err := s.repo.GetOrganization(r.Context(), currentUser.ID, invitation.OrgID)
+	if err != nil {
+		writeOrgError(w, err, "Failed to query the organization")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s orgServiceImpl) DeclineMyOrgInvitation(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	invitationID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse invitation ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.DeclineOrgInvitation(r.Context(), currentUser.ID, invitationID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Invitation not found or expired", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [DeclineMyOrgInvitation] Failed to decline invitation ID %d for user ID %d: %v", invitationID, currentUser.ID, err)
+		http.Error(w, "Failed to answer the invitation", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [DeclineMyOrgInvitation] User ID %d declined organization invitation ID %d", currentUser.ID, invitationID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Invitation declined"}`))
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/config"
+	"task-matrix-be/internals/mailer"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type orgServiceImpl struct {
+	repo   repo.OrgRepo
+	mailer mailer.Mailer
+	cfg    *config.Config
+}
+
+func (s orgServiceImpl) ListOrganizations(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgs, err := s.repo.ListOrganizations(r.Context(), currentUser.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ListOrganizations] Failed to list organizations of user ID %d: %v", currentUser.ID, err)
+		http.Error(w, "Failed to query organizations", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(orgs)
+}
+
+func (s orgServiceImpl) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.OrganizationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Organization name is required", http.StatusBadRequest)
+		return
+	}
+	defaultRole := authz.DefaultRole
+	if payload.DefaultRole != "" {
+		var err error
+		if defaultRole, err = parseDefaultRole(payload.DefaultRole); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	org, err := s.repo.CreateOrganization(r.Context(), currentUser.ID, payload.Name, defaultRole)
+	if err != nil {
+		log.Printf("[ERROR] [CreateOrganization] Failed to create organization for user ID %d: %v", currentUser.ID, err)
+		http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [CreateOrganization] User ID %d created organization ID %d", currentUser.ID, org.ID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s orgServiceImpl) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+
+	org, err := s.repo.GetOrganization(r.Context(), currentUser.ID, orgID)
+	if err != nil {
+		writeOrgError(w, err, "Failed to query the organization")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s orgServiceImpl) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.UpdateOrganizationPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Name != nil {
+		*payload.Name = strings.TrimSpace(*payload.Name)
+		if *payload.Name == "" {
+			http.Error(w, "Organization name cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	var defaultRole *authz.Role
+	if payload.DefaultRole != nil {
+		role, err := parseDefaultRole(*payload.DefaultRole)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defaultRole = &role
+	}
+
+	org, err := s.repo.UpdateOrganization(r.Context(), currentUser.ID, orgID, payload.Name, defaultRole)
+	if err != nil {
+		writeOrgError(w, err, "Failed to update the organization")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(org)
+}
+
+func (s orgServiceImpl) ChangeOrgMemberRole(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "unable to parse member user ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.MemberRolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	role, err := authz.ParseOrgRole(payload.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	member, err := s.repo.ChangeOrgMemberRole(r.Context(), currentUser.ID, orgID, memberID, role)
+	if err != nil {
+		writeOrgError(w, err, "Failed to change the member's role")
+		return
+	}
+
+	log.Printf("[INFO] [ChangeOrgMemberRole] User ID %d made user ID %d %s of organization ID %d", currentUser.ID, memberID, role, orgID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(member)
+}
+
+func (s orgServiceImpl) RemoveOrgMember(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "unable to parse member user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.repo.RemoveOrgMember(r.Context(), currentUser.ID, orgID, memberID); err != nil {
+		writeOrgError(w, err, "Failed to remove the member")
+		return
+	}
+
+	log.Printf("[INFO] [RemoveOrgMember] User ID %d removed user ID %d from organization ID %d", currentUser.ID, memberID, orgID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Member removed successfully"}`))
+}
+
+// parseDefaultRole validates the project role given to new members of the
+// projects of an organization, which cannot be the owner
+func parseDefaultRole(s string) (authz.Role, error) {
+	role, err := authz.ParseRole(s)
+	if err == nil && role == authz.RoleOwner {
+		err = errors.New("the default role cannot be owner")
+	}
+	return role, err
+}
+
+// writeOrgError answers a failed organization operation. Organizations the
+// user is not a member of are reported as not found.
+func writeOrgError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, authz.ErrNotOrgMember):
+		http.Error(w, "Organization not found", http.StatusNotFound)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "User is not a member of the organization", http.StatusNotFound)
+	case errors.Is(err, authz.ErrForbidden):
+		http.Error(w, "Only organization admins can do this", http.StatusForbidden)
+	case errors.Is(err, repo.ErrLastOrgAdmin), errors.Is(err, repo.ErrPersonalOrgOwner),
+		errors.Is(err, repo.ErrOrgProjectOwner):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("[ERROR] [Organizations] %s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
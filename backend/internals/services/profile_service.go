@@ -0,0 +1,281 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"task-matrix-be/internals/mailer"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"task-matrix-be/internals/utils"
+)
+
+func (s *userServiceImpl) GetProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	profile, err := s.repo.GetProfile(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [GetProfile] Failed to load profile of user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to load profile", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(profile)
+}
+
+func (s *userServiceImpl) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.UpdateProfilePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [UpdateProfile] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// The context user may be stale, e.g. with stateless JWT sessions
+	current, err := s.repo.GetUserByID(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [UpdateProfile] Failed to load user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	updated := *current
+
+	if payload.Name != nil {
+		updated.Name = strings.TrimSpace(*payload.Name)
+		if updated.Name == "" {
+			http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if payload.AvatarUrl != nil {
+		updated.AvatarUrl = strings.TrimSpace(*payload.AvatarUrl)
+	}
+	if payload.Username != nil {
+		updated.Username = strings.TrimSpace(*payload.Username)
+		if updated.Username == "" {
+			http.Error(w, "Username cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if updated.Username != current.Username {
+			_, _, err := s.repo.GetUserByUsername(r.Context(), updated.Username)
+			if err == nil {
+				http.Error(w, "Username is already taken", http.StatusConflict)
+				return
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("[ERROR] [UpdateProfile] Failed to check username %s: %v", updated.Username, err)
+				http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	// The check above races with other renames, the unique constraint does not
+	err = s.repo.UpdateProfile(r.Context(), updated)
+	if errors.Is(err, repo.ErrUsernameTaken) {
+		http.Error(w, "Username is already taken", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [UpdateProfile] Failed to update profile of user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [UpdateProfile] User ID %d updated their profile", user.ID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(updated)
+}
+
+func (s *userServiceImpl) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.ChangePasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [ChangePassword] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.CurrentPassword == "" && payload.ReauthToken == "" || payload.NewPassword == "" {
+		http.Error(w, "Current and new password are required", http.StatusBadRequest)
+		return
+	}
+	if payload.NewPassword != payload.ConfirmPassword {
+		http.Error(w, "Passwords do not match", http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.repo.GetUserByID(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ChangePassword] Failed to load user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !s.reauthenticate(w, r, "ChangePassword", user.ID, payload.CurrentPassword, payload.ReauthToken) {
+		return
+	}
+
+	newHash, err := utils.HashPassword(payload.NewPassword)
+	if err == nil {
+		err = s.repo.UpdatePasswordHash(r.Context(), user.ID, newHash)
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ChangePassword] Failed to update password for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Every session is revoked and this client gets a fresh one, so that
+	// sessions opened with the old password end here
+	if err := s.auth.RevokeAllForUser(*current); err != nil {
+		log.Printf("[ERROR] [ChangePassword] Failed to revoke sessions for user ID %d: %v", user.ID, err)
+	}
+	resp, err := s.issueTokens(*current, requestMeta(r))
+	if err != nil {
+		log.Printf("[ERROR] [ChangePassword] Token generation failed for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.deliver(user.ID, mailer.Message{
+		To:      current.Email,
+		Subject: "Your password was changed",
+		Body:    fmt.Sprintf("Hi %s,\n\nThe password of your account was just changed and all other sessions were logged out. If this was not you, reset your password immediately.\n", current.Name),
+	})
+
+	log.Printf("[INFO] [ChangePassword] User ID %d changed their password", user.ID)
+
+	resp["message"] = "Password changed successfully"
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *userServiceImpl) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	var payload models.ChangeEmailPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [ChangeEmail] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	payload.Email = strings.TrimSpace(payload.Email)
+	if addr, err := mail.ParseAddress(payload.Email); err != nil || addr.Address != payload.Email {
+		http.Error(w, "A valid email address is required", http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.repo.GetUserByID(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ChangeEmail] Failed to load user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if payload.Email == current.Email {
+		http.Error(w, "This is already your email address", http.StatusBadRequest)
+		return
+	}
+	_, err = s.repo.GetUserByEmail(r.Context(), payload.Email)
+	if err == nil {
+		http.Error(w, "Email is already in use", http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("[ERROR] [ChangeEmail] Failed to check email of user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Checked last so a one-time reauthentication token is only used up by
+	// a change that goes through
+	if !s.reauthenticate(w, r, "ChangeEmail", user.ID, payload.Password, payload.ReauthToken) {
+		return
+	}
+
+	if err := s.repo.SetPendingEmail(r.Context(), user.ID, payload.Email); err != nil {
+		log.Printf("[ERROR] [ChangeEmail] Failed to store pending email of user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The confirmation goes to the new address, the current one stays in
+	// use until the link is opened
+	pending := *current
+	pending.Email = payload.Email
+	err = s.sendEmailToken(r.Context(), pending, repo.TokenPurposeEmailChange, s.cfg.EMAIL_VERIFICATION_TTL,
+		"/verify-email", "Confirm your new email address",
+		"Hi %s,\n\nPlease confirm that you want to use this email address for your account by opening the link below:\n\n%s\n\nThe link expires in %s.\n")
+	if err != nil {
+		log.Printf("[ERROR] [ChangeEmail] Failed to send confirmation to user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [ChangeEmail] User ID %d requested an email change", user.ID)
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"message":"A confirmation link has been sent to the new email address"}`))
+}
+
+// confirmEmailChange switches a user to their pending email address once
+// the link sent to it was opened, and tells the previous address about it
+func (s *userServiceImpl) confirmEmailChange(w http.ResponseWriter, r *http.Request, userID int) {
+	previous, err := s.repo.GetUserByID(r.Context(), userID)
+	if err != nil {
+		log.Printf("[ERROR] [VerifyEmail] Failed to load user ID %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	email, err := s.repo.ConfirmPendingEmail(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		// Someone else registered the address since the change was requested
+		log.Printf("[WARN] [VerifyEmail] Failed to confirm email change of user ID %d: %v", userID, err)
+		http.Error(w, "Email is already in use", http.StatusConflict)
+		return
+	}
+
+	s.deliver(userID, mailer.Message{
+		To:      previous.Email,
+		Subject: "Your email address was changed",
+		Body:    fmt.Sprintf("Hi %s,\n\nThe email address of your account was changed to %s. If this was not you, contact support immediately.\n", previous.Name, email),
+	})
+
+	log.Printf("[INFO] [VerifyEmail] Email of user ID %d changed", userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Email address changed successfully"}`))
+}
@@ -1,11 +1,16 @@
 package services
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/config"
+	"task-matrix-be/internals/mailer"
 	"task-matrix-be/internals/middlewares"
 	"task-matrix-be/internals/models"
 	"task-matrix-be/internals/repo"
@@ -14,7 +19,9 @@ import (
 )
 
 type projectServiceImpl struct {
-	repo repo.ProjectRepo
+	repo   repo.ProjectRepo
+	mailer mailer.Mailer
+	cfg    *config.Config
 }
 
 func (s *projectServiceImpl) CreateProject(w http.ResponseWriter, r *http.Request) {
@@ -35,7 +42,17 @@ func (s *projectServiceImpl) CreateProject(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	id, err := s.repo.CreateProject(r.Context(), currentUser.ID, payload.Name, payload.Description, payload.DueDate)
+	orgID, err := selectedOrg(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, orgID, err := s.repo.CreateProject(r.Context(), currentUser.ID, orgID, payload.Name, payload.Description, payload.DueDate)
+	if errors.Is(err, authz.ErrNotOrgMember) {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println("Failed to create project:", err)
 		http.Error(w, "Failed to create project", http.StatusInternalServerError)
@@ -44,12 +61,13 @@ func (s *projectServiceImpl) CreateProject(w http.ResponseWriter, r *http.Reques
 
 	project := models.Project{
 		ID:             id,
+		OrgID:          orgID,
 		Name:           payload.Name,
 		Description:    payload.Description,
 		DueDate:        payload.DueDate,
 		Status:         models.Status{ID: 1, Name: "TODO"},
 		Owner:          currentUser,
-		Members:        []models.User{currentUser},
+		Members:        []models.ProjectMember{{User: currentUser, Role: string(authz.RoleOwner)}},
 		TasksCompleted: 0,
 		TotalTasks:     0,
 	}
@@ -65,7 +83,23 @@ func (s projectServiceImpl) GetAllProjects(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	projects, err := s.repo.GetProjects(r.Context(), currentUser.ID)
+	orgID, err := selectedOrg(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// leaf_tasks=true counts the tasks without subtasks only, the work
+	// itself rather than the tasks that group it
+	var leafTasksOnly bool
+	if val := r.URL.Query().Get("leaf_tasks"); val != "" {
+		if leafTasksOnly, err = strconv.ParseBool(val); err != nil {
+			http.Error(w, "leaf_tasks must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	projects, err := s.repo.GetProjects(r.Context(), currentUser.ID, orgID, leafTasksOnly)
 	if err != nil {
 		http.Error(w, "Failed to query projects", http.StatusInternalServerError)
 		return
@@ -97,7 +131,7 @@ func (s projectServiceImpl) ViewProject(w http.ResponseWriter, r *http.Request)
 
 	project, err := s.repo.GetProjectByID(r.Context(), currentUser.ID, id)
 	if err != nil {
-		http.Error(w, "Failed to query the project", http.StatusInternalServerError)
+		writeProjectError(w, err, "Failed to query the project")
 		return
 	}
 
@@ -138,7 +172,7 @@ func (s projectServiceImpl) UpdateProject(w http.ResponseWriter, r *http.Request
 	project, err := s.repo.UpdateProjectByID(r.Context(), currentUser.ID, id, payload.Name, payload.Description, payload.DueDate, payload.StatusID)
 	if err != nil {
 		log.Println("Failed to update the project : ", err)
-		http.Error(w, "Failed to update the project", http.StatusInternalServerError)
+		writeProjectError(w, err, "Failed to update the project")
 		return
 	}
 
@@ -146,7 +180,7 @@ func (s projectServiceImpl) UpdateProject(w http.ResponseWriter, r *http.Request
 	json.NewEncoder(w).Encode(project)
 }
 
-func (s projectServiceImpl) AddMemberToProject(w http.ResponseWriter, r *http.Request) {
+func (s projectServiceImpl) RemoveMemberFromProject(w http.ResponseWriter, r *http.Request) {
 	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
 	if !ok {
 		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
@@ -165,23 +199,33 @@ func (s projectServiceImpl) AddMemberToProject(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	memberUsername := chi.URLParam(r, "username")
-	if memberUsername == "" {
-		http.Error(w, "member's username not provided", http.StatusBadRequest)
+	memberUserIDStr := chi.URLParam(r, "userID")
+	if memberUserIDStr == "" {
+		http.Error(w, "member's userID not provided", http.StatusBadRequest)
+		return
+	}
+
+	memberUserID, err := strconv.Atoi(memberUserIDStr)
+	if err != nil {
+		http.Error(w, "unable to parse member user ID ID", http.StatusBadRequest)
 		return
 	}
 
-	user, err := s.repo.AddMemberToProject(r.Context(), currentUser.ID, id, memberUsername)
+	err = s.repo.RemoveMemberFromProject(r.Context(), currentUser.ID, id, memberUserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User is not a member of the project", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to add member to the project", http.StatusInternalServerError)
+		writeProjectError(w, err, "Failed to remove the project")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(user)
+
 }
 
-func (s projectServiceImpl) RemoveMemberFromProject(w http.ResponseWriter, r *http.Request) {
+func (s projectServiceImpl) DeleteProject(w http.ResponseWriter, r *http.Request) {
 	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
 	if !ok {
 		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
@@ -200,52 +244,187 @@ func (s projectServiceImpl) RemoveMemberFromProject(w http.ResponseWriter, r *ht
 		return
 	}
 
-	memberUserIDStr := chi.URLParam(r, "userID")
-	if memberUserIDStr == "" {
-		http.Error(w, "member's userID not provided", http.StatusBadRequest)
+	err = s.repo.DeleteProjectByID(r.Context(), currentUser.ID, id)
+	if err != nil {
+		writeProjectError(w, err, "Failed to remove the project")
 		return
 	}
 
-	memberUserID, err := strconv.Atoi(memberUserIDStr)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s projectServiceImpl) ChangeMemberRole(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, "unable to parse member user ID ID", http.StatusBadRequest)
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+	memberUserID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "unable to parse member user ID", http.StatusBadRequest)
 		return
 	}
 
-	err = s.repo.RemoveMemberFromProject(r.Context(), currentUser.ID, id, memberUserID)
+	var payload models.MemberRolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	role, err := authz.ParseRole(payload.Role)
 	if err != nil {
-		http.Error(w, "Failed to remove the project", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if role == authz.RoleOwner {
+		http.Error(w, "The owner role changes only with the ownership of the project", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	member, err := s.repo.ChangeMemberRole(r.Context(), currentUser.ID, id, memberUserID, role)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User is not a member of the project", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ChangeMemberRole] Failed to change role of user ID %d in project ID %d: %v", memberUserID, id, err)
+		writeProjectError(w, err, "Failed to change the member's role")
+		return
+	}
+
+	log.Printf("[INFO] [ChangeMemberRole] User ID %d made user ID %d %s of project ID %d", currentUser.ID, memberUserID, role, id)
 
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(member)
 }
 
-func (s projectServiceImpl) DeleteProject(w http.ResponseWriter, r *http.Request) {
+func (s projectServiceImpl) TransferProject(w http.ResponseWriter, r *http.Request) {
 	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
 	if !ok {
 		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
 		return
 	}
 
-	idStr := chi.URLParam(r, "id")
-	if idStr == "" {
-		http.Error(w, "project ID not provided", http.StatusBadRequest)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
 		return
 	}
 
-	id, err := strconv.Atoi(idStr)
+	var payload models.TransferProjectPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if payload.UserID == 0 {
+		http.Error(w, "user_id of the new owner is required", http.StatusBadRequest)
+		return
+	}
+	if payload.UserID == currentUser.ID {
+		http.Error(w, "You already own this project", http.StatusBadRequest)
+		return
+	}
+
+	previousOwnerRole := s.cfg.PREVIOUS_OWNER_ROLE
+	if payload.PreviousOwnerRole != "" {
+		previousOwnerRole, err = authz.ParseRole(payload.PreviousOwnerRole)
+		if err != nil || previousOwnerRole == authz.RoleOwner {
+			http.Error(w, "previous_owner_role must be admin, editor, commenter or viewer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.repo.TransferOwnership(r.Context(), currentUser.ID, id, payload.UserID, previousOwnerRole)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "The new owner must be a member of the project", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [TransferProject] Failed to transfer project ID %d to user ID %d: %v", id, payload.UserID, err)
+		writeProjectError(w, err, "Failed to transfer the project")
+		return
+	}
+
+	log.Printf("[INFO] [TransferProject] User ID %d transferred project ID %d to user ID %d and is now %s", currentUser.ID, id, payload.UserID, previousOwnerRole)
+
+	project, err := s.repo.GetProjectByID(r.Context(), currentUser.ID, id)
+	if err != nil {
+		writeProjectError(w, err, "Failed to query the project")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(project)
+}
+
+func (s projectServiceImpl) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
 		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
 		return
 	}
 
-	err = s.repo.DeleteProjectByID(r.Context(), currentUser.ID, id)
+	limit := 50
+	if val := r.URL.Query().Get("limit"); val != "" {
+		limit, err = strconv.Atoi(val)
+		if err != nil || limit < 1 || limit > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := s.repo.GetAuditLog(r.Context(), currentUser.ID, id, limit)
 	if err != nil {
-		http.Error(w, "Failed to remove the project", http.StatusInternalServerError)
+		writeProjectError(w, err, "Failed to query the audit log")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
+
+// OrgHeader selects the organization of the project routes that are not
+// nested under /orgs/{org}
+const OrgHeader = "X-Org-ID"
+
+// selectedOrg returns the organization a request is scoped to, zero when
+// none is selected
+func selectedOrg(r *http.Request) (int, error) {
+	val := chi.URLParam(r, "org")
+	if val == "" {
+		val = r.Header.Get(OrgHeader)
+	}
+	if val == "" {
+		return 0, nil
+	}
+	orgID, err := strconv.Atoi(val)
+	if err != nil || orgID <= 0 {
+		return 0, errors.New("unable to parse organization ID")
+	}
+	return orgID, nil
+}
+
+// writeProjectError answers a failed project or task operation. Projects
+// the user is not a member of are reported as not found, so that their IDs
+// are not disclosed.
+func writeProjectError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, authz.ErrNotMember):
+		http.Error(w, "Project not found", http.StatusNotFound)
+	case errors.Is(err, authz.ErrForbidden):
+		http.Error(w, "Your role in this project does not allow this", http.StatusForbidden)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
+	}
 }
@@ -1,17 +1,65 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"net/http"
+	"task-matrix-be/internals/authmodule"
+	"task-matrix-be/internals/config"
+	"task-matrix-be/internals/mailer"
 	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/oidc"
 	"task-matrix-be/internals/repo"
 )
 
 type UserService interface {
 	Login(w http.ResponseWriter, r *http.Request)
 	Signup(w http.ResponseWriter, r *http.Request)
+	Refresh(w http.ResponseWriter, r *http.Request)
 	GetLoggedInUser(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	ListSessions(w http.ResponseWriter, r *http.Request)
+	RevokeSession(w http.ResponseWriter, r *http.Request)
+	RevokeAllSessions(w http.ResponseWriter, r *http.Request)
+	ForgotPassword(w http.ResponseWriter, r *http.Request)
+	ResetPassword(w http.ResponseWriter, r *http.Request)
+	VerifyEmail(w http.ResponseWriter, r *http.Request)
+	ResendVerificationEmail(w http.ResponseWriter, r *http.Request)
+	RequireVerifiedEmail(next http.Handler) http.Handler
+	LoginMFA(w http.ResponseWriter, r *http.Request)
+	SetupTOTP(w http.ResponseWriter, r *http.Request)
+	ConfirmTOTP(w http.ResponseWriter, r *http.Request)
+	DisableTOTP(w http.ResponseWriter, r *http.Request)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request)
+	UnlockAccount(w http.ResponseWriter, r *http.Request)
+	ListLoginAttempts(w http.ResponseWriter, r *http.Request)
+	ValidateToken(tokenStr string) (models.User, error)
+	ValidateAPIKey(ctx context.Context, key string) (models.User, models.APIKey, error)
+	CreateAPIKey(w http.ResponseWriter, r *http.Request)
+	ListAPIKeys(w http.ResponseWriter, r *http.Request)
+	GetAPIKey(w http.ResponseWriter, r *http.Request)
+	UpdateAPIKey(w http.ResponseWriter, r *http.Request)
+	DeleteAPIKey(w http.ResponseWriter, r *http.Request)
+	OIDCLogin(w http.ResponseWriter, r *http.Request)
+	OIDCCallback(w http.ResponseWriter, r *http.Request)
+	GetProfile(w http.ResponseWriter, r *http.Request)
+	UpdateProfile(w http.ResponseWriter, r *http.Request)
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	ChangeEmail(w http.ResponseWriter, r *http.Request)
+	SearchUsers(w http.ResponseWriter, r *http.Request)
+	ExportAccount(w http.ResponseWriter, r *http.Request)
+	DeleteAccount(w http.ResponseWriter, r *http.Request)
+	RequestReauthentication(w http.ResponseWriter, r *http.Request)
+	IsAdmin(ctx context.Context, userID int) (bool, error)
+	ListUsers(w http.ResponseWriter, r *http.Request)
+	GetUser(w http.ResponseWriter, r *http.Request)
+	UpdateUser(w http.ResponseWriter, r *http.Request)
+	DisableUser(w http.ResponseWriter, r *http.Request)
+	EnableUser(w http.ResponseWriter, r *http.Request)
+	ForcePasswordReset(w http.ResponseWriter, r *http.Request)
+	ListAllProjects(w http.ResponseWriter, r *http.Request)
+	GetSystemStats(w http.ResponseWriter, r *http.Request)
 }
 
 type ProjectService interface {
@@ -19,29 +67,92 @@ type ProjectService interface {
 	GetAllProjects(w http.ResponseWriter, r *http.Request)
 	ViewProject(w http.ResponseWriter, r *http.Request)
 	UpdateProject(w http.ResponseWriter, r *http.Request)
-	AddMemberToProject(w http.ResponseWriter, r *http.Request)
+	InviteMember(w http.ResponseWriter, r *http.Request)
 	RemoveMemberFromProject(w http.ResponseWriter, r *http.Request)
 	DeleteProject(w http.ResponseWriter, r *http.Request)
+	ChangeMemberRole(w http.ResponseWriter, r *http.Request)
+	TransferProject(w http.ResponseWriter, r *http.Request)
+	GetAuditLog(w http.ResponseWriter, r *http.Request)
+	CreateInvitation(w http.ResponseWriter, r *http.Request)
+	ListInvitations(w http.ResponseWriter, r *http.Request)
+	RevokeInvitation(w http.ResponseWriter, r *http.Request)
+	ListMyInvitations(w http.ResponseWriter, r *http.Request)
+	AcceptMyInvitation(w http.ResponseWriter, r *http.Request)
+	DeclineMyInvitation(w http.ResponseWriter, r *http.Request)
+	AcceptInvitation(w http.ResponseWriter, r *http.Request)
+	DeclineInvitation(w http.ResponseWriter, r *http.Request)
+	AddTeamToProject(w http.ResponseWriter, r *http.Request)
+	ChangeTeamRole(w http.ResponseWriter, r *http.Request)
+	RemoveTeamFromProject(w http.ResponseWriter, r *http.Request)
+	CreateShareLink(w http.ResponseWriter, r *http.Request)
+	ListShareLinks(w http.ResponseWriter, r *http.Request)
+	DeleteShareLink(w http.ResponseWriter, r *http.Request)
+	ViewSharedProject(w http.ResponseWriter, r *http.Request)
+}
+
+type OrgService interface {
+	ListOrganizations(w http.ResponseWriter, r *http.Request)
+	CreateOrganization(w http.ResponseWriter, r *http.Request)
+	GetOrganization(w http.ResponseWriter, r *http.Request)
+	UpdateOrganization(w http.ResponseWriter, r *http.Request)
+	InviteOrgMember(w http.ResponseWriter, r *http.Request)
+	ListOrgInvitations(w http.ResponseWriter, r *http.Request)
+	RevokeOrgInvitation(w http.ResponseWriter, r *http.Request)
+	ListMyOrgInvitations(w http.ResponseWriter, r *http.Request)
+	AcceptMyOrgInvitation(w http.ResponseWriter, r *http.Request)
+	DeclineMyOrgInvitation(w http.ResponseWriter, r *http.Request)
+	ChangeOrgMemberRole(w http.ResponseWriter, r *http.Request)
+	RemoveOrgMember(w http.ResponseWriter, r *http.Request)
+	ListTeams(w http.ResponseWriter, r *http.Request)
+	CreateTeam(w http.ResponseWriter, r *http.Request)
+	GetTeam(w http.ResponseWriter, r *http.Request)
+	UpdateTeam(w http.ResponseWriter, r *http.Request)
+	DeleteTeam(w http.ResponseWriter, r *http.Request)
+	AddTeamMember(w http.ResponseWriter, r *http.Request)
+	RemoveTeamMember(w http.ResponseWriter, r *http.Request)
 }
 
 type TaskService interface {
 	CreateTask(w http.ResponseWriter, r *http.Request)
 	UpdateTask(w http.ResponseWriter, r *http.Request)
 	DeleteTask(w http.ResponseWriter, r *http.Request)
+	GetTask(w http.ResponseWriter, r *http.Request)
+	ListTasks(w http.ResponseWriter, r *http.Request)
+	ListMyTasks(w http.ResponseWriter, r *http.Request)
+	ListChecklist(w http.ResponseWriter, r *http.Request)
+	AddChecklistItem(w http.ResponseWriter, r *http.Request)
+	UpdateChecklistItem(w http.ResponseWriter, r *http.Request)
+	DeleteChecklistItem(w http.ResponseWriter, r *http.Request)
+	AddTaskBlocker(w http.ResponseWriter, r *http.Request)
+	RemoveTaskBlocker(w http.ResponseWriter, r *http.Request)
+	GetDependencyGraph(w http.ResponseWriter, r *http.Request)
 }
 
 func GetServices(
 	db *sql.DB,
-	tokenGenerator func(payload models.User) (string, error),
-) (UserService, ProjectService, TaskService, error) {
-	if db == nil || tokenGenerator == nil {
-		return nil, nil, nil, errors.New("invalid params passed to GetServices")
+	auth authmodule.Auth[models.User],
+	mail mailer.Mailer,
+	cfg *config.Config,
+) (UserService, ProjectService, TaskService, OrgService, error) {
+	if db == nil || auth == nil || mail == nil || cfg == nil {
+		return nil, nil, nil, nil, errors.New("invalid params passed to GetServices")
 	}
 
-	ur, pr, tr, err := repo.GetRepos(db)
+	ur, pr, tr, or, err := repo.GetRepos(db)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
+	}
+
+	// ADMIN_USERNAMES bootstraps the administrators, who can appoint others
+	// from the admin console
+	if err := ur.PromoteAdmins(context.Background(), cfg.ADMIN_USERNAMES); err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	us := &userServiceImpl{repo: ur, projects: pr, auth: auth, mailer: mail, cfg: cfg}
+	if cfg.OIDC_ISSUER_URL != "" {
+		us.oidc = oidc.NewProvider(cfg.OIDC_ISSUER_URL, cfg.OIDC_CLIENT_ID, cfg.OIDC_CLIENT_SECRET, cfg.OIDC_REDIRECT_URL, cfg.OIDC_SCOPES, nil)
 	}
 
-	return &userServiceImpl{repo: ur, tokenGenerator: tokenGenerator}, &projectServiceImpl{repo: pr}, &taskServiceImpl{repo: tr}, nil
+	return us, &projectServiceImpl{repo: pr, mailer: mail, cfg: cfg}, &taskServiceImpl{repo: tr}, &orgServiceImpl{repo: or, mailer: mail, cfg: cfg}, nil
 }
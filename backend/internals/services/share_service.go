@@ -0,0 +1,236 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SharePasswordHeader carries the password of a password protected share
+// link, so that it stays out of URLs and access logs
+const SharePasswordHeader = "X-Share-Password"
+
+func (s projectServiceImpl) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.ShareLinkPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt *time.Time
+	if payload.ExpiresAt != nil {
+		if !payload.ExpiresAt.After(time.Now()) {
+			http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+			return
+		}
+		t := payload.ExpiresAt.UTC()
+		expiresAt = &t
+	}
+
+	var passwordHash *string
+	if payload.Password != "" {
+		hashed, err := utils.HashPassword(payload.Password)
+		if err != nil {
+			log.Printf("[ERROR] [CreateShareLink] Failed to hash password: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		passwordHash = &hashed
+	}
+
+	slug, err := utils.RandomSlug()
+	if err != nil {
+		log.Printf("[ERROR] [CreateShareLink] Failed to generate slug: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	link, err := s.repo.CreateShareLink(r.Context(), currentUser.ID, id, slug, passwordHash, expiresAt)
+	if err != nil {
+		log.Printf("[ERROR] [CreateShareLink] Failed to share project ID %d: %v", id, err)
+		writeProjectError(w, err, "Failed to create the share link")
+		return
+	}
+	s.setShareURL(&link)
+
+	log.Printf("[INFO] [CreateShareLink] User ID %d created share link ID %d of project ID %d", currentUser.ID, link.ID, id)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+func (s projectServiceImpl) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+
+	links, err := s.repo.ListShareLinks(r.Context(), currentUser.ID, id)
+	if err != nil {
+		writeProjectError(w, err, "Failed to query the share links")
+		return
+	}
+	for i := range links {
+		s.setShareURL(&links[i])
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(links)
+}
+
+func (s projectServiceImpl) DeleteShareLink(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return
+	}
+	linkID, err := strconv.Atoi(chi.URLParam(r, "linkID"))
+	if err != nil {
+		http.Error(w, "unable to parse share link ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.DeleteShareLink(r.Context(), currentUser.ID, id, linkID)
+	if errors.Is(err, repo.ErrShareLinkNotFound) {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [DeleteShareLink] Failed to revoke share link ID %d of project ID %d: %v", linkID, id, err)
+		writeProjectError(w, err, "Failed to revoke the share link")
+		return
+	}
+
+	log.Printf("[INFO] [DeleteShareLink] User ID %d revoked share link ID %d of project ID %d", currentUser.ID, linkID, id)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Share link revoked successfully"}`))
+}
+
+// ViewSharedProject serves the read-only view of a project to anyone with
+// its share link. Unknown and revoked links look the same.
+func (s projectServiceImpl) ViewSharedProject(w http.ResponseWriter, r *http.Request) {
+	// Revoking a link has to take effect at once, also behind caches
+	w.Header().Set("Cache-Control", "no-store")
+
+	link, passwordHash, err := s.repo.GetShareLink(r.Context(), chi.URLParam(r, "slug"))
+	if errors.Is(err, repo.ErrShareLinkNotFound) {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ViewSharedProject] Failed to resolve share link: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		http.Error(w, "This share link has expired", http.StatusGone)
+		return
+	}
+
+	if passwordHash != "" {
+		password := r.Header.Get(SharePasswordHeader)
+		if password == "" {
+			http.Error(w, "This share link requires a password", http.StatusUnauthorized)
+			return
+		}
+		match, _, err := utils.VerifyPassword(passwordHash, password)
+		if err != nil {
+			log.Printf("[ERROR] [ViewSharedProject] Failed to verify password of share link ID %d: %v", link.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !match {
+			log.Printf("[WARN] [ViewSharedProject] Wrong password for share link ID %d", link.ID)
+			http.Error(w, "Incorrect password", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	project, err := s.repo.GetSharedProject(r.Context(), link)
+	if err != nil {
+		log.Printf("[ERROR] [ViewSharedProject] Failed to load project ID %d of share link ID %d: %v", link.ProjectID, link.ID, err)
+		http.Error(w, "Failed to query the project", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(publicProject(project))
+}
+
+func (s projectServiceImpl) setShareURL(link *models.ShareLink) {
+	link.URL = s.cfg.APP_BASE_URL + "/share/" + link.Slug
+}
+
+// publicProject strips a project of everything a share link must not reveal,
+// email addresses and usernames in particular
+func publicProject(pd models.ProjectDetail) models.PublicProject {
+	p := models.PublicProject{
+		Name:        pd.Name,
+		Description: pd.Description,
+		DueDate:     pd.DueDate,
+		Status:      pd.Status,
+		Owner:       publicUser(pd.Owner),
+		Members:     make([]models.PublicUser, 0, len(pd.Members)),
+		Tasks:       make([]models.PublicTask, 0, len(pd.Tasks)),
+	}
+	for _, m := range pd.Members {
+		p.Members = append(p.Members, publicUser(m.User))
+	}
+	for _, t := range pd.Tasks {
+		p.Tasks = append(p.Tasks, models.PublicTask{
+			ID:           t.ID,
+			Title:        t.Title,
+			Description:  t.Description,
+			Priority:     t.Priority,
+			Status:       t.Status,
+			Assignee:     publicUser(t.Assignee),
+			StartDate:    t.StartDate,
+			DueDate:      t.DueDate,
+			Overdue:      t.Overdue,
+			ParentTaskID: t.ParentTaskID,
+			Subtasks:     t.Subtasks,
+			Checklist:    t.Checklist,
+		})
+	}
+	return p
+}
+
+func publicUser(u models.User) models.PublicUser {
+	return models.PublicUser{Name: u.Name, AvatarUrl: u.AvatarUrl}
+}
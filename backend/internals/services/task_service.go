@@ -1,13 +1,18 @@
 package services
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"task-matrix-be/internals/middlewares"
 	"task-matrix-be/internals/models"
 	"task-matrix-be/internals/repo"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -40,24 +45,27 @@ func (s *taskServiceImpl) CreateTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Task title is required", http.StatusBadRequest)
 		return
 	}
+	if err := validateTaskDates(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	taskID, err := s.repo.CreateTask(
 		r.Context(), currentUser.ID, projectID,
 		payload.Title, payload.Description,
 		payload.PriorityID, payload.StatusID, payload.AssigneeID,
+		payload.StartDate, payload.DueDate, payload.ParentTaskID,
 	)
 	if err != nil {
-		http.Error(w, "Failed to create task", http.StatusInternalServerError)
+		writeTaskError(w, err, "Failed to create task")
 		return
 	}
 
-	task := models.Task{
-		ID:          taskID,
-		Title:       payload.Title,
-		Description: payload.Description,
-		Priority:    models.Priority{ID: payload.PriorityID},
-		Status:      models.Status{ID: payload.StatusID},
-		Assignee:    models.User{ID: payload.AssigneeID},
+	task, err := s.repo.GetTask(r.Context(), currentUser.ID, projectID, taskID)
+	if err != nil {
+		log.Printf("[ERROR] [CreateTask] Failed to load created task ID %d: %v", taskID, err)
+		writeProjectError(w, err, "Failed to query the task")
+		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -92,21 +100,104 @@ func (s *taskServiceImpl) UpdateTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Task title is required", http.StatusBadRequest)
 		return
 	}
+	if err := validateTaskDates(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// force=true completes a task even though tasks blocking it are open,
+	// answering with a warning instead of rejecting the update
+	var force bool
+	if val := r.URL.Query().Get("force"); val != "" {
+		if force, err = strconv.ParseBool(val); err != nil {
+			http.Error(w, "force must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
 
-	err = s.repo.UpdateTaskByID(
+	blockers, err := s.repo.UpdateTaskByID(
 		r.Context(), currentUser.ID, projectID, taskID,
 		payload.Title, payload.Description,
 		payload.PriorityID, payload.StatusID, payload.AssigneeID,
+		payload.StartDate, payload.DueDate, payload.ParentTaskID,
+		force,
 	)
+	if errors.Is(err, repo.ErrTaskBlocked) {
+		http.Error(w, blockedMessage(blockers)+": complete them first, or pass force=true to complete it anyway", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to update task", http.StatusInternalServerError)
+		writeTaskError(w, err, "Failed to update task")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
+	if len(blockers) > 0 {
+		json.NewEncoder(w).Encode(map[string]any{
+			"message":  "Task updated successfully",
+			"warnings": []string{blockedMessage(blockers)},
+		})
+		return
+	}
 	w.Write([]byte(`{"message":"Task updated successfully"}`))
 }
 
+// blockedMessage tells which open tasks block a task
+func blockedMessage(blockers []int) string {
+	ids := make([]string, len(blockers))
+	for i, id := range blockers {
+		ids[i] = strconv.Itoa(id)
+	}
+	return "Task is blocked by open tasks " + strings.Join(ids, ", ")
+}
+
+// validateTaskDates checks the start and due dates of a task payload,
+// treating empty strings like null
+func validateTaskDates(payload *models.TaskPayload) error {
+	for _, d := range []struct {
+		name  string
+		value **string
+	}{{"start_date", &payload.StartDate}, {"due_date", &payload.DueDate}} {
+		if *d.value == nil {
+			continue
+		}
+		if **d.value == "" {
+			*d.value = nil
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, **d.value); err != nil {
+			return fmt.Errorf("%s must be a date formatted as YYYY-MM-DD", d.name)
+		}
+	}
+	if payload.StartDate != nil && payload.DueDate != nil && *payload.StartDate > *payload.DueDate {
+		return errors.New("start_date must not be after due_date")
+	}
+	return nil
+}
+
+// writeTaskError answers with the status matching an error of the task
+// repository, falling back to writeProjectError
+func writeTaskError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, repo.ErrTaskNotFound):
+		http.Error(w, "Task not found", http.StatusNotFound)
+	case errors.Is(err, repo.ErrChecklistItemNotFound):
+		http.Error(w, "Checklist item not found", http.StatusNotFound)
+	case errors.Is(err, repo.ErrDependencyNotFound):
+		http.Error(w, "Dependency not found", http.StatusNotFound)
+	case errors.Is(err, repo.ErrParentTaskNotFound),
+		errors.Is(err, repo.ErrTaskCycle),
+		errors.Is(err, repo.ErrTaskTooDeep),
+		errors.Is(err, repo.ErrBlockerNotFound):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repo.ErrDependencyExists),
+		errors.Is(err, repo.ErrDependencyCycle):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		writeProjectError(w, err, message)
+	}
+}
+
 func (s *taskServiceImpl) DeleteTask(w http.ResponseWriter, r *http.Request) {
 	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
 	if !ok {
@@ -127,10 +218,330 @@ func (s *taskServiceImpl) DeleteTask(w http.ResponseWriter, r *http.Request) {
 
 	err = s.repo.DeleteTaskByID(r.Context(), currentUser.ID, projectID, taskID)
 	if err != nil {
-		http.Error(w, "Failed to delete task", http.StatusInternalServerError)
+		writeProjectError(w, err, "Failed to delete task")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"message":"Task deleted successfully"}`))
 }
+
+const (
+	defaultTaskListLimit = 50
+	maxTaskListLimit     = 200
+
+	maxCompletedWithinDays = 365
+)
+
+func (s *taskServiceImpl) GetTask(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "projectId"))
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	taskID, err := strconv.Atoi(chi.URLParam(r, "taskId"))
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+
+	task, err := s.repo.GetTask(r.Context(), currentUser.ID, projectID, taskID)
+	if errors.Is(err, repo.ErrTaskNotFound) {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeProjectError(w, err, "Failed to query the task")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(task)
+}
+
+func (s *taskServiceImpl) ListTasks(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	projectID, err := strconv.Atoi(chi.URLParam(r, "projectId"))
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseTaskFilter(r, currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, next, err := s.repo.ListTasks(r.Context(), currentUser.ID, projectID, filter)
+	if errors.Is(err, repo.ErrInvalidCursor) {
+		http.Error(w, "cursor is invalid", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ListTasks] Failed to list tasks of project ID %d: %v", projectID, err)
+		writeProjectError(w, err, "Failed to query the tasks")
+		return
+	}
+
+	writeTaskPage(w, tasks, next, filter)
+}
+
+// ListMyTasks lists the tasks assigned to the user across all their
+// projects, with the filters of ListTasks
+func (s *taskServiceImpl) ListMyTasks(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Has("assignee") {
+		http.Error(w, "assignee cannot be used here, these are the tasks assigned to you", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseTaskFilter(r, currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tasks, next, err := s.repo.ListMyTasks(r.Context(), currentUser.ID, filter)
+	if errors.Is(err, repo.ErrInvalidCursor) {
+		http.Error(w, "cursor is invalid", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ListMyTasks] Failed to list tasks of user ID %d: %v", currentUser.ID, err)
+		http.Error(w, "Failed to query the tasks", http.StatusInternalServerError)
+		return
+	}
+
+	writeTaskPage(w, tasks, next, filter)
+}
+
+// writeTaskPage answers with a page of tasks and the cursor of the next one,
+// and the tasks split into groups when the listing is grouped. A group can
+// go on in the next page.
+func writeTaskPage(w http.ResponseWriter, tasks []models.Task, next *models.TaskCursor, filter models.TaskFilter) {
+	var nextCursor *string
+	if next != nil {
+		c := encodeTaskCursor(*next)
+		nextCursor = &c
+	}
+
+	page := map[string]any{
+		"tasks":       tasks,
+		"limit":       filter.Limit,
+		"has_more":    next != nil,
+		"next_cursor": nextCursor,
+	}
+	if filter.GroupBy != "" {
+		page["groups"] = groupTasks(tasks, filter.GroupBy)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// groupTasks splits tasks ordered by groupBy into runs sharing its value
+func groupTasks(tasks []models.Task, groupBy string) []models.TaskGroup {
+	groups := make([]models.TaskGroup, 0)
+	for _, t := range tasks {
+		var id int
+		var name string
+		switch groupBy {
+		case models.TaskSortPriority:
+			id, name = t.Priority.ID, t.Priority.Name
+		case models.TaskSortStatus:
+			id, name = t.Status.ID, t.Status.Name
+		case models.TaskSortProject:
+			id, name = t.ProjectID, t.ProjectName
+		}
+		if len(groups) == 0 || groups[len(groups)-1].ID != id {
+			groups = append(groups, models.TaskGroup{ID: id, Name: name})
+		}
+		last := &groups[len(groups)-1]
+		last.Tasks = append(last.Tasks, t)
+	}
+	return groups
+}
+
+// parseTaskFilter reads the filters, order and page of a task listing from
+// the query string:
+//
+//	status, priority, assignee  comma separated IDs, assignee also takes "me"
+//	q                           text in the title or description
+//	created_from, created_to    inclusive dates, YYYY-MM-DD
+//	due_from, due_to            inclusive dates, YYYY-MM-DD
+//	overdue                     true keeps the overdue tasks
+//	parent                      task ID keeping its subtasks, "none" keeping the top-level tasks
+//	completed_within            number of days, keeps the tasks completed in them
+//	group_by                    priority, status or project, ordered before sort
+//	sort                        created, priority, status, title, project or due, "-" first for descending
+//	limit, cursor               page size and the next_cursor of the previous page
+func parseTaskFilter(r *http.Request, currentUserID int) (models.TaskFilter, error) {
+	query := r.URL.Query()
+	var f models.TaskFilter
+	var err error
+
+	if f.StatusIDs, err = parseIDList(query.Get("status"), "status", 0); err != nil {
+		return f, err
+	}
+	if f.PriorityIDs, err = parseIDList(query.Get("priority"), "priority", 0); err != nil {
+		return f, err
+	}
+	if f.AssigneeIDs, err = parseIDList(query.Get("assignee"), "assignee", currentUserID); err != nil {
+		return f, err
+	}
+	f.Text = query.Get("q")
+
+	if f.CreatedFrom, err = parseDateParam(query.Get("created_from"), "created_from", false); err != nil {
+		return f, err
+	}
+	if f.CreatedTo, err = parseDateParam(query.Get("created_to"), "created_to", true); err != nil {
+		return f, err
+	}
+
+	for _, d := range []struct {
+		name  string
+		value *string
+	}{{"due_from", &f.DueFrom}, {"due_to", &f.DueTo}} {
+		if *d.value = query.Get(d.name); *d.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, *d.value); err != nil {
+			return f, fmt.Errorf("%s must be a date formatted as YYYY-MM-DD", d.name)
+		}
+	}
+	if val := query.Get("overdue"); val != "" {
+		if f.Overdue, err = strconv.ParseBool(val); err != nil {
+			return f, errors.New("overdue must be true or false")
+		}
+	}
+
+	switch parent := query.Get("parent"); parent {
+	case "":
+	case "none":
+		f.TopLevel = true
+	default:
+		if f.ParentID, err = strconv.Atoi(parent); err != nil || f.ParentID < 1 {
+			return f, errors.New(`parent must be a task ID or "none"`)
+		}
+	}
+
+	if val := query.Get("completed_within"); val != "" {
+		days, err := strconv.Atoi(val)
+		if err != nil || days < 1 || days > maxCompletedWithinDays {
+			return f, fmt.Errorf("completed_within must be a number of days between 1 and %d", maxCompletedWithinDays)
+		}
+		since := time.Now().UTC().AddDate(0, 0, -days)
+		f.CompletedSince = &since
+	}
+
+	switch groupBy := query.Get("group_by"); groupBy {
+	case "", models.TaskSortPriority, models.TaskSortStatus, models.TaskSortProject:
+		f.GroupBy = groupBy
+	default:
+		return f, errors.New("group_by must be priority, status or project")
+	}
+
+	sort := query.Get("sort")
+	if strings.HasPrefix(sort, "-") {
+		sort, f.Desc = sort[1:], true
+	}
+	switch sort {
+	case "", models.TaskSortCreated, models.TaskSortPriority, models.TaskSortStatus, models.TaskSortTitle, models.TaskSortProject, models.TaskSortDue:
+		f.Sort = sort
+	default:
+		return f, errors.New("sort must be created, priority, status, title, project or due, prefixed with - for descending order")
+	}
+
+	f.Limit = defaultTaskListLimit
+	if val := query.Get("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > maxTaskListLimit {
+			return f, fmt.Errorf("limit must be between 1 and %d", maxTaskListLimit)
+		}
+		f.Limit = n
+	}
+	if val := query.Get("cursor"); val != "" {
+		cursor, err := decodeTaskCursor(val)
+		if err != nil {
+			return f, errors.New("cursor is invalid")
+		}
+		f.After = &cursor
+	}
+	return f, nil
+}
+
+// parseIDList parses comma separated IDs, "me" standing for meID when it is
+// not zero
+func parseIDList(val, name string, meID int) ([]int, error) {
+	if val == "" {
+		return nil, nil
+	}
+	var ids []int
+	for _, part := range strings.Split(val, ",") {
+		part = strings.TrimSpace(part)
+		if part == "me" && meID != 0 {
+			ids = append(ids, meID)
+			continue
+		}
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a comma separated list of IDs", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseDateParam parses a YYYY-MM-DD date as the start of that day in UTC,
+// or of the next day when end is set, so that the date is included in a
+// range ending there
+func parseDateParam(val, name string, end bool) (*time.Time, error) {
+	if val == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.DateOnly, val)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date formatted as YYYY-MM-DD", name)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// Cursors are opaque to clients, who only pass back the next_cursor they got
+func encodeTaskCursor(c models.TaskCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTaskCursor(s string) (models.TaskCursor, error) {
+	var c models.TaskCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if c.ID < 1 {
+		return c, errors.New("cursor without task ID")
+	}
+	return c, nil
+}
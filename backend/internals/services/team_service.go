@@ -0,0 +1,395 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"task-matrix-be/internals/authz"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/repo"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (s orgServiceImpl) ListTeams(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+
+	teams, err := s.repo.ListTeams(r.Context(), currentUser.ID, orgID)
+	if err != nil {
+		writeTeamError(w, err, "Failed to query the teams")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(teams)
+}
+
+func (s orgServiceImpl) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return
+	}
+
+	var payload models.TeamPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" {
+		http.Error(w, "Team name is required", http.StatusBadRequest)
+		return
+	}
+
+	team, err := s.repo.CreateTeam(r.Context(), currentUser.ID, orgID, payload.Name, payload.LeadID)
+	if err != nil {
+		writeOrgError(w, err, "Failed to create the team")
+		return
+	}
+
+	log.Printf("[INFO] [CreateTeam] User ID %d created team ID %d in organization ID %d", currentUser.ID, team.ID, orgID)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(team)
+}
+
+func (s orgServiceImpl) GetTeam(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, teamID, ok := teamParams(w, r)
+	if !ok {
+		return
+	}
+
+	team, err := s.repo.GetTeam(r.Context(), currentUser.ID, orgID, teamID)
+	if err != nil {
+		writeTeamError(w, err, "Failed to query the team")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(team)
+}
+
+func (s orgServiceImpl) UpdateTeam(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, teamID, ok := teamParams(w, r)
+	if !ok {
+		return
+	}
+
+	var payload models.UpdateTeamPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if payload.Name != nil {
+		*payload.Name = strings.TrimSpace(*payload.Name)
+		if *payload.Name == "" {
+			http.Error(w, "Team name cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+
+	team, err := s.repo.UpdateTeam(r.Context(), currentUser.ID, orgID, teamID, payload.Name, payload.LeadID)
+	if err != nil {
+		writeTeamError(w, err, "Failed to update the team")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(team)
+}
+
+func (s orgServiceImpl) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, teamID, ok := teamParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.repo.DeleteTeam(r.Context(), currentUser.ID, orgID, teamID)
+	if errors.Is(err, repo.ErrTeamNotFound) {
+		http.Error(w, "Team not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeOrgError(w, err, "Failed to delete the team")
+		return
+	}
+
+	log.Printf("[INFO] [DeleteTeam] User ID %d deleted team ID %d of organization ID %d", currentUser.ID, teamID, orgID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Team deleted successfully"}`))
+}
+
+func (s orgServiceImpl) AddTeamMember(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, teamID, ok := teamParams(w, r)
+	if !ok {
+		return
+	}
+	username := chi.URLParam(r, "username")
+
+	member, err := s.repo.AddTeamMember(r.Context(), currentUser.ID, orgID, teamID, username)
+	if err != nil {
+		writeTeamError(w, err, "Failed to add the member")
+		return
+	}
+
+	log.Printf("[INFO] [AddTeamMember] User ID %d added user ID %d to team ID %d", currentUser.ID, member.ID, teamID)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(member)
+}
+
+func (s orgServiceImpl) RemoveTeamMember(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	orgID, teamID, ok := teamParams(w, r)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(chi.URLParam(r, "userID"))
+	if err != nil {
+		http.Error(w, "unable to parse member user ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.repo.RemoveTeamMember(r.Context(), currentUser.ID, orgID, teamID, memberID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User is not a member of the team", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeTeamError(w, err, "Failed to remove the member")
+		return
+	}
+
+	log.Printf("[INFO] [RemoveTeamMember] User ID %d removed user ID %d from team ID %d", currentUser.ID, memberID, teamID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Member removed successfully"}`))
+}
+
+func (s projectServiceImpl) AddTeamToProject(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, teamID, ok := projectTeamParams(w, r)
+	if !ok {
+		return
+	}
+
+	// The role is optional, teams get the default role of the organization
+	var payload models.MemberRolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	var role authz.Role
+	if payload.Role != "" {
+		var err error
+		if role, err = parseTeamRole(payload.Role); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	team, err := s.repo.AddTeamToProject(r.Context(), currentUser.ID, id, teamID, role)
+	switch {
+	case errors.Is(err, repo.ErrTeamNotFound):
+		http.Error(w, "Team not found in the organization of the project", http.StatusNotFound)
+		return
+	case errors.Is(err, repo.ErrTeamAlreadyGranted):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("[ERROR] [AddTeamToProject] Failed to add team ID %d to project ID %d: %v", teamID, id, err)
+		writeProjectError(w, err, "Failed to add the team to the project")
+		return
+	}
+
+	log.Printf("[INFO] [AddTeamToProject] User ID %d added team ID %d to project ID %d as %s", currentUser.ID, teamID, id, team.Role)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(team)
+}
+
+func (s projectServiceImpl) ChangeTeamRole(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, teamID, ok := projectTeamParams(w, r)
+	if !ok {
+		return
+	}
+
+	var payload models.MemberRolePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	role, err := parseTeamRole(payload.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	team, err := s.repo.ChangeTeamRole(r.Context(), currentUser.ID, id, teamID, role)
+	if errors.Is(err, repo.ErrTeamNotFound) {
+		http.Error(w, "The team has no role in the project", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [ChangeTeamRole] Failed to change role of team ID %d in project ID %d: %v", teamID, id, err)
+		writeProjectError(w, err, "Failed to change the team's role")
+		return
+	}
+
+	log.Printf("[INFO] [ChangeTeamRole] User ID %d made team ID %d %s of project ID %d", currentUser.ID, teamID, role, id)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(team)
+}
+
+func (s projectServiceImpl) RemoveTeamFromProject(w http.ResponseWriter, r *http.Request) {
+	currentUser, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	id, teamID, ok := projectTeamParams(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.repo.RemoveTeamFromProject(r.Context(), currentUser.ID, id, teamID)
+	if errors.Is(err, repo.ErrTeamNotFound) {
+		http.Error(w, "The team has no role in the project", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [RemoveTeamFromProject] Failed to remove team ID %d from project ID %d: %v", teamID, id, err)
+		writeProjectError(w, err, "Failed to remove the team from the project")
+		return
+	}
+
+	log.Printf("[INFO] [RemoveTeamFromProject] User ID %d removed team ID %d from project ID %d", currentUser.ID, teamID, id)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Team removed successfully"}`))
+}
+
+// parseTeamRole validates the role of a team in a project, teams cannot own
+// projects
+func parseTeamRole(s string) (authz.Role, error) {
+	role, err := authz.ParseRole(s)
+	if err == nil && role == authz.RoleOwner {
+		err = errors.New("a team cannot be the owner of a project")
+	}
+	return role, err
+}
+
+// teamParams parses the organization and team IDs of the path
+func teamParams(w http.ResponseWriter, r *http.Request) (orgID, teamID int, ok bool) {
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		http.Error(w, "unable to parse organization ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	teamID, err = strconv.Atoi(chi.URLParam(r, "team"))
+	if err != nil {
+		http.Error(w, "unable to parse team ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return orgID, teamID, true
+}
+
+// projectTeamParams parses the project and team IDs of the path
+func projectTeamParams(w http.ResponseWriter, r *http.Request) (projectID, teamID int, ok bool) {
+	projectID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "unable to parse project ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	teamID, err = strconv.Atoi(chi.URLParam(r, "teamID"))
+	if err != nil {
+		http.Error(w, "unable to parse team ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return projectID, teamID, true
+}
+
+// writeTeamError answers a failed team operation, which team leads may
+// perform as well as organization admins
+func writeTeamError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, repo.ErrTeamNotFound):
+		http.Error(w, "Team not found", http.StatusNotFound)
+	case errors.Is(err, repo.ErrAlreadyTeamMember):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repo.ErrTeamRoleAboveLead):
+		http.Error(w, "The team has a role in one of its projects that only its admins can give", http.StatusForbidden)
+	case errors.Is(err, authz.ErrForbidden):
+		http.Error(w, "Only organization admins and the team lead can do this", http.StatusForbidden)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "User is not a member of the organization", http.StatusNotFound)
+	default:
+		writeOrgError(w, err, message)
+	}
+}
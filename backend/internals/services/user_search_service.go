@@ -0,0 +1,76 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"task-matrix-be/internals/middlewares"
+	"task-matrix-be/internals/models"
+)
+
+const (
+	defaultUserSearchLimit = 20
+	maxUserSearchLimit     = 100
+)
+
+// parsePagination reads the limit and offset query parameters
+func parsePagination(r *http.Request, defaultLimit, maxLimit int) (limit, offset int, ok bool) {
+	limit, offset = defaultLimit, 0
+	if val := r.URL.Query().Get("limit"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 || n > maxLimit {
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if val := r.URL.Query().Get("offset"); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+func (s *userServiceImpl) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	limit, offset, ok := parsePagination(r, defaultUserSearchLimit, maxUserSearchLimit)
+	if !ok {
+		http.Error(w, "limit must be between 1 and 100 and offset must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if len(query) > 100 {
+		http.Error(w, "q must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	// One more than requested tells whether there is a next page
+	users, err := s.repo.SearchUsers(r.Context(), user.ID, query, limit+1, offset)
+	if err != nil {
+		log.Printf("[ERROR] [SearchUsers] Failed to search users for user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to search users", http.StatusInternalServerError)
+		return
+	}
+
+	hasMore := len(users) > limit
+	if hasMore {
+		users = users[:limit]
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{
+		"users":    users,
+		"limit":    limit,
+		"offset":   offset,
+		"has_more": hasMore,
+	})
+}
@@ -1,18 +1,72 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"task-matrix-be/internals/authmodule"
+	"task-matrix-be/internals/config"
+	"task-matrix-be/internals/mailer"
 	"task-matrix-be/internals/middlewares"
 	"task-matrix-be/internals/models"
+	"task-matrix-be/internals/oidc"
 	"task-matrix-be/internals/repo"
 	"task-matrix-be/internals/utils"
+	"time"
+
+	"github.com/go-chi/chi/v5"
 )
 
 type userServiceImpl struct {
-	repo           repo.UserRepo
-	tokenGenerator func(payload models.User) (string, error)
+	repo repo.UserRepo
+	// projects joins new users to the projects they were invited to
+	projects repo.ProjectRepo
+	auth     authmodule.Auth[models.User]
+	mailer   mailer.Mailer
+	cfg      *config.Config
+	// oidc is nil when single sign-on is not configured
+	oidc *oidc.Provider
+}
+
+// requestMeta describes the client of r for the session list. RemoteAddr
+// already holds the client IP when middleware.RealIP is mounted.
+func requestMeta(r *http.Request) authmodule.SessionMeta {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	return authmodule.SessionMeta{IP: ip, UserAgent: r.UserAgent()}
+}
+
+// issueTokens builds the login/signup response for user. Backends that
+// support refresh also return a refresh token and the access token lifetime.
+func (s *userServiceImpl) issueTokens(user models.User, meta authmodule.SessionMeta) (map[string]any, error) {
+	if ra, ok := s.auth.(authmodule.RefreshableAuth[models.User]); ok {
+		pair, err := ra.GetTokenPair(user, meta)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{
+			"token":         pair.AccessToken,
+			"refresh_token": pair.RefreshToken,
+			"expires_in":    pair.ExpiresIn,
+			"user":          user,
+		}, nil
+	}
+
+	token, err := s.auth.GetToken(user, meta)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"token": token,
+		"user":  user,
+	}, nil
 }
 
 func (s *userServiceImpl) Login(w http.ResponseWriter, r *http.Request) {
@@ -29,34 +83,97 @@ func (s *userServiceImpl) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashed, err := utils.Hash(payload.Password)
+	ctx := r.Context()
+
+	// Blocked usernames are rejected before the password is checked, so that
+	// guessing cannot go on during a lockout
+	blockedFor, err := s.loginBlockedFor(ctx, payload.Username)
 	if err != nil {
-		log.Printf("[ERROR] [Login] Failed to hash password for user %s: %v", payload.Username, err)
+		log.Printf("[ERROR] [Login] Failed to check lockout for %s: %v", payload.Username, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	if blockedFor > 0 {
+		log.Printf("[WARN] [Login] Login for %s blocked for another %s", payload.Username, blockedFor)
+		s.recordLoginAttempt(ctx, r, payload.Username, nil, false, loginReasonLocked)
+		writeLoginBlocked(w, blockedFor)
+		return
+	}
 
-	user, err := s.repo.GetUserByCreds(r.Context(), payload.Username, hashed)
+	user, hashed, err := s.repo.GetUserByUsername(ctx, payload.Username)
 	if err != nil {
+		// Spend the same time as for a wrong password, so that response
+		// times do not reveal whether the username exists
+		utils.VerifyPassword(dummyPasswordHash(), payload.Password)
 		log.Printf("[WARN] [Login] Invalid credentials for user %s", payload.Username)
+		s.registerLoginFailure(ctx, r, payload.Username, nil, loginReasonInvalidCredentials)
 		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
 		return
 	}
 
-	token, err := s.tokenGenerator(*user)
+	match, needsRehash, err := utils.VerifyPassword(hashed, payload.Password)
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to verify password for user ID %d: %v", user.ID, err)
+	}
+	if !match {
+		if utils.IsLegacyPasswordHash(hashed) {
+			// Legacy hashes are fast to check, pad them to the time of argon2id
+			utils.VerifyPassword(dummyPasswordHash(), payload.Password)
+		}
+		log.Printf("[WARN] [Login] Invalid credentials for user %s", payload.Username)
+		s.registerLoginFailure(ctx, r, payload.Username, &user.ID, loginReasonInvalidCredentials)
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	// Checked before the rehash, which would count as a new password
+	if !s.checkAccountStatus(w, r, *user, true) {
+		return
+	}
+
+	if needsRehash {
+		s.rehashPassword(ctx, user.ID, payload.Password)
+	}
+
+	_, totpEnabled, err := s.repo.GetTOTP(ctx, user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [Login] Failed to load MFA settings for user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if totpEnabled {
+		// Failed logins are only cleared once the second factor is verified
+		s.recordLoginAttempt(ctx, r, user.Username, &user.ID, false, loginReasonMFARequired)
+		s.sendMFAChallenge(w, r, *user)
+		return
+	}
+
+	resp, err := s.issueTokens(*user, requestMeta(r))
 	if err != nil {
 		log.Printf("[ERROR] [Login] Token generation failed for user ID %d: %v", user.ID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	s.registerLoginSuccess(ctx, r, *user, loginReasonPassword)
 	log.Printf("[INFO] [Login] User %s (ID %d) logged in successfully", user.Username, user.ID)
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]any{
-		"token": token,
-		"user":  user,
-	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// rehashPassword upgrades a legacy or outdated password hash after a
+// successful login. Failures are logged only, the old hash keeps working.
+func (s *userServiceImpl) rehashPassword(ctx context.Context, userID int, password string) {
+	hashed, err := utils.HashPassword(password)
+	if err == nil {
+		err = s.repo.UpdatePasswordHash(ctx, userID, hashed)
+	}
+	if err != nil {
+		log.Printf("[WARN] [Login] Failed to upgrade password hash for user ID %d: %v", userID, err)
+		return
+	}
+	log.Printf("[INFO] [Login] Upgraded password hash for user ID %d", userID)
 }
 
 func (s *userServiceImpl) Signup(w http.ResponseWriter, r *http.Request) {
@@ -79,7 +196,7 @@ func (s *userServiceImpl) Signup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashed, err := utils.Hash(payload.Password)
+	hashed, err := utils.HashPassword(payload.Password)
 	if err != nil {
 		log.Printf("[ERROR] [Signup] Failed to hash password for user %s: %v", payload.Username, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -98,7 +215,7 @@ func (s *userServiceImpl) Signup(w http.ResponseWriter, r *http.Request) {
 		Email: payload.Email, AvatarUrl: payload.AvatarUrl,
 	}
 
-	token, err := s.tokenGenerator(user)
+	resp, err := s.issueTokens(user, requestMeta(r))
 	if err != nil {
 		log.Printf("[ERROR] [Signup] Token generation failed for user ID %d: %v", user.ID, err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -107,11 +224,54 @@ func (s *userServiceImpl) Signup(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[INFO] [Signup] User created successfully: %s (ID %d)", user.Username, user.ID)
 
+	verified := false
+	if payload.InvitationToken != "" {
+		verified = s.acceptSignupInvitation(r.Context(), user, payload.InvitationToken)
+	}
+
+	if !verified {
+		if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+			log.Printf("[ERROR] [Signup] Failed to send verification email to user ID %d: %v", user.ID, err)
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]any{
-		"token": token,
-		"user":  user,
-	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *userServiceImpl) Refresh(w http.ResponseWriter, r *http.Request) {
+	ra, ok := s.auth.(authmodule.RefreshableAuth[models.User])
+	if !ok {
+		http.Error(w, authmodule.ErrRefreshUnsupported.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	var payload models.RefreshPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [Refresh] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.RefreshToken == "" {
+		http.Error(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	pair, err := ra.Refresh(payload.RefreshToken)
+	if errors.Is(err, authmodule.ErrRefreshTokenReuse) {
+		log.Printf("[WARN] [Refresh] Refresh token reuse detected, session revoked")
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("[WARN] [Refresh] Refresh failed: %v", err)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(pair)
 }
 
 func (s *userServiceImpl) GetLoggedInUser(w http.ResponseWriter, r *http.Request) {
@@ -127,3 +287,352 @@ func (s *userServiceImpl) GetLoggedInUser(w http.ResponseWriter, r *http.Request
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(user)
 }
+
+func (s *userServiceImpl) Logout(w http.ResponseWriter, r *http.Request) {
+	token, ok := r.Context().Value(middlewares.TokenContextKey).(string)
+	if !ok {
+		log.Printf("[ERROR] [Logout] Middleware context missing")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.auth.Revoke(token); err != nil && !errors.Is(err, authmodule.ErrSessionNotFound) {
+		log.Printf("[ERROR] [Logout] Failed to revoke session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Logged out successfully"}`))
+}
+
+func (s *userServiceImpl) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := s.auth.ListSessions(user)
+	if err != nil {
+		log.Printf("[ERROR] [ListSessions] Failed to list sessions for user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+func (s *userServiceImpl) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := chi.URLParam(r, "id")
+	if sessionID == "" {
+		http.Error(w, "session ID not provided", http.StatusBadRequest)
+		return
+	}
+
+	err := s.auth.RevokeSession(user, sessionID)
+	if errors.Is(err, authmodule.ErrSessionNotFound) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] [RevokeSession] Failed to revoke session %s for user ID %d: %v", sessionID, user.ID, err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [RevokeSession] User ID %d revoked session %s", user.ID, sessionID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Session revoked successfully"}`))
+}
+
+func (s *userServiceImpl) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.auth.RevokeAllForUser(user); err != nil {
+		log.Printf("[ERROR] [RevokeAllSessions] Failed to revoke sessions for user ID %d: %v", user.ID, err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [RevokeAllSessions] User ID %d revoked all sessions", user.ID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"All sessions revoked successfully"}`))
+}
+
+// sendEmailToken issues a single-use token for purpose and emails the user a
+// link to path on the frontend carrying it. The email is delivered in the
+// background so that response times do not depend on the mail server.
+func (s *userServiceImpl) sendEmailToken(ctx context.Context, user models.User, purpose string, ttl time.Duration, path, subject, body string) error {
+	token, err := utils.RandomToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.CreateUserToken(ctx, user.ID, purpose, utils.HashToken(token), time.Now().UTC().Add(ttl)); err != nil {
+		return err
+	}
+
+	link := s.cfg.APP_BASE_URL + path + "?token=" + url.QueryEscape(token)
+	s.deliver(user.ID, mailer.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    fmt.Sprintf(body, user.Name, link, ttl),
+	})
+	return nil
+}
+
+// deliver sends msg to a user in the background
+func (s *userServiceImpl) deliver(userID int, msg mailer.Message) {
+	sendInBackground(s.mailer, fmt.Sprintf("user ID %d", userID), msg)
+}
+
+// sendInBackground sends msg without holding up the request, recipient
+// names the addressee in the logs
+func sendInBackground(m mailer.Mailer, recipient string, msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := m.Send(ctx, msg); err != nil {
+			log.Printf("[ERROR] [Mailer] Failed to send %q to %s: %v", msg.Subject, recipient, err)
+		}
+	}()
+}
+
+// acceptSignupInvitation joins a new user to the project of the invitation
+// they signed up from. The token of an email invitation proves that the user
+// received it, so their address counts as verified and the other projects
+// it was invited to are joined as well. It reports whether the email is
+// verified now.
+func (s *userServiceImpl) acceptSignupInvitation(ctx context.Context, user models.User, token string) bool {
+	invitationID, err := s.projects.GetInvitationIDByToken(ctx, utils.HashToken(token))
+	if err != nil {
+		log.Printf("[WARN] [Signup] Invalid or expired invitation token for user ID %d: %v", user.ID, err)
+		return false
+	}
+
+	invitation, err := s.projects.AcceptInvitation(ctx, user.ID, invitationID, true)
+	if err != nil {
+		log.Printf("[WARN] [Signup] User ID %d could not accept invitation ID %d: %v", user.ID, invitationID, err)
+		return false
+	}
+	log.Printf("[INFO] [Signup] User ID %d joined project ID %d through invitation ID %d", user.ID, invitation.ProjectID, invitationID)
+
+	if invitation.Email == nil {
+		return false
+	}
+	if err := s.repo.MarkEmailVerified(ctx, user.ID); err != nil {
+		log.Printf("[ERROR] [Signup] Failed to mark email verified for user ID %d: %v", user.ID, err)
+		return false
+	}
+	s.joinInvitedProjects(ctx, user.ID)
+	return true
+}
+
+// joinInvitedProjects accepts the invitations sent to the email address of a
+// user who just signed up through one of them. Existing accounts answer
+// their invitations themselves through /me/invitations.
+func (s *userServiceImpl) joinInvitedProjects(ctx context.Context, userID int) {
+	projectIDs, err := s.repo.JoinInvitedProjects(ctx, userID)
+	if err != nil {
+		log.Printf("[ERROR] [Invitations] Failed to join invited projects for user ID %d: %v", userID, err)
+		return
+	}
+	if len(projectIDs) > 0 {
+		log.Printf("[INFO] [Invitations] User ID %d joined invited projects %v", userID, projectIDs)
+	}
+}
+
+func (s *userServiceImpl) sendVerificationEmail(ctx context.Context, user models.User) error {
+	return s.sendEmailToken(ctx, user, repo.TokenPurposeEmailVerification, s.cfg.EMAIL_VERIFICATION_TTL,
+		"/verify-email", "Verify your email address",
+		"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n")
+}
+
+func (s *userServiceImpl) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var payload models.ForgotPasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [ForgotPassword] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	// The response is the same whether or not the email is registered, so
+	// that this endpoint cannot be used to discover accounts
+	user, err := s.repo.GetUserByEmail(r.Context(), payload.Email)
+	if err == nil {
+		err = s.sendEmailToken(r.Context(), *user, repo.TokenPurposePasswordReset, s.cfg.PASSWORD_RESET_TTL,
+			"/reset-password", "Reset your password",
+			"Hi %s,\n\nSomeone asked to reset the password of your account. If it was you, open the link below:\n\n%s\n\nThe link expires in %s. If you did not ask for a reset you can ignore this email.\n")
+		if err != nil {
+			log.Printf("[ERROR] [ForgotPassword] Failed to issue reset token for user ID %d: %v", user.ID, err)
+		} else {
+			log.Printf("[INFO] [ForgotPassword] Reset link sent to user ID %d", user.ID)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"If the email is registered, a password reset link has been sent"}`))
+}
+
+func (s *userServiceImpl) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var payload models.ResetPasswordPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [ResetPassword] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Token == "" || payload.Password == "" {
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Password != payload.ConfirmPassword {
+		http.Error(w, "Passwords do not match", http.StatusBadRequest)
+		return
+	}
+
+	hashed, err := utils.HashPassword(payload.Password)
+	if err != nil {
+		log.Printf("[ERROR] [ResetPassword] Failed to hash password: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := s.repo.ConsumeUserToken(r.Context(), repo.TokenPurposePasswordReset, utils.HashToken(payload.Token))
+	if err != nil {
+		log.Printf("[WARN] [ResetPassword] Invalid or expired reset token: %v", err)
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.repo.UpdatePasswordHash(r.Context(), userID, hashed); err != nil {
+		log.Printf("[ERROR] [ResetPassword] Failed to update password for user ID %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever knew the old password must not stay logged in
+	if err := s.auth.RevokeAllForUser(models.User{ID: userID}); err != nil {
+		log.Printf("[ERROR] [ResetPassword] Failed to revoke sessions for user ID %d: %v", userID, err)
+	}
+
+	log.Printf("[INFO] [ResetPassword] Password reset for user ID %d", userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Password reset successfully"}`))
+}
+
+func (s *userServiceImpl) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var payload models.VerifyEmailPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		log.Printf("[ERROR] [VerifyEmail] Failed to decode payload: %v", err)
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if payload.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := utils.HashToken(payload.Token)
+	userID, err := s.repo.ConsumeUserToken(r.Context(), repo.TokenPurposeEmailVerification, tokenHash)
+	if err != nil {
+		// Links sent to confirm a changed address lead to the same page
+		if userID, err = s.repo.ConsumeUserToken(r.Context(), repo.TokenPurposeEmailChange, tokenHash); err == nil {
+			s.confirmEmailChange(w, r, userID)
+			return
+		}
+		log.Printf("[WARN] [VerifyEmail] Invalid or expired verification token: %v", err)
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.repo.MarkEmailVerified(r.Context(), userID); err != nil {
+		log.Printf("[ERROR] [VerifyEmail] Failed to mark email verified for user ID %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] [VerifyEmail] Email verified for user ID %d", userID)
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Email verified successfully"}`))
+}
+
+func (s *userServiceImpl) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+	if !ok {
+		http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+		return
+	}
+
+	verified, err := s.repo.IsEmailVerified(r.Context(), user.ID)
+	if err != nil {
+		log.Printf("[ERROR] [ResendVerificationEmail] Failed to check verification of user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := s.sendVerificationEmail(r.Context(), user); err != nil {
+		log.Printf("[ERROR] [ResendVerificationEmail] Failed to send verification email to user ID %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message":"Verification email sent"}`))
+}
+
+// RequireVerifiedEmail rejects users whose email is not verified when
+// REQUIRE_VERIFIED_EMAIL is enabled. It must be mounted after AuthMiddleware.
+func (s *userServiceImpl) RequireVerifiedEmail(next http.Handler) http.Handler {
+	if !s.cfg.REQUIRE_VERIFIED_EMAIL {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(middlewares.UserContextKey).(models.User)
+		if !ok {
+			http.Error(w, "Unauthorized: middleware not mounted", http.StatusUnauthorized)
+			return
+		}
+
+		verified, err := s.repo.IsEmailVerified(r.Context(), user.ID)
+		if err != nil {
+			log.Printf("[ERROR] [RequireVerifiedEmail] Failed to check verification of user ID %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !verified {
+			http.Error(w, "Email address is not verified", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -7,6 +7,9 @@ import (
 	"task-matrix-be/internals/config"
 )
 
+// Hash returns the hex SHA-512 digest of plain and the global HASH_SECRET.
+//
+// Deprecated: only kept to verify legacy password hashes, use HashPassword.
 func Hash(plain string) (string, error) {
 	hasher := sha512.New()
 	
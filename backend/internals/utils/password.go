@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters for newly hashed passwords (OWASP minimum recommendation)
+const (
+	argonMemory  uint32 = 19 * 1024
+	argonTime    uint32 = 2
+	argonThreads uint8  = 1
+	argonSaltLen        = 16
+	argonKeyLen  uint32 = 32
+)
+
+var errMalformedHash = errors.New("malformed password hash")
+
+// HashPassword hashes plain with argon2id and a random per-password salt,
+// returning it in the PHC string format:
+// $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<key>
+func HashPassword(plain string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(plain), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// VerifyPassword reports whether plain matches the stored hash. needsRehash
+// is true when the match was against a legacy SHA-512 hash or argon2id
+// parameters weaker than the current ones, in which case the caller should
+// store a fresh HashPassword result.
+func VerifyPassword(hashed, plain string) (ok, needsRehash bool, err error) {
+	if IsLegacyPasswordHash(hashed) {
+		return verifyLegacyPassword(hashed, plain)
+	}
+
+	var version int
+	var memory, time uint32
+	var threads uint8
+	parts := strings.Split(hashed, "$")
+	if len(parts) != 6 {
+		return false, false, errMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, errMalformedHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false, errMalformedHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errMalformedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, errMalformedHash
+	}
+
+	candidate := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return false, false, nil
+	}
+
+	needsRehash = memory < argonMemory || time < argonTime || threads < argonThreads || uint32(len(key)) < argonKeyLen
+	return true, needsRehash, nil
+}
+
+// IsLegacyPasswordHash reports whether hashed was produced by Hash rather
+// than HashPassword
+func IsLegacyPasswordHash(hashed string) bool {
+	return !strings.HasPrefix(hashed, "$argon2id$")
+}
+
+// verifyLegacyPassword checks plain against a hash produced by Hash, which
+// every account created before argon2id was introduced still has
+func verifyLegacyPassword(hashed, plain string) (ok, needsRehash bool, err error) {
+	legacy, err := Hash(plain)
+	if err != nil {
+		return false, false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashed), []byte(legacy)) != 1 {
+		return false, false, nil
+	}
+	return true, true, nil
+}